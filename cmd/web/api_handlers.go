@@ -0,0 +1,404 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/Abdelrahman-habib/noter/internal/models"
+	"github.com/google/uuid"
+)
+
+// apiPageSize is the number of notes returned by the paginated API listings.
+const apiPageSize = 10
+
+func (app *application) apiListNotes(w http.ResponseWriter, r *http.Request) {
+	page, err := app.readPage(r)
+	if err != nil {
+		app.apiBadRequest(w, r, err)
+		return
+	}
+
+	sort, err := app.readSort(r)
+	if err != nil {
+		app.apiBadRequest(w, r, err)
+		return
+	}
+
+	showPublic := true
+	filters := models.NotesFilters{ShowPublic: &showPublic, Tag: app.readTagFilter(r), HideRestricted: true, Sort: sort}
+	notes, metaData, err := app.notes.GetByPage(page, apiPageSize, nil, filters)
+	if err != nil {
+		app.apiServerError(w, r, err)
+		return
+	}
+	err = app.attachTags(notes)
+	if err != nil {
+		app.apiServerError(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"notes": notes, "metadata": metaData, "page": page}, nil)
+	if err != nil {
+		app.apiServerError(w, r, err)
+	}
+}
+
+func (app *application) apiNoteView(w http.ResponseWriter, r *http.Request) {
+	note, ok := app.apiVisibleNote(w, r, app.authenticatedUserID(r))
+	if !ok {
+		return
+	}
+	err := app.attachNoteTags(&note)
+	if err != nil {
+		app.apiServerError(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"note": note}, nil)
+	if err != nil {
+		app.apiServerError(w, r, err)
+	}
+}
+
+func (app *application) apiNoteCreate(w http.ResponseWriter, r *http.Request) {
+	var input noteUpsertForm
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.apiBadRequest(w, r, err)
+		return
+	}
+
+	userID := app.authenticatedUserID(r)
+	notebooks, err := app.notebooks.GetAllForUser(userID)
+	if err != nil {
+		app.apiServerError(w, r, err)
+		return
+	}
+	input.validate()
+	input.validateNotebook(notebooks)
+	if input.Visibility == "public" {
+		canPublish, err := app.canPublish(userID, "")
+		if err != nil {
+			app.apiServerError(w, r, err)
+			return
+		}
+		input.validatePublishing(canPublish)
+	}
+	if !input.Valid() {
+		app.apiFailedValidation(w, r, input.FieldsErrors)
+		return
+	}
+
+	id, err := app.notes.Insert(input.Title, input.Content, input.Format, input.Language, input.expires, input.Visibility == "public", input.BurnAfterReading, input.Password, userID)
+	if err != nil {
+		app.apiServerError(w, r, err)
+		return
+	}
+	err = app.tags.SetForNote(id, input.Tags)
+	if err != nil {
+		app.apiServerError(w, r, err)
+		return
+	}
+	_, err = app.notebooks.MoveNotes([]string{id}, input.NotebookID, userID)
+	if err != nil {
+		app.apiServerError(w, r, err)
+		return
+	}
+
+	note, err := app.notes.Get(id, &userID)
+	if err != nil {
+		app.apiServerError(w, r, err)
+		return
+	}
+	note.Tags = input.Tags
+
+	headers := make(http.Header)
+	headers.Set("Location", "/api/v1/notes/"+id)
+
+	err = app.writeJSON(w, http.StatusCreated, envelope{"note": note}, headers)
+	if err != nil {
+		app.apiServerError(w, r, err)
+	}
+}
+
+func (app *application) apiNoteUpdate(w http.ResponseWriter, r *http.Request) {
+	userID := app.authenticatedUserID(r)
+	note, ok := app.apiEditableNote(w, r, userID)
+	if !ok {
+		return
+	}
+
+	var input noteUpsertForm
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.apiBadRequest(w, r, err)
+		return
+	}
+	// Leaving the expiry out keeps the current one, as collaborators can't
+	// change it anyway.
+	if input.Expires == 0 && input.ExpiresIn == "" && input.ExpiresAt == "" && !input.NeverExpires {
+		input.ID, input.Lifetime = note.ID, "keep"
+	}
+
+	// Only the owner files the note, so collaborators putting back the
+	// note they read, with the owner's notebook_id, leave it where it is.
+	if note.CreatedBy != userID {
+		input.NotebookID = 0
+	}
+
+	notebooks, err := app.notebooks.GetAllForUser(userID)
+	if err != nil {
+		app.apiServerError(w, r, err)
+		return
+	}
+	input.validate()
+	input.validateNotebook(notebooks)
+	input.CheckField(input.Version > 0, "version", "This field must be the version of the note the edit is based on")
+	if input.Visibility == "public" {
+		canPublish, err := app.canPublish(userID, note.ID)
+		if err != nil {
+			app.apiServerError(w, r, err)
+			return
+		}
+		input.validatePublishing(canPublish)
+	}
+	if !input.Valid() {
+		app.apiFailedValidation(w, r, input.FieldsErrors)
+		return
+	}
+
+	if input.Lifetime == "keep" {
+		input.expires = note.Expires
+	}
+	_, err = app.notes.Update(note.ID, input.Version, input.Title, input.Content, input.Format, input.Language, input.expires, input.Visibility == "public", userID)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.apiNotFound(w, r)
+			return
+		}
+		if errors.Is(err, models.ErrEditConflict) {
+			app.apiEditConflict(w, r)
+			return
+		}
+		app.apiServerError(w, r, err)
+		return
+	}
+	err = app.tags.SetForNote(note.ID, input.Tags)
+	if err != nil {
+		app.apiServerError(w, r, err)
+		return
+	}
+	_, err = app.notebooks.MoveNotes([]string{note.ID}, input.NotebookID, userID)
+	if err != nil {
+		app.apiServerError(w, r, err)
+		return
+	}
+
+	note, err = app.notes.Get(note.ID, &userID)
+	if err != nil {
+		app.apiServerError(w, r, err)
+		return
+	}
+	note.Tags = input.Tags
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"note": note}, nil)
+	if err != nil {
+		app.apiServerError(w, r, err)
+	}
+}
+
+func (app *application) apiNoteDelete(w http.ResponseWriter, r *http.Request) {
+	userID := app.authenticatedUserID(r)
+	note, ok := app.apiOwnedNote(w, r, userID)
+	if !ok {
+		return
+	}
+
+	err := app.notes.Delete(note.ID, &userID)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.apiNotFound(w, r)
+			return
+		}
+		app.apiServerError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (app *application) apiUserView(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil || id < 1 {
+		app.apiNotFound(w, r)
+		return
+	}
+
+	user, err := app.users.GetByID(id)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.apiNotFound(w, r)
+			return
+		}
+		app.apiServerError(w, r, err)
+		return
+	}
+
+	// Email addresses, and whether they are verified, are only disclosed
+	// to their owner.
+	if app.authenticatedUserID(r) != id {
+		user.Email = ""
+		user.EmailVerified = false
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"user": user}, nil)
+	if err != nil {
+		app.apiServerError(w, r, err)
+	}
+}
+
+func (app *application) apiUserNotes(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil || id < 1 {
+		app.apiNotFound(w, r)
+		return
+	}
+
+	page, err := app.readPage(r)
+	if err != nil {
+		app.apiBadRequest(w, r, err)
+		return
+	}
+
+	sort, err := app.readSort(r)
+	if err != nil {
+		app.apiBadRequest(w, r, err)
+		return
+	}
+
+	_, err = app.users.GetByID(id)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.apiNotFound(w, r)
+			return
+		}
+		app.apiServerError(w, r, err)
+		return
+	}
+
+	// Other users only ever see public notes; the owner may narrow the
+	// listing with ?show=public or ?show=private, and to one of their
+	// notebooks with ?notebook=, like on /my-notes.
+	trueBool, falseBool := true, false
+	showPublic := &trueBool
+	notebookID := 0
+	if app.authenticatedUserID(r) == id {
+		notebookID, err = app.readNotebookFilter(r)
+		if err != nil {
+			app.apiBadRequest(w, r, err)
+			return
+		}
+
+		switch r.URL.Query().Get("show") {
+		case "public":
+			showPublic = &trueBool
+		case "private":
+			showPublic = &falseBool
+		default:
+			showPublic = nil
+		}
+	}
+
+	filters := models.NotesFilters{
+		ShowPublic:     showPublic,
+		Tag:            app.readTagFilter(r),
+		NotebookID:     notebookID,
+		HideRestricted: app.authenticatedUserID(r) != id,
+		Sort:           sort,
+	}
+	notes, metaData, err := app.notes.GetByPage(page, apiPageSize, &id, filters)
+	if err != nil {
+		app.apiServerError(w, r, err)
+		return
+	}
+	err = app.attachTags(notes)
+	if err != nil {
+		app.apiServerError(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"notes": notes, "metadata": metaData, "page": page}, nil)
+	if err != nil {
+		app.apiServerError(w, r, err)
+	}
+}
+
+// apiOwnedNote loads the note named by the {id} path value and checks that it
+// belongs to userID. On failure it writes the error response itself and
+// returns false.
+func (app *application) apiOwnedNote(w http.ResponseWriter, r *http.Request, userID int) (models.NoteWithUsername, bool) {
+	note, ok := app.apiVisibleNote(w, r, userID)
+	if !ok {
+		return models.NoteWithUsername{}, false
+	}
+
+	if note.CreatedBy != userID {
+		app.apiErrorResponse(w, r, http.StatusForbidden, apiError{
+			Message: "you do not have permission to modify this note",
+		})
+		return models.NoteWithUsername{}, false
+	}
+	return note, true
+}
+
+// apiEditableNote is like apiOwnedNote but also lets through users the note
+// has been shared with for editing.
+func (app *application) apiEditableNote(w http.ResponseWriter, r *http.Request, userID int) (models.NoteWithUsername, bool) {
+	note, ok := app.apiVisibleNote(w, r, userID)
+	if !ok {
+		return models.NoteWithUsername{}, false
+	}
+
+	canEdit, err := app.canEdit(note, userID)
+	if err != nil {
+		app.apiServerError(w, r, err)
+		return models.NoteWithUsername{}, false
+	}
+	if !canEdit {
+		app.apiErrorResponse(w, r, http.StatusForbidden, apiError{
+			Message: "you do not have permission to modify this note",
+		})
+		return models.NoteWithUsername{}, false
+	}
+	return note, true
+}
+
+// apiVisibleNote loads the note named by the {id} path value if userID is
+// allowed to see it. Burn-after-reading and password-protected notes are only
+// handed to their owner: everyone else has to open them in the browser, and
+// gets a 404 so the API doesn't confirm they exist.
+func (app *application) apiVisibleNote(w http.ResponseWriter, r *http.Request, userID int) (models.NoteWithUsername, bool) {
+	id := r.PathValue("id")
+	if err := uuid.Validate(id); err != nil {
+		app.apiNotFound(w, r)
+		return models.NoteWithUsername{}, false
+	}
+
+	note, err := app.notes.Get(id, &userID)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.apiNotFound(w, r)
+			return models.NoteWithUsername{}, false
+		}
+		app.apiServerError(w, r, err)
+		return models.NoteWithUsername{}, false
+	}
+	if (note.BurnAfterReading || note.Protected) && note.CreatedBy != userID {
+		app.apiNotFound(w, r)
+		return models.NoteWithUsername{}, false
+	}
+	return note, true
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+)
+
+// envelope wraps every JSON response body in a named top-level key, e.g.
+// {"note": {...}} or {"error": {...}}.
+type envelope map[string]any
+
+// apiError is the body of the "error" key in an error response. Fields holds
+// the same per-field messages the HTML forms render through validator.Validator.
+type apiError struct {
+	Message string            `json:"message"`
+	Fields  map[string]string `json:"fields,omitempty"`
+}
+
+var errUnsupportedMediaType = errors.New("body must be sent with Content-Type application/json")
+
+func (app *application) writeJSON(w http.ResponseWriter, status int, data envelope, headers http.Header) error {
+	js, err := json.MarshalIndent(data, "", "\t")
+	if err != nil {
+		return err
+	}
+	js = append(js, '\n')
+
+	for key, value := range headers {
+		w.Header()[key] = value
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(js)
+	return nil
+}
+
+// readJSON decodes a single JSON object from the request body into dst. Only
+// application/json bodies are accepted: browsers can't send that content type
+// cross-origin without a CORS preflight, which is what keeps the cookie
+// authenticated API safe without a CSRF token.
+func (app *application) readJSON(w http.ResponseWriter, r *http.Request, dst any) error {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType != "application/json" {
+		return errUnsupportedMediaType
+	}
+
+	maxBytes := 1_048_576
+	r.Body = http.MaxBytesReader(w, r.Body, int64(maxBytes))
+
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+
+	err := dec.Decode(dst)
+	if err != nil {
+		var syntaxError *json.SyntaxError
+		var unmarshalTypeError *json.UnmarshalTypeError
+		var invalidUnmarshalError *json.InvalidUnmarshalError
+		var maxBytesError *http.MaxBytesError
+
+		switch {
+		case errors.As(err, &syntaxError):
+			return fmt.Errorf("body contains badly-formed JSON (at character %d)", syntaxError.Offset)
+		case errors.Is(err, io.ErrUnexpectedEOF):
+			return errors.New("body contains badly-formed JSON")
+		case errors.As(err, &unmarshalTypeError):
+			if unmarshalTypeError.Field != "" {
+				return fmt.Errorf("body contains incorrect JSON type for field %q", unmarshalTypeError.Field)
+			}
+			return fmt.Errorf("body contains incorrect JSON type (at character %d)", unmarshalTypeError.Offset)
+		case errors.Is(err, io.EOF):
+			return errors.New("body must not be empty")
+		case strings.HasPrefix(err.Error(), "json: unknown field "):
+			fieldName := strings.TrimPrefix(err.Error(), "json: unknown field ")
+			return fmt.Errorf("body contains unknown key %s", fieldName)
+		case errors.As(err, &maxBytesError):
+			return fmt.Errorf("body must not be larger than %d bytes", maxBytesError.Limit)
+		case errors.As(err, &invalidUnmarshalError):
+			panic(err)
+		default:
+			return err
+		}
+	}
+
+	err = dec.Decode(&struct{}{})
+	if !errors.Is(err, io.EOF) {
+		return errors.New("body must only contain a single JSON value")
+	}
+	return nil
+}
+
+func (app *application) apiErrorResponse(w http.ResponseWriter, r *http.Request, status int, apiErr apiError) {
+	err := app.writeJSON(w, status, envelope{"error": apiErr}, nil)
+	if err != nil {
+		app.logger.Error(err.Error(), "method", r.Method, "uri", r.URL.RequestURI())
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
+
+// The apiServerError helper is the JSON counterpart of serverError: it logs the
+// error and sends a generic 500 message so internals never leak to clients.
+func (app *application) apiServerError(w http.ResponseWriter, r *http.Request, err error) {
+	app.logger.Error(err.Error(), "method", r.Method, "uri", r.URL.RequestURI())
+	app.apiErrorResponse(w, r, http.StatusInternalServerError, apiError{
+		Message: "the server encountered a problem and could not process your request",
+	})
+}
+
+func (app *application) apiBadRequest(w http.ResponseWriter, r *http.Request, err error) {
+	status := http.StatusBadRequest
+	if errors.Is(err, errUnsupportedMediaType) {
+		status = http.StatusUnsupportedMediaType
+	}
+	app.apiErrorResponse(w, r, status, apiError{Message: err.Error()})
+}
+
+func (app *application) apiNotFound(w http.ResponseWriter, r *http.Request) {
+	app.apiErrorResponse(w, r, http.StatusNotFound, apiError{
+		Message: "the requested resource could not be found",
+	})
+}
+
+func (app *application) apiEditConflict(w http.ResponseWriter, r *http.Request) {
+	app.apiErrorResponse(w, r, http.StatusConflict, apiError{
+		Message: "the note was changed since the version this edit is based on, fetch it and try again",
+	})
+}
+
+func (app *application) apiFailedValidation(w http.ResponseWriter, r *http.Request, fieldsErrors map[string]string) {
+	app.apiErrorResponse(w, r, http.StatusUnprocessableEntity, apiError{
+		Message: "the request failed validation",
+		Fields:  fieldsErrors,
+	})
+}
+
+func (app *application) apiAuthenticationRequired(w http.ResponseWriter, r *http.Request) {
+	app.apiErrorResponse(w, r, http.StatusUnauthorized, apiError{
+		Message: "you must be authenticated to access this resource",
+	})
+}
+
+func (app *application) invalidAuthenticationToken(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("WWW-Authenticate", "Bearer")
+	app.apiErrorResponse(w, r, http.StatusUnauthorized, apiError{
+		Message: "invalid or revoked authentication token",
+	})
+}
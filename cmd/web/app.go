@@ -1,15 +1,24 @@
 package main
 
 import (
+	"context"
 	"crypto/tls"
+	"errors"
+	"fmt"
 	"html/template"
 	"log/slog"
 	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"sync/atomic"
+	"syscall"
 	"time"
 
 	"github.com/alexedwards/scs/v2"
 	"github.com/go-playground/form/v4"
 
+	"github.com/Abdelrahman-habib/noter/internal/mailer"
 	"github.com/Abdelrahman-habib/noter/internal/models"
 )
 
@@ -18,11 +27,45 @@ type application struct {
 	config         *config
 	notes          models.NoteModelInterface
 	users          models.UserModelInterface
+	tokens         models.TokenModelInterface
+	tags           models.TagModelInterface
+	revisions      models.RevisionModelInterface
+	shareLinks     models.ShareLinkModelInterface
+	noteShares     models.NoteShareModelInterface
+	notebooks      models.NotebookModelInterface
+	favorites      models.FavoriteModelInterface
+	passwordResets models.PasswordResetModelInterface
+	twoFactor      models.TwoFactorModelInterface
+	lockouts       models.LockoutModelInterface
+	sessions       models.SessionModelInterface
 	templateCache  map[string]*template.Template
 	formDecoder    *form.Decoder
 	sessionManager *scs.SessionManager
+	mailer         mailer.Mailer
+	signer         *signer
+
+	// notePasswordLimiter counts wrong passwords per protected note,
+	// verificationLimiter the verification emails sent per user,
+	// passwordResetLimiter the reset links sent per email address,
+	// twoFactorLimiter the wrong login codes per user and loginLimiter the
+	// failed logins per client IP.
+	notePasswordLimiter  *attemptLimiter
+	verificationLimiter  *attemptLimiter
+	passwordResetLimiter *attemptLimiter
+	twoFactorLimiter     *attemptLimiter
+	loginLimiter         *backoffLimiter
+
+	// wg tracks goroutines started with background, and the two counters
+	// record what a graceful shutdown has to wait for.
+	wg              sync.WaitGroup
+	backgroundTasks atomic.Int64
+	inFlight        atomic.Int64
 }
 
+// serve runs the HTTP server and the janitor until the process receives
+// SIGINT or SIGTERM. It then stops accepting connections, waits up to
+// shutdownTimeout for in-flight requests and background goroutines to finish,
+// and returns nil if everything drained in time.
 func (app *application) serve() error {
 	server := &http.Server{
 		Addr:    app.config.addr,
@@ -34,8 +77,41 @@ func (app *application) serve() error {
 		WriteTimeout: 10 * time.Second,
 		IdleTimeout:  time.Minute,
 	}
+
+	backgroundCtx, stopBackground := context.WithCancel(context.Background())
+	defer stopBackground()
+	app.background(func() {
+		app.runJanitor(backgroundCtx)
+	})
+
+	shutdownError := make(chan error)
+	go func() {
+		quit := make(chan os.Signal, 1)
+		signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
+		s := <-quit
+
+		app.logger.Info("shutting down server",
+			slog.String("signal", s.String()),
+			slog.Int64("in_flight_requests", app.inFlight.Load()),
+			slog.Int64("background_tasks", app.backgroundTasks.Load()),
+		)
+
+		ctx, cancel := context.WithTimeout(context.Background(), app.config.shutdownTimeout)
+		defer cancel()
+
+		err := server.Shutdown(ctx)
+		if err != nil {
+			shutdownError <- err
+			return
+		}
+
+		stopBackground()
+		shutdownError <- app.drainBackground(ctx)
+	}()
+
 	app.logger.Info("starting server", slog.String("addr", server.Addr))
 
+	var err error
 	// Use TLS only in development if certificate files are available
 	// In production (Render), TLS is handled by the platform
 	if app.config.env == envDevelopment && app.config.tlsCert != "" && app.config.tlsKey != "" {
@@ -44,8 +120,37 @@ func (app *application) serve() error {
 			CurvePreferences: []tls.CurveID{tls.X25519, tls.CurveP256},
 		}
 		server.TLSConfig = tlsConfig
-		return server.ListenAndServeTLS(app.config.tlsCert, app.config.tlsKey)
+		err = server.ListenAndServeTLS(app.config.tlsCert, app.config.tlsKey)
+	} else {
+		err = server.ListenAndServe()
+	}
+	if !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+
+	err = <-shutdownError
+	if err != nil {
+		return err
 	}
 
-	return server.ListenAndServe()
+	app.logger.Info("stopped server", slog.String("addr", server.Addr))
+	return nil
+}
+
+// drainBackground waits for the goroutines started with background to return,
+// giving up when ctx is done.
+func (app *application) drainBackground(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		app.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		app.logger.Info("drained background tasks")
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("draining background tasks: %w (%d still running)", ctx.Err(), app.backgroundTasks.Load())
+	}
 }
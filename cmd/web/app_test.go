@@ -0,0 +1,43 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Abdelrahman-habib/noter/internal/assert"
+)
+
+func TestDrainBackground(t *testing.T) {
+	t.Run("Drained", func(t *testing.T) {
+		app := newTestApplication(t)
+		app.background(func() {
+			panic("boom")
+		})
+		app.background(func() {
+			time.Sleep(10 * time.Millisecond)
+		})
+
+		err := app.drainBackground(context.Background())
+		assert.NilError(t, err)
+		assert.Equal(t, app.backgroundTasks.Load(), 0)
+	})
+
+	t.Run("Timed out", func(t *testing.T) {
+		app := newTestApplication(t)
+		release := make(chan struct{})
+		defer close(release)
+		app.background(func() {
+			<-release
+		})
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+
+		err := app.drainBackground(ctx)
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("got %v; want %v", err, context.DeadlineExceeded)
+		}
+	})
+}
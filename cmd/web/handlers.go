@@ -5,22 +5,261 @@ import (
 	"fmt"
 	"log/slog"
 	"net/http"
+	"regexp"
+	"slices"
 	"strconv"
+	"strings"
+	"time"
 
+	"github.com/Abdelrahman-habib/noter/internal/diff"
 	"github.com/Abdelrahman-habib/noter/internal/models"
+	"github.com/Abdelrahman-habib/noter/internal/syntax"
+	"github.com/Abdelrahman-habib/noter/internal/totp"
 	"github.com/Abdelrahman-habib/noter/internal/validator"
 	"github.com/google/uuid"
 )
 
 type noteUpsertForm struct {
-	ID                  string `form:"id"`
-	Title               string `form:"title"`
-	Content             string `form:"content"`
-	Expires             int    `form:"expires"`
-	Visibility          string `form:"visibility"`
+	ID string `form:"id" json:"-"`
+	// Version is the version of the note the edit is based on. Edits of an
+	// older version than the current one conflict.
+	Version    int      `form:"version" json:"version"`
+	Title      string   `form:"title" json:"title"`
+	Content    string   `form:"content" json:"content"`
+	Format     string   `form:"format" json:"format"`
+	Language   string   `form:"language" json:"language"`
+	Visibility string   `form:"visibility" json:"visibility"`
+	Tags       []string `form:"tags" json:"tags"`
+	// NotebookID files the note in one of its owner's notebooks, zero for
+	// none. It is ignored when someone the note is shared with edits it.
+	NotebookID int `form:"notebook_id" json:"notebook_id"`
+	// The note's lifetime is given by exactly one of Expires, in days,
+	// ExpiresIn, a duration such as 90m, 36h, 10d or 2w, ExpiresAt, a date
+	// and time in UTC, or NeverExpires. The HTML form sends them all and
+	// picks one with Lifetime, or keeps an edited note's expiry as it is.
+	Lifetime     string `form:"lifetime" json:"-"`
+	Expires      int    `form:"expires" json:"expires"`
+	ExpiresIn    string `form:"expires_in" json:"expires_in"`
+	ExpiresAt    string `form:"expires_at" json:"expires_at"`
+	NeverExpires bool   `form:"never_expires" json:"never_expires"`
+	// Submitted is the content of an edit that conflicted with a newer
+	// version of the note, shown next to the draft merging the two that
+	// replaces Content.
+	Submitted string `form:"-" json:"-"`
+	// BurnAfterReading and Password can only be chosen when the note is
+	// created. The password is changed from the note page afterwards.
+	BurnAfterReading    bool   `form:"burn_after_reading" json:"burn_after_reading"`
+	Password            string `form:"password" json:"password"`
+	validator.Validator `form:"-" json:"-"`
+
+	// expires is the expiry validate works out from the lifetime fields,
+	// zero when the note never expires.
+	expires time.Time
+}
+
+var tagRX = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]*$`)
+
+// validate runs the note checks shared by the HTML form and the JSON API, so
+// both report the same field errors.
+func (form *noteUpsertForm) validate() {
+	form.CheckField(validator.NotBlank(form.Title), "title", "This field cannot be blank")
+	form.CheckField(validator.MaxChars(form.Title, 100), "title", "This field cannot be more than 100 characters long")
+	form.CheckField(validator.NotBlank(form.Content), "content", "This field cannot be blank")
+	form.validateFormat()
+	form.validateExpiry(time.Now())
+	form.CheckField(validator.PermittedValue(form.Visibility, "public", "private"), "visibility", "This field must equal public or private")
+	form.CheckField(form.Password == "" || validator.MinChars(form.Password, 8), "password", "This field must be at least 8 characters long")
+
+	form.Tags = models.NormalizeTags(form.Tags)
+	form.CheckField(len(form.Tags) <= 10, "tags", "This field cannot have more than 10 tags")
+	for _, tag := range form.Tags {
+		form.CheckField(validator.MaxChars(tag, 30), "tags", "Tags cannot be more than 30 characters long")
+		form.CheckField(validator.Matches(tag, tagRX), "tags", "Tags may only contain letters, digits, dashes and underscores")
+	}
+}
+
+// validateNotebook checks that the note is filed in one of the notebooks of
+// the user saving it.
+func (form *noteUpsertForm) validateNotebook(notebooks []models.Notebook) {
+	form.CheckField(form.NotebookID == 0 || hasNotebook(notebooks, form.NotebookID), "notebook_id", "This field must be one of your notebooks")
+}
+
+// validatePublishing keeps the note private unless its author may publish
+// it, see canPublish.
+func (form *noteUpsertForm) validatePublishing(canPublish bool) {
+	form.CheckField(canPublish || form.Visibility != "public", "visibility", "Verify your email address to publish public notes")
+}
+
+// validateFormat checks how the note's content is to be displayed and fills
+// in the defaults. The preview tab shares it with validate.
+func (form *noteUpsertForm) validateFormat() {
+	// Notes predating the format field, and API clients that omit it, are
+	// plain text.
+	if form.Format == "" {
+		form.Format = models.FormatPlain
+	}
+	form.CheckField(validator.PermittedValue(form.Format, models.FormatPlain, models.FormatMarkdown), "format", "This field must equal plain or markdown")
+	form.CheckField(form.Language == "" || syntax.Supported(form.Language), "language", "This field must be a supported language")
+
+	// Markdown notes mark up their own code blocks. Plain notes left on
+	// auto-detect get the language their content looks like, if any.
+	switch {
+	case form.Format == models.FormatMarkdown:
+		form.Language = ""
+	case form.Language == "":
+		form.Language = syntax.Detect(form.Content)
+	}
+}
+
+// validateExpiry works out when the note expires from whichever lifetime
+// field was filled in.
+func (form *noteUpsertForm) validateExpiry(now time.Time) {
+	switch form.Lifetime {
+	case "":
+		// The JSON API sets the field it wants.
+	case "duration":
+		form.Expires, form.ExpiresAt, form.NeverExpires = 0, "", false
+		form.CheckField(validator.NotBlank(form.ExpiresIn), "expires_in", "This field cannot be blank")
+	case "date":
+		form.Expires, form.ExpiresIn, form.NeverExpires = 0, "", false
+		form.CheckField(validator.NotBlank(form.ExpiresAt), "expires_at", "This field cannot be blank")
+	case "never":
+		form.Expires, form.ExpiresIn, form.ExpiresAt, form.NeverExpires = 0, "", "", true
+	case "keep":
+		// The caller passes the stored expiry on, see noteCreatePost.
+		form.Expires, form.ExpiresIn, form.ExpiresAt, form.NeverExpires = 0, "", "", false
+		form.CheckField(form.ID != "", "expires", "This field must be a number of days, a duration, a date or never")
+		return
+	default:
+		days, err := strconv.Atoi(form.Lifetime)
+		if err != nil {
+			form.AddFieldError("expires", "This field must be a number of days, a duration, a date or never")
+			return
+		}
+		form.Expires, form.ExpiresIn, form.ExpiresAt, form.NeverExpires = days, "", "", false
+	}
+	if !form.Valid() {
+		return
+	}
+
+	chosen := 0
+	for _, set := range []bool{form.Expires != 0, form.ExpiresIn != "", form.ExpiresAt != "", form.NeverExpires} {
+		if set {
+			chosen++
+		}
+	}
+	if chosen != 1 {
+		form.AddFieldError("expires", "Exactly one of expires, expires_in, expires_at or never_expires must be set")
+		return
+	}
+
+	switch {
+	case form.NeverExpires:
+		form.expires = time.Time{}
+	case form.Expires != 0:
+		form.CheckField(form.Expires > 0 && form.Expires <= maxLifetimeDays, "expires", fmt.Sprintf("This field must be between 1 and %d days", maxLifetimeDays))
+		form.expires = now.AddDate(0, 0, form.Expires)
+	case form.ExpiresIn != "":
+		lifetime, err := parseLifetime(form.ExpiresIn)
+		form.CheckField(err == nil, "expires_in", "This field must be a duration such as 90m, 36h, 10d or 2w")
+		form.CheckField(err != nil || lifetime >= time.Minute && lifetime <= maxLifetimeDays*24*time.Hour, "expires_in", fmt.Sprintf("This field must be between a minute and %d days", maxLifetimeDays))
+		form.expires = now.Add(lifetime)
+	default:
+		expires, err := parseExpiryDate(form.ExpiresAt)
+		form.CheckField(err == nil, "expires_at", "This field must be a date and time such as 2030-01-31T18:00")
+		form.CheckField(err != nil || expires.After(now), "expires_at", "This field must be in the future")
+		form.CheckField(err != nil || expires.Before(now.AddDate(0, 0, maxLifetimeDays)), "expires_at", fmt.Sprintf("This field must be within %d days", maxLifetimeDays))
+		form.expires = expires
+	}
+}
+
+// noteViewForm backs the owner's forms on the note page: one extends its
+// expiry, one creates share links, one shares the note with a named user and
+// one sets its access password.
+type noteViewForm struct {
+	ExtendBy            string `form:"extend_by"`
+	ExpiresIn           int    `form:"expires_in"`
+	MaxViews            int    `form:"max_views"`
+	Email               string `form:"email"`
+	Permission          string `form:"permission"`
+	Password            string `form:"password"`
+	validator.Validator `form:"-"`
+}
+
+// maxLifetimeDays is how far in the future a note's expiry can be set.
+const maxLifetimeDays = 3650
+
+// notebookForm is shared by the forms of the notebooks sidebar on /my-notes:
+// creating a notebook, and moving the selected notes to one.
+type notebookForm struct {
+	Name                string   `form:"name"`
+	ParentID            int      `form:"parent_id"`
+	NoteIDs             []string `form:"note_id"`
+	NotebookID          int      `form:"notebook_id"`
+	validator.Validator `form:"-"`
+}
+
+// maxNotebookDepth is how many levels deep notebooks can be nested.
+const maxNotebookDepth = 5
+
+type noteUnlockForm struct {
+	Password            string `form:"password"`
 	validator.Validator `form:"-"`
 }
 
+// A note's password may be entered wrong notePasswordAttempts times per
+// notePasswordWindow before the unlock form stops checking it.
+const (
+	notePasswordAttempts = 5
+	notePasswordWindow   = 15 * time.Minute
+)
+
+// Signing up sends a verification email; verificationEmails more can be
+// asked for per verificationEmailWindow. The links stay valid for
+// emailVerificationTTL.
+const (
+	verificationEmails      = 3
+	verificationEmailWindow = time.Hour
+	emailVerificationTTL    = 72 * time.Hour
+)
+
+// Password reset links stay valid for passwordResetTTL, and at most
+// passwordResetEmails of them are sent to an address per
+// passwordResetEmailWindow.
+const (
+	passwordResetTTL         = time.Hour
+	passwordResetEmails      = 3
+	passwordResetEmailWindow = time.Hour
+)
+
+// Logging in with two-factor authentication has to be finished within
+// twoFactorLoginTTL of entering the password, and a code may be entered wrong
+// twoFactorAttempts times per twoFactorWindow.
+const (
+	twoFactorLoginTTL = 5 * time.Minute
+	twoFactorAttempts = 5
+	twoFactorWindow   = 15 * time.Minute
+)
+
+// Failed logins are counted per account and per client IP. Past the free
+// ones, each failure makes the next login wait twice as long, and lockAfter
+// of them in a row lock the account out. Client IPs only back off: behind a
+// proxy without -trust-proxy they are shared by everyone. Failures are
+// forgotten after loginFailureMemory without any.
+var (
+	accountLoginPolicy = backoffPolicy{free: 3, maxWait: 15 * time.Minute, lockAfter: 10, lockout: 15 * time.Minute}
+	ipLoginPolicy      = backoffPolicy{free: 20, maxWait: time.Minute}
+)
+
+const loginFailureMemory = 24 * time.Hour
+
+// recentLockouts is how many lockouts the admin page lists.
+const recentLockouts = 50
+
+// loginThrottledMessage is shown alike for locked accounts and IPs, so that
+// it doesn't tell which one was locked.
+const loginThrottledMessage = "Too many failed login attempts. Please try again later."
+
 type userSignupForm struct {
 	Name                string `form:"name"`
 	Email               string `form:"email"`
@@ -34,6 +273,34 @@ type userLoginForm struct {
 	validator.Validator `form:"-"`
 }
 
+type userForgotPasswordForm struct {
+	Email               string `form:"email"`
+	validator.Validator `form:"-"`
+}
+
+type userResetPasswordForm struct {
+	Token               string `form:"-"`
+	NewPassword         string `form:"newPassword"`
+	ConfirmNewPassword  string `form:"confirmNewPassword"`
+	validator.Validator `form:"-"`
+}
+
+// twoFactorForm serves the second login step and the two-factor page, whose
+// forms ask for a code or, as confirmation, the current password. Action
+// tells the template which of the password forms was posted.
+type twoFactorForm struct {
+	Code                string `form:"code"`
+	Password            string `form:"password"`
+	Action              string `form:"-"`
+	validator.Validator `form:"-"`
+}
+
+type tokenCreateForm struct {
+	Name                string `form:"name"`
+	Scope               string `form:"scope"`
+	validator.Validator `form:"-"`
+}
+
 type userChangePasswordForm struct {
 	CurrentPassword     string `form:"currentPassword"`
 	NewPassword         string `form:"newPassword"`
@@ -42,7 +309,18 @@ type userChangePasswordForm struct {
 }
 
 func (app *application) home(w http.ResponseWriter, r *http.Request) {
-	notes, err := app.notes.Latest()
+	sort, err := app.readSort(r)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	notes, err := app.notes.Latest(sort)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+	err = app.attachTags(notes)
 	if err != nil {
 		app.serverError(w, r, err)
 		return
@@ -50,6 +328,12 @@ func (app *application) home(w http.ResponseWriter, r *http.Request) {
 
 	data := app.newTemplateData(r)
 	data.Notes = notes
+	data.Favorites, err = app.favoritesFor(r, notes)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+	data.Sort = sort
 
 	app.render(w, r, http.StatusOK, "home.tmpl", data)
 }
@@ -64,23 +348,47 @@ func (app *application) listNotes(w http.ResponseWriter, r *http.Request) {
 		app.clientError(w, http.StatusBadRequest)
 		return
 	}
+	sort, err := app.readSort(r)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
 	showPublic := true
-	notes, metaData, err := app.notes.GetByPage(pageInt, 10, &showPublic, nil)
+	tag := app.readTagFilter(r)
+	notes, metaData, err := app.notes.GetByPage(pageInt, 10, nil, models.NotesFilters{ShowPublic: &showPublic, Tag: tag, HideRestricted: true, Sort: sort})
 	if err != nil {
 		app.serverError(w, r, err)
 		return
 	}
 	app.logger.Debug("meta data", slog.Any("metaData", metaData))
+	err = app.attachTags(notes)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
 
 	data := app.newTemplateData(r)
 	data.Notes = notes
+	data.Favorites, err = app.favoritesFor(r, notes)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
 	data.CurrentPage = pageInt
 	data.HasNext = metaData.HasNext
+	data.ActiveTag = tag
+	data.Sort = sort
 	// Don't set NotesFilters for listNotes - this is for public notes only
 	app.render(w, r, http.StatusOK, "list.tmpl", data)
 }
 
 func (app *application) myNotes(w http.ResponseWriter, r *http.Request) {
+	app.renderMyNotes(w, r, http.StatusOK, notebookForm{})
+}
+
+// renderMyNotes lists the authenticated user's notes, narrowed down by the
+// query string, next to the notebooks sidebar whose forms post form.
+func (app *application) renderMyNotes(w http.ResponseWriter, r *http.Request, status int, form notebookForm) {
 	page := r.URL.Query().Get("page")
 	if page == "" {
 		page = "1"
@@ -100,37 +408,91 @@ func (app *application) myNotes(w http.ResponseWriter, r *http.Request) {
 		showPublic = &falseBool
 	} // else leave it nil
 
-	userID := app.sessionManager.GetInt(r.Context(), "authenticatedUserID")
+	notebookID, err := app.readNotebookFilter(r)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+	sort, err := app.readSort(r)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	userID := app.authenticatedUserID(r)
+	filters := models.NotesFilters{
+		ShowPublic:  showPublic, // Pass the original pointer (can be nil, true, or false)
+		Tag:         app.readTagFilter(r),
+		NotebookID:  notebookID,
+		PinnedFirst: true,
+		Sort:        sort,
+	}
 
-	notes, metaData, err := app.notes.GetByPage(pageInt, 10, showPublic, &userID)
+	notes, metaData, err := app.notes.GetByPage(pageInt, 10, &userID, filters)
 	if err != nil {
 		app.serverError(w, r, err)
 		return
 	}
 	app.logger.Debug("meta data", slog.Any("metaData", metaData))
+	err = app.attachTags(notes)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	notebooks, err := app.notebooks.GetAllForUser(userID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
 
 	data := app.newTemplateData(r)
 	data.Notes = notes
+	data.Favorites, err = app.favoritesFor(r, notes)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
 	data.CurrentPage = pageInt
 	data.HasNext = metaData.HasNext
-	data.NotesFilters = &models.NotesFilters{
-		ShowPublic: showPublic, // Pass the original pointer (can be nil, true, or false)
-	}
+	data.NotesFilters = &filters
+	data.ActiveTag = filters.Tag
+	data.Sort = filters.Sort
+	data.Notebooks = notebooks
+	data.Form = form
 
-	app.render(w, r, http.StatusOK, "list.tmpl", data)
+	app.render(w, r, status, "list.tmpl", data)
 }
 
-func (app *application) noteView(w http.ResponseWriter, r *http.Request) {
-	id := r.PathValue("id")
+func (app *application) notebookCreatePost(w http.ResponseWriter, r *http.Request) {
+	var form notebookForm
 
-	err := uuid.Validate(id)
+	err := app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
 
-	if err != nil || id == "" {
-		app.clientError(w, http.StatusNotFound)
+	userID := app.authenticatedUserID(r)
+	notebooks, err := app.notebooks.GetAllForUser(userID)
+	if err != nil {
+		app.serverError(w, r, err)
 		return
 	}
-	userID := app.sessionManager.GetInt(r.Context(), "authenticatedUserID")
-	note, err := app.notes.Get(id, &userID)
+
+	form.CheckField(validator.NotBlank(form.Name), "name", "This field cannot be blank")
+	form.CheckField(validator.MaxChars(form.Name, 100), "name", "This field cannot be more than 100 characters long")
+	if form.ParentID != 0 {
+		i := slices.IndexFunc(notebooks, func(n models.Notebook) bool { return n.ID == form.ParentID })
+		form.CheckField(i >= 0, "parent_id", "This field must be one of your notebooks")
+		form.CheckField(i < 0 || notebooks[i].Depth < maxNotebookDepth-1, "parent_id", fmt.Sprintf("Notebooks cannot be nested more than %d levels deep", maxNotebookDepth))
+	}
+	if !form.Valid() {
+		app.renderMyNotes(w, r, http.StatusUnprocessableEntity, form)
+		return
+	}
+
+	id, err := app.notebooks.Insert(userID, strings.TrimSpace(form.Name), form.ParentID)
 	if err != nil {
 		if errors.Is(err, models.ErrNoRecord) {
 			app.clientError(w, http.StatusNotFound)
@@ -140,94 +502,63 @@ func (app *application) noteView(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	data := app.newTemplateData(r)
-	data.Note = note
-	data.IsUserNote = note.CreatedBy == userID
-
-	app.render(w, r, http.StatusOK, "view.tmpl", data)
-
+	app.sessionManager.Put(r.Context(), "flash", "Notebook created.")
+	http.Redirect(w, r, fmt.Sprintf("/my-notes?notebook=%d", id), http.StatusSeeOther)
 }
 
-func (app *application) noteCreate(w http.ResponseWriter, r *http.Request) {
-	data := app.newTemplateData(r)
-	data.Form = noteUpsertForm{
-		ID:         "",
-		Expires:    365,
-		Visibility: "private",
+func (app *application) notebookDeletePost(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil || id < 1 {
+		app.clientError(w, http.StatusNotFound)
+		return
 	}
-	app.render(w, r, http.StatusOK, "create.tmpl", data)
+
+	err = app.notebooks.Delete(id, app.authenticatedUserID(r))
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.clientError(w, http.StatusNotFound)
+			return
+		}
+		app.serverError(w, r, err)
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", "Notebook deleted. Its notes and notebooks moved up a level.")
+	http.Redirect(w, r, "/my-notes", http.StatusSeeOther)
 }
 
-func (app *application) noteCreatePost(w http.ResponseWriter, r *http.Request) {
-	var form noteUpsertForm
+// notebookMovePost files the notes selected on /my-notes in a notebook, or
+// takes them out of any notebook.
+func (app *application) notebookMovePost(w http.ResponseWriter, r *http.Request) {
+	var form notebookForm
 
 	err := app.decodePostForm(r, &form)
 	if err != nil {
 		app.clientError(w, http.StatusBadRequest)
 		return
 	}
-
-	form.CheckField(validator.NotBlank(form.Title), "title", "This field cannot be blank")
-	form.CheckField(validator.MaxChars(form.Title, 100), "title", "This field cannot be more than 100 characters long")
-	form.CheckField(validator.NotBlank(form.Content), "content", "This field cannot be blank")
-	form.CheckField(validator.PermittedValue(form.Expires, 1, 7, 365), "expires", "This field must equal 1, 7 or 365")
-	form.CheckField(validator.PermittedValue(form.Visibility, "public", "private"), "visibility", "This field must equal public or private")
-	if !form.Valid() {
-		data := app.newTemplateData(r)
-		data.Form = form
-		app.render(w, r, http.StatusUnprocessableEntity, "create.tmpl", data)
-		return
-	}
-
-	userID := app.sessionManager.GetInt(r.Context(), "authenticatedUserID")
-	noteID := form.ID
-	isEditForm := form.ID != ""
-	if isEditForm {
-		err = uuid.Validate(noteID)
-		if err != nil {
-			app.clientError(w, http.StatusNotFound)
+	for _, id := range form.NoteIDs {
+		if uuid.Validate(id) != nil {
+			app.clientError(w, http.StatusBadRequest)
 			return
 		}
 	}
 
-	var id string
-	if isEditForm {
-		id, err = app.notes.Update(form.ID, form.Title, form.Content, form.Expires, form.Visibility == "public", userID)
-		if err != nil {
-			if errors.Is(err, models.ErrNoRecord) {
-				app.clientError(w, http.StatusNotFound)
-				return
-			}
-			app.serverError(w, r, err)
-			return
-		}
-	} else {
-		id, err = app.notes.Insert(form.Title, form.Content, form.Expires, form.Visibility == "public", userID)
-		if err != nil {
-			app.serverError(w, r, err)
-			return
-		}
-	}
-	flashMessage := "Note successfully created!"
-	if isEditForm {
-		flashMessage = "Note successfully updated!"
+	userID := app.authenticatedUserID(r)
+	notebooks, err := app.notebooks.GetAllForUser(userID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
 	}
-	app.sessionManager.Put(r.Context(), "flash", flashMessage)
 
-	// Redirect the user to the relevant page for the note.
-	http.Redirect(w, r, fmt.Sprintf("/note/view/%v", id), http.StatusSeeOther)
-}
-
-func (app *application) noteEdit(w http.ResponseWriter, r *http.Request) {
-	id := r.PathValue("id")
-	err := uuid.Validate(id)
-	if err != nil || id == "" {
-		app.clientError(w, http.StatusNotFound)
+	form.CheckField(len(form.NoteIDs) > 0, "note_id", "Select the notes to move")
+	form.CheckField(form.NotebookID == 0 || hasNotebook(notebooks, form.NotebookID), "notebook_id", "This field must be one of your notebooks")
+	if !form.Valid() {
+		app.renderMyNotes(w, r, http.StatusUnprocessableEntity, form)
 		return
 	}
 
-	userID := app.sessionManager.GetInt(r.Context(), "authenticatedUserID")
-	note, err := app.notes.Get(id, &userID)
+	moved, err := app.notebooks.MoveNotes(form.NoteIDs, form.NotebookID, userID)
 	if err != nil {
 		if errors.Is(err, models.ErrNoRecord) {
 			app.clientError(w, http.StatusNotFound)
@@ -236,42 +567,1185 @@ func (app *application) noteEdit(w http.ResponseWriter, r *http.Request) {
 		app.serverError(w, r, err)
 		return
 	}
-	// expires is days between note.Created and note.Expires
-	expires := int(note.Expires.Sub(note.Created).Hours() / 24)
-	visibility := "private"
-	if note.Public {
-		visibility = "public"
+
+	flash := fmt.Sprintf("Moved %d notes.", moved)
+	if moved == 1 {
+		flash = "Moved 1 note."
 	}
-	data := app.newTemplateData(r)
-	data.Form = noteUpsertForm{
-		ID:         note.ID,
-		Title:      note.Title,
-		Content:    note.Content,
-		Expires:    expires,
-		Visibility: visibility,
+	app.sessionManager.Put(r.Context(), "flash", flash)
+	if form.NotebookID == 0 {
+		http.Redirect(w, r, "/my-notes", http.StatusSeeOther)
+		return
 	}
-	app.render(w, r, http.StatusOK, "create.tmpl", data)
+	http.Redirect(w, r, fmt.Sprintf("/my-notes?notebook=%d", form.NotebookID), http.StatusSeeOther)
 }
 
-func (app *application) noteDeletePost(w http.ResponseWriter, r *http.Request) {
-	id := r.PathValue("id")
-	err := uuid.Validate(id)
+// sharedWithMe lists the notes other users have shared with the authenticated
+// user, whatever their visibility.
+func (app *application) sharedWithMe(w http.ResponseWriter, r *http.Request) {
+	page, err := app.readPage(r)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
 
-	if err != nil || id == "" {
-		app.clientError(w, http.StatusNotFound)
+	sort, err := app.readSort(r)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
 		return
 	}
 
-	userID := app.sessionManager.GetInt(r.Context(), "authenticatedUserID")
-	err = app.notes.Delete(id, &userID)
+	filters := models.NotesFilters{
+		Tag:            app.readTagFilter(r),
+		SharedWith:     app.authenticatedUserID(r),
+		HideRestricted: true,
+		Sort:           sort,
+	}
+
+	notes, metaData, err := app.notes.GetByPage(page, 10, nil, filters)
 	if err != nil {
 		app.serverError(w, r, err)
 		return
 	}
-	app.sessionManager.Put(r.Context(), "flash", "Note successfully deleted!")
-	http.Redirect(w, r, "/my-notes", http.StatusSeeOther)
-}
-
+	err = app.attachTags(notes)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.Notes = notes
+	data.Favorites, err = app.favoritesFor(r, notes)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+	data.CurrentPage = page
+	data.HasNext = metaData.HasNext
+	data.ActiveTag = filters.Tag
+	data.Sort = filters.Sort
+
+	app.render(w, r, http.StatusOK, "shared.tmpl", data)
+}
+
+func (app *application) search(w http.ResponseWriter, r *http.Request) {
+	query := strings.TrimSpace(r.URL.Query().Get("q"))
+	pageInt, err := app.readPage(r)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.SearchQuery = query
+	data.CurrentPage = pageInt
+
+	if query == "" || !validator.MaxChars(query, 100) {
+		app.render(w, r, http.StatusOK, "search.tmpl", data)
+		return
+	}
+
+	var userID *int
+	if app.isAuthenticated(r) {
+		id := app.authenticatedUserID(r)
+		userID = &id
+	}
+
+	notes, metaData, err := app.notes.Search(query, pageInt, 10, userID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+	err = app.attachTags(notes)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	data.Notes = notes
+	data.HasNext = metaData.HasNext
+
+	app.render(w, r, http.StatusOK, "search.tmpl", data)
+}
+
+func (app *application) noteView(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+
+	err := uuid.Validate(id)
+
+	if err != nil || id == "" {
+		app.clientError(w, http.StatusNotFound)
+		return
+	}
+	userID := app.authenticatedUserID(r)
+	note, err := app.notes.GetForUnlock(id, &userID)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.clientError(w, http.StatusNotFound)
+			return
+		}
+		app.serverError(w, r, err)
+		return
+	}
+
+	unlocked, err := app.noteUnlocked(r, note, userID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+	if !unlocked {
+		app.renderNoteUnlock(w, r, http.StatusOK, note, noteUnlockForm{})
+		return
+	}
+
+	// Burn-after-reading notes are only opened by the POST from the
+	// interstitial, so link previews and crawlers fetching the URL don't
+	// delete them.
+	if note.BurnAfterReading && note.CreatedBy != userID {
+		w.Header().Set("Cache-Control", "no-store")
+		data := app.newTemplateData(r)
+		data.Note = models.NoteWithUsername{Note: models.Note{ID: note.ID}, Username: note.Username}
+		app.render(w, r, http.StatusOK, "burn.tmpl", data)
+		return
+	}
+
+	app.renderNoteView(w, r, http.StatusOK, note, app.newTemplateData(r))
+}
+
+// noteBurnPost shows a burn-after-reading note to someone other than its
+// owner, deleting it on the way.
+func (app *application) noteBurnPost(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if err := uuid.Validate(id); err != nil {
+		app.clientError(w, http.StatusNotFound)
+		return
+	}
+
+	userID := app.authenticatedUserID(r)
+	note, err := app.notes.GetForUnlock(id, &userID)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.clientError(w, http.StatusNotFound)
+			return
+		}
+		app.serverError(w, r, err)
+		return
+	}
+	unlocked, err := app.noteUnlocked(r, note, userID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+	if !unlocked {
+		http.Redirect(w, r, fmt.Sprintf("/note/view/%s", id), http.StatusSeeOther)
+		return
+	}
+
+	note, err = app.notes.Burn(id, &userID, unlocked)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.clientError(w, http.StatusNotFound)
+			return
+		}
+		app.serverError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	data := app.newTemplateData(r)
+	data.Burned = true
+	app.renderNoteView(w, r, http.StatusOK, note, data)
+}
+
+// renderNoteUnlock renders the password prompt of a protected note, which
+// only reveals who wrote it.
+func (app *application) renderNoteUnlock(w http.ResponseWriter, r *http.Request, status int, note models.NoteWithUsername, form noteUnlockForm) {
+	w.Header().Set("Cache-Control", "no-store")
+	data := app.newTemplateData(r)
+	data.Note = models.NoteWithUsername{Note: models.Note{ID: note.ID}, Username: note.Username}
+	data.Form = form
+	app.render(w, r, status, "unlock.tmpl", data)
+}
+
+func (app *application) noteUnlockPost(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if err := uuid.Validate(id); err != nil {
+		app.clientError(w, http.StatusNotFound)
+		return
+	}
+
+	userID := app.authenticatedUserID(r)
+	note, err := app.notes.GetForUnlock(id, &userID)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.clientError(w, http.StatusNotFound)
+			return
+		}
+		app.serverError(w, r, err)
+		return
+	}
+
+	var form noteUnlockForm
+
+	err = app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	form.CheckField(validator.NotBlank(form.Password), "password", "This field cannot be blank")
+	if !form.Valid() {
+		app.renderNoteUnlock(w, r, http.StatusUnprocessableEntity, note, form)
+		return
+	}
+
+	// Wrong guesses are counted per note rather than per client, so spreading
+	// them over many addresses doesn't help.
+	if !app.notePasswordLimiter.Allow(note.ID) {
+		form.AddNonFieldError("Too many wrong passwords have been tried for this note. Please try again later.")
+		app.renderNoteUnlock(w, r, http.StatusTooManyRequests, note, form)
+		return
+	}
+
+	err = app.notes.CheckPassword(note.ID, form.Password)
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrInvalidCredentials):
+			app.notePasswordLimiter.Fail(note.ID)
+			form.AddFieldError("password", "Incorrect password")
+			app.renderNoteUnlock(w, r, http.StatusUnprocessableEntity, note, form)
+		case errors.Is(err, models.ErrNoRecord):
+			app.clientError(w, http.StatusNotFound)
+		default:
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	app.notePasswordLimiter.Reset(note.ID)
+	app.sessionManager.Put(r.Context(), unlockedNoteKey(note.ID), true)
+	http.Redirect(w, r, fmt.Sprintf("/note/view/%s", note.ID), http.StatusSeeOther)
+}
+
+// renderNoteView fills in the note's tags and, for its owner, its share links
+// and renders the note page. Besides noteView it serves share links, and the
+// share link form when it has to be re-displayed with its errors.
+func (app *application) renderNoteView(w http.ResponseWriter, r *http.Request, status int, note models.NoteWithUsername, data templateData) {
+	err := app.attachNoteTags(&note)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	userID := app.authenticatedUserID(r)
+	data.Note = note
+	data.IsUserNote = note.CreatedBy == userID
+	data.CanEdit, err = app.canEdit(note, userID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+	if userID != 0 {
+		favorites, err := app.favorites.GetForNotes(userID, note.ID)
+		if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+		data.IsFavorite = favorites[note.ID]
+	}
+	if data.IsUserNote {
+		data.ShareLinks, err = app.shareLinks.GetAllForNote(note.ID)
+		if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+		data.NoteShares, err = app.noteShares.GetAllForNote(note.ID)
+		if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+		data.NewShareLink = app.sessionManager.PopString(r.Context(), "newShareLink")
+	}
+	if data.Form == nil {
+		data.Form = noteViewForm{Permission: models.PermissionView}
+	}
+
+	app.render(w, r, status, "view.tmpl", data)
+}
+
+func (app *application) noteCreate(w http.ResponseWriter, r *http.Request) {
+	notebooks, err := app.notebooks.GetAllForUser(app.authenticatedUserID(r))
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.Notebooks = notebooks
+	data.Form = noteUpsertForm{
+		ID:         "",
+		Format:     models.FormatPlain,
+		Lifetime:   "365",
+		Visibility: "private",
+	}
+	app.render(w, r, http.StatusOK, "create.tmpl", data)
+}
+
+func (app *application) noteCreatePost(w http.ResponseWriter, r *http.Request) {
+	var form noteUpsertForm
+
+	err := app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	userID := app.authenticatedUserID(r)
+	notebooks, err := app.notebooks.GetAllForUser(userID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+	form.validate()
+	form.validateNotebook(notebooks)
+	if form.Visibility == "public" {
+		canPublish, err := app.canPublish(userID, form.ID)
+		if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+		form.validatePublishing(canPublish)
+	}
+	if !form.Valid() {
+		data := app.newTemplateData(r)
+		data.Form = form
+		data.Notebooks = notebooks
+		if form.ID != "" && uuid.Validate(form.ID) == nil {
+			// Collaborators don't get the owner-only expiry and visibility
+			// fields, so the page needs to know whose note this is.
+			note, err := app.notes.Get(form.ID, &userID)
+			if err == nil {
+				data.IsUserNote = note.CreatedBy == userID
+			} else if !errors.Is(err, models.ErrNoRecord) {
+				app.serverError(w, r, err)
+				return
+			}
+		}
+		app.render(w, r, http.StatusUnprocessableEntity, "create.tmpl", data)
+		return
+	}
+
+	noteID := form.ID
+	isEditForm := form.ID != ""
+	if isEditForm {
+		err = uuid.Validate(noteID)
+		if err != nil {
+			app.clientError(w, http.StatusNotFound)
+			return
+		}
+	}
+
+	var id string
+	if isEditForm {
+		if form.Lifetime == "keep" {
+			note, err := app.notes.Get(form.ID, &userID)
+			if err != nil {
+				if errors.Is(err, models.ErrNoRecord) {
+					app.clientError(w, http.StatusNotFound)
+					return
+				}
+				app.serverError(w, r, err)
+				return
+			}
+			form.expires = note.Expires
+		}
+		id, err = app.notes.Update(form.ID, form.Version, form.Title, form.Content, form.Format, form.Language, form.expires, form.Visibility == "public", userID)
+		if err != nil {
+			if errors.Is(err, models.ErrNoRecord) {
+				app.clientError(w, http.StatusNotFound)
+				return
+			}
+			if errors.Is(err, models.ErrEditConflict) {
+				app.renderEditConflict(w, r, form, userID)
+				return
+			}
+			app.serverError(w, r, err)
+			return
+		}
+	} else {
+		id, err = app.notes.Insert(form.Title, form.Content, form.Format, form.Language, form.expires, form.Visibility == "public", form.BurnAfterReading, form.Password, userID)
+		if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+	}
+	err = app.tags.SetForNote(id, form.Tags)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+	// Only the owner's notebooks hold the note: this leaves it where it is
+	// when someone it is shared with saves it.
+	_, err = app.notebooks.MoveNotes([]string{id}, form.NotebookID, userID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+	flashMessage := "Note successfully created!"
+	if isEditForm {
+		flashMessage = "Note successfully updated!"
+	}
+	app.sessionManager.Put(r.Context(), "flash", flashMessage)
+
+	// Redirect the user to the relevant page for the note.
+	http.Redirect(w, r, fmt.Sprintf("/note/view/%v", id), http.StatusSeeOther)
+}
+
+func (app *application) noteEdit(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	err := uuid.Validate(id)
+	if err != nil || id == "" {
+		app.clientError(w, http.StatusNotFound)
+		return
+	}
+
+	userID := app.authenticatedUserID(r)
+	note, err := app.notes.Get(id, &userID)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.clientError(w, http.StatusNotFound)
+			return
+		}
+		app.serverError(w, r, err)
+		return
+	}
+	canEdit, err := app.canEdit(note, userID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+	if !canEdit {
+		app.clientError(w, http.StatusNotFound)
+		return
+	}
+	err = app.attachNoteTags(&note)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+	visibility := "private"
+	if note.Public {
+		visibility = "public"
+	}
+	form := noteUpsertForm{
+		ID:         note.ID,
+		Version:    note.Version,
+		Title:      note.Title,
+		Content:    note.Content,
+		Format:     note.Format,
+		Language:   note.Language,
+		Visibility: visibility,
+		Tags:       note.Tags,
+		NotebookID: note.NotebookID,
+	}
+	// The note keeps its expiry to the second unless the owner picks another
+	// one. The date field starts from it in case they do.
+	form.Lifetime = "keep"
+	if !note.Expires.IsZero() {
+		form.ExpiresAt = note.Expires.UTC().Format(expiryDateLayout)
+	}
+	notebooks, err := app.notebooks.GetAllForUser(userID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+	data := app.newTemplateData(r)
+	data.IsUserNote = note.CreatedBy == userID
+	data.Notebooks = notebooks
+	data.Form = form
+	app.render(w, r, http.StatusOK, "create.tmpl", data)
+}
+
+// renderEditConflict shows the edit page again when the note was changed
+// while form was being filled in. The page shows the saved version and how
+// the submitted one differs from it, and the editor holds a draft merging
+// both, based on the saved version so it can be submitted once resolved.
+func (app *application) renderEditConflict(w http.ResponseWriter, r *http.Request, form noteUpsertForm, userID int) {
+	note, err := app.notes.Get(form.ID, &userID)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.clientError(w, http.StatusNotFound)
+			return
+		}
+		app.serverError(w, r, err)
+		return
+	}
+
+	notebooks, err := app.notebooks.GetAllForUser(userID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	form.Version = note.Version
+	form.Submitted = form.Content
+	form.Content = diff.Merge(note.Content, form.Content, "saved version", "your version")
+
+	data := app.newTemplateData(r)
+	data.Note = note
+	data.IsUserNote = note.CreatedBy == userID
+	data.Conflict = true
+	data.Notebooks = notebooks
+	data.Diff = diff.Lines(note.Content, form.Submitted)
+	data.Form = form
+	app.render(w, r, http.StatusConflict, "create.tmpl", data)
+}
+
+// notePreviewPost renders the content of the note form the same way noteView
+// will, for the preview tab of the create and edit pages.
+func (app *application) notePreviewPost(w http.ResponseWriter, r *http.Request) {
+	var form noteUpsertForm
+
+	err := app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	form.validateFormat()
+	if !form.Valid() {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	note := models.Note{Content: form.Content, Format: form.Format, Language: form.Language}
+	app.renderFragment(w, r, http.StatusOK, "create.tmpl", "note-content", note)
+}
+
+func (app *application) noteDeletePost(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	err := uuid.Validate(id)
+
+	if err != nil || id == "" {
+		app.clientError(w, http.StatusNotFound)
+		return
+	}
+
+	userID := app.authenticatedUserID(r)
+	err = app.notes.Delete(id, &userID)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.clientError(w, http.StatusNotFound)
+			return
+		}
+		app.serverError(w, r, err)
+		return
+	}
+	app.sessionManager.Put(r.Context(), "flash", "Note moved to the trash.")
+	http.Redirect(w, r, "/my-notes", http.StatusSeeOther)
+}
+
+func (app *application) trash(w http.ResponseWriter, r *http.Request) {
+	page, err := app.readPage(r)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	notes, metaData, err := app.notes.GetTrash(page, 10, app.authenticatedUserID(r))
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.Notes = notes
+	data.CurrentPage = page
+	data.HasNext = metaData.HasNext
+	data.TrashRetention = app.config.trashRetention
+
+	app.render(w, r, http.StatusOK, "trash.tmpl", data)
+}
+
+func (app *application) trashRestorePost(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if err := uuid.Validate(id); err != nil {
+		app.clientError(w, http.StatusNotFound)
+		return
+	}
+
+	err := app.notes.Restore(id, app.authenticatedUserID(r))
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.clientError(w, http.StatusNotFound)
+			return
+		}
+		app.serverError(w, r, err)
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", "Note successfully restored!")
+	http.Redirect(w, r, fmt.Sprintf("/note/view/%v", id), http.StatusSeeOther)
+}
+
+func (app *application) trashDeletePost(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if err := uuid.Validate(id); err != nil {
+		app.clientError(w, http.StatusNotFound)
+		return
+	}
+
+	err := app.notes.DeletePermanently(id, app.authenticatedUserID(r))
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.clientError(w, http.StatusNotFound)
+			return
+		}
+		app.serverError(w, r, err)
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", "Note permanently deleted!")
+	http.Redirect(w, r, "/trash", http.StatusSeeOther)
+}
+
+// ownedNote loads the note named by the {id} path value for the
+// authenticated user. It responds with 404 Not Found, and returns false, when
+// the note doesn't exist or belongs to somebody else.
+func (app *application) ownedNote(w http.ResponseWriter, r *http.Request) (models.NoteWithUsername, bool) {
+	id := r.PathValue("id")
+	err := uuid.Validate(id)
+	if err != nil || id == "" {
+		app.clientError(w, http.StatusNotFound)
+		return models.NoteWithUsername{}, false
+	}
+
+	userID := app.authenticatedUserID(r)
+	note, err := app.notes.Get(id, &userID)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.clientError(w, http.StatusNotFound)
+			return models.NoteWithUsername{}, false
+		}
+		app.serverError(w, r, err)
+		return models.NoteWithUsername{}, false
+	}
+
+	if note.CreatedBy != userID {
+		app.clientError(w, http.StatusNotFound)
+		return models.NoteWithUsername{}, false
+	}
+	return note, true
+}
+
+func (app *application) notePinPost(w http.ResponseWriter, r *http.Request) {
+	app.setNotePinned(w, r, true)
+}
+
+func (app *application) notePinRemovePost(w http.ResponseWriter, r *http.Request) {
+	app.setNotePinned(w, r, false)
+}
+
+// setNotePinned pins the authenticated user's note to the top of /my-notes,
+// or unpins it.
+func (app *application) setNotePinned(w http.ResponseWriter, r *http.Request, pinned bool) {
+	note, ok := app.ownedNote(w, r)
+	if !ok {
+		return
+	}
+
+	err := app.notes.SetPinned(note.ID, pinned, app.authenticatedUserID(r))
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.clientError(w, http.StatusNotFound)
+			return
+		}
+		app.serverError(w, r, err)
+		return
+	}
+
+	flash := "Note pinned to the top of My Notes."
+	if !pinned {
+		flash = "Note unpinned."
+	}
+	app.sessionManager.Put(r.Context(), "flash", flash)
+	http.Redirect(w, r, fmt.Sprintf("/note/view/%s", note.ID), http.StatusSeeOther)
+}
+
+// noteFavoritePost stars any note the authenticated user can see.
+func (app *application) noteFavoritePost(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	err := uuid.Validate(id)
+	if err != nil || id == "" {
+		app.clientError(w, http.StatusNotFound)
+		return
+	}
+
+	userID := app.authenticatedUserID(r)
+	_, err = app.notes.Get(id, &userID)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.clientError(w, http.StatusNotFound)
+			return
+		}
+		app.serverError(w, r, err)
+		return
+	}
+
+	err = app.favorites.Add(userID, id)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", "Note added to your favorites.")
+	http.Redirect(w, r, fmt.Sprintf("/note/view/%s", id), http.StatusSeeOther)
+}
+
+// noteFavoriteRemovePost unstars a note. It works whether or not the user
+// can still see the note.
+func (app *application) noteFavoriteRemovePost(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	err := uuid.Validate(id)
+	if err != nil || id == "" {
+		app.clientError(w, http.StatusNotFound)
+		return
+	}
+
+	err = app.favorites.Remove(app.authenticatedUserID(r), id)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", "Note removed from your favorites.")
+	http.Redirect(w, r, fmt.Sprintf("/note/view/%s", id), http.StatusSeeOther)
+}
+
+// favoriteNotes lists the notes the authenticated user has starred and can
+// still see.
+func (app *application) favoriteNotes(w http.ResponseWriter, r *http.Request) {
+	page, err := app.readPage(r)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	sort, err := app.readSort(r)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	filters := models.NotesFilters{
+		Tag:         app.readTagFilter(r),
+		FavoritedBy: app.authenticatedUserID(r),
+		Sort:        sort,
+	}
+
+	notes, metaData, err := app.notes.GetByPage(page, 10, nil, filters)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+	err = app.attachTags(notes)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.Notes = notes
+	data.Favorites, err = app.favoritesFor(r, notes)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+	data.CurrentPage = page
+	data.HasNext = metaData.HasNext
+	data.ActiveTag = filters.Tag
+	data.Sort = filters.Sort
+
+	app.render(w, r, http.StatusOK, "favorites.tmpl", data)
+}
+
+// noteExtendPost pushes back a note's expiry, or stops it from expiring,
+// without editing it.
+func (app *application) noteExtendPost(w http.ResponseWriter, r *http.Request) {
+	note, ok := app.ownedNote(w, r)
+	if !ok {
+		return
+	}
+
+	var form noteViewForm
+
+	err := app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	form.CheckField(!note.Expires.IsZero(), "extend_by", "This note never expires")
+	form.CheckField(validator.PermittedValue(form.ExtendBy, "1d", "7d", "30d", "365d", "never"), "extend_by", "This field must equal 1d, 7d, 30d, 365d or never")
+
+	var expires time.Time
+	if form.Valid() && form.ExtendBy != "never" {
+		extendBy, err := parseLifetime(form.ExtendBy)
+		if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+		expires = note.Expires.Add(extendBy)
+		form.CheckField(expires.Before(time.Now().AddDate(0, 0, maxLifetimeDays)), "extend_by", fmt.Sprintf("Notes can't expire more than %d days from now", maxLifetimeDays))
+	}
+
+	if !form.Valid() {
+		data := app.newTemplateData(r)
+		data.Form = form
+		app.renderNoteView(w, r, http.StatusUnprocessableEntity, note, data)
+		return
+	}
+
+	err = app.notes.SetExpiry(note.ID, expires, note.CreatedBy)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.clientError(w, http.StatusNotFound)
+			return
+		}
+		app.serverError(w, r, err)
+		return
+	}
+
+	flash := "Note will now expire on " + humanDate(expires) + "."
+	if expires.IsZero() {
+		flash = "Note will never expire."
+	}
+	app.sessionManager.Put(r.Context(), "flash", flash)
+	http.Redirect(w, r, fmt.Sprintf("/note/view/%s", note.ID), http.StatusSeeOther)
+}
+
+func (app *application) shareLinkCreatePost(w http.ResponseWriter, r *http.Request) {
+	note, ok := app.ownedNote(w, r)
+	if !ok {
+		return
+	}
+	// The note's own URL already is a one-time link.
+	if note.BurnAfterReading {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	var form noteViewForm
+
+	err := app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	form.CheckField(validator.PermittedValue(form.ExpiresIn, 0, 1, 7, 30), "expires_in", "This field must equal 0, 1, 7 or 30")
+	form.CheckField(form.MaxViews >= 0 && form.MaxViews <= 1000, "max_views", "This field must be between 0 and 1000")
+
+	if !form.Valid() {
+		data := app.newTemplateData(r)
+		data.Form = form
+		app.renderNoteView(w, r, http.StatusUnprocessableEntity, note, data)
+		return
+	}
+
+	var expires time.Time
+	if form.ExpiresIn > 0 {
+		expires = time.Now().AddDate(0, 0, form.ExpiresIn)
+	}
+	token, err := app.shareLinks.Insert(note.ID, expires, form.MaxViews)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	// Only the token's hash is stored, so this is the only time the link can
+	// be shown.
+	app.sessionManager.Put(r.Context(), "newShareLink", app.shareURL(token))
+	app.sessionManager.Put(r.Context(), "flash", "Share link created. Copy it now, you won't be able to see it again!")
+	http.Redirect(w, r, fmt.Sprintf("/note/view/%s", note.ID), http.StatusSeeOther)
+}
+
+func (app *application) shareLinkRevokePost(w http.ResponseWriter, r *http.Request) {
+	note, ok := app.ownedNote(w, r)
+	if !ok {
+		return
+	}
+
+	linkID, err := strconv.Atoi(r.PathValue("linkID"))
+	if err != nil || linkID < 1 {
+		app.clientError(w, http.StatusNotFound)
+		return
+	}
+
+	err = app.shareLinks.Delete(linkID, note.ID)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.clientError(w, http.StatusNotFound)
+			return
+		}
+		app.serverError(w, r, err)
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", "Share link revoked.")
+	http.Redirect(w, r, fmt.Sprintf("/note/view/%s", note.ID), http.StatusSeeOther)
+}
+
+func (app *application) noteShareGrantPost(w http.ResponseWriter, r *http.Request) {
+	note, ok := app.ownedNote(w, r)
+	if !ok {
+		return
+	}
+
+	var form noteViewForm
+
+	err := app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	form.Email = strings.TrimSpace(form.Email)
+	form.CheckField(validator.NotBlank(form.Email), "email", "This field cannot be blank")
+	form.CheckField(validator.IsEmail(form.Email), "email", "This field must be a valid email address")
+	form.CheckField(validator.PermittedValue(form.Permission, models.PermissionView, models.PermissionEdit), "permission", "This field must equal view or edit")
+
+	var user models.User
+	if form.Valid() {
+		user, err = app.users.GetByEmail(form.Email)
+		if err != nil {
+			if !errors.Is(err, models.ErrNoRecord) {
+				app.serverError(w, r, err)
+				return
+			}
+			form.AddFieldError("email", "No user has this email address")
+		} else if user.ID == note.CreatedBy {
+			form.AddFieldError("email", "You already own this note")
+		}
+	}
+
+	if !form.Valid() {
+		data := app.newTemplateData(r)
+		data.Form = form
+		app.renderNoteView(w, r, http.StatusUnprocessableEntity, note, data)
+		return
+	}
+
+	err = app.noteShares.Grant(note.ID, user.ID, form.Permission)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", fmt.Sprintf("Note shared with %s.", user.Name))
+	http.Redirect(w, r, fmt.Sprintf("/note/view/%s", note.ID), http.StatusSeeOther)
+}
+
+func (app *application) noteShareRevokePost(w http.ResponseWriter, r *http.Request) {
+	note, ok := app.ownedNote(w, r)
+	if !ok {
+		return
+	}
+
+	userID, err := strconv.Atoi(r.PathValue("userID"))
+	if err != nil || userID < 1 {
+		app.clientError(w, http.StatusNotFound)
+		return
+	}
+
+	err = app.noteShares.Revoke(note.ID, userID)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.clientError(w, http.StatusNotFound)
+			return
+		}
+		app.serverError(w, r, err)
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", "Note is no longer shared with that user.")
+	http.Redirect(w, r, fmt.Sprintf("/note/view/%s", note.ID), http.StatusSeeOther)
+}
+
+func (app *application) notePasswordPost(w http.ResponseWriter, r *http.Request) {
+	note, ok := app.ownedNote(w, r)
+	if !ok {
+		return
+	}
+
+	var form noteViewForm
+
+	err := app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	form.CheckField(validator.MinChars(form.Password, 8), "password", "This field must be at least 8 characters long")
+
+	if !form.Valid() {
+		form.Password = ""
+		data := app.newTemplateData(r)
+		data.Form = form
+		app.renderNoteView(w, r, http.StatusUnprocessableEntity, note, data)
+		return
+	}
+
+	err = app.notes.SetPassword(note.ID, form.Password, note.CreatedBy)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.clientError(w, http.StatusNotFound)
+			return
+		}
+		app.serverError(w, r, err)
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", "Note password set.")
+	http.Redirect(w, r, fmt.Sprintf("/note/view/%s", note.ID), http.StatusSeeOther)
+}
+
+func (app *application) notePasswordRemovePost(w http.ResponseWriter, r *http.Request) {
+	note, ok := app.ownedNote(w, r)
+	if !ok {
+		return
+	}
+
+	err := app.notes.SetPassword(note.ID, "", note.CreatedBy)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.clientError(w, http.StatusNotFound)
+			return
+		}
+		app.serverError(w, r, err)
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", "Note password removed.")
+	http.Redirect(w, r, fmt.Sprintf("/note/view/%s", note.ID), http.StatusSeeOther)
+}
+
+// shareLinkView shows the note behind a share link to anyone holding it,
+// logged in or not.
+func (app *application) shareLinkView(w http.ResponseWriter, r *http.Request) {
+	note, err := app.shareLinks.Open(r.PathValue("token"))
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.clientError(w, http.StatusNotFound)
+			return
+		}
+		app.serverError(w, r, err)
+		return
+	}
+
+	// The page is meant for whoever holds the link, so keep it out of shared
+	// caches.
+	w.Header().Set("Cache-Control", "no-store")
+	app.renderNoteView(w, r, http.StatusOK, note, app.newTemplateData(r))
+}
+
+func (app *application) noteHistory(w http.ResponseWriter, r *http.Request) {
+	note, ok := app.ownedNote(w, r)
+	if !ok {
+		return
+	}
+
+	revisions, err := app.revisions.GetAllForNote(note.ID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.Note = note
+	data.Revisions = revisions
+	data.IsUserNote = true
+
+	app.render(w, r, http.StatusOK, "history.tmpl", data)
+}
+
+func (app *application) noteDiff(w http.ResponseWriter, r *http.Request) {
+	note, ok := app.ownedNote(w, r)
+	if !ok {
+		return
+	}
+
+	fromID, err := strconv.Atoi(r.URL.Query().Get("from"))
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+	toID, err := strconv.Atoi(r.URL.Query().Get("to"))
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	from, err := app.revisions.Get(note.ID, fromID)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.clientError(w, http.StatusNotFound)
+			return
+		}
+		app.serverError(w, r, err)
+		return
+	}
+	to, err := app.revisions.Get(note.ID, toID)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.clientError(w, http.StatusNotFound)
+			return
+		}
+		app.serverError(w, r, err)
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.Note = note
+	data.FromRevision = from
+	data.ToRevision = to
+	data.Diff = diff.Lines(from.Content, to.Content)
+	data.IsUserNote = true
+
+	app.render(w, r, http.StatusOK, "diff.tmpl", data)
+}
+
+func (app *application) noteRestorePost(w http.ResponseWriter, r *http.Request) {
+	note, ok := app.ownedNote(w, r)
+	if !ok {
+		return
+	}
+
+	err := r.ParseForm()
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+	revisionID, err := strconv.Atoi(r.PostForm.Get("revision_id"))
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	err = app.revisions.Restore(note.ID, revisionID, app.authenticatedUserID(r))
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.clientError(w, http.StatusNotFound)
+			return
+		}
+		app.serverError(w, r, err)
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", "Revision successfully restored!")
+	http.Redirect(w, r, fmt.Sprintf("/note/view/%v", note.ID), http.StatusSeeOther)
+}
+
 // Display a form for signing up a new user
 func (app *application) userSignup(w http.ResponseWriter, r *http.Request) {
 	data := app.newTemplateData(r)
@@ -303,7 +1777,7 @@ func (app *application) userSignupPost(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	_, err = app.users.Insert(form.Name, form.Email, form.Password)
+	id, err := app.users.Insert(form.Name, form.Email, form.Password)
 	if err != nil {
 		if errors.Is(err, models.ErrDuplicateEmail) {
 			form.AddFieldError("email", "Email address is already in use")
@@ -316,7 +1790,177 @@ func (app *application) userSignupPost(w http.ResponseWriter, r *http.Request) {
 		}
 		return
 	}
-	app.sessionManager.Put(r.Context(), "flash", "Your signup was successful. Please log in.")
+	app.sendVerificationEmail(models.User{ID: id, Name: form.Name, Email: form.Email})
+
+	app.sessionManager.Put(r.Context(), "flash", "Your signup was successful. Check your email to verify your address, then log in.")
+	http.Redirect(w, r, "/user/login", http.StatusSeeOther)
+}
+
+// userVerifyEmail marks the address a verification link was sent to as
+// verified.
+func (app *application) userVerifyEmail(w http.ResponseWriter, r *http.Request) {
+	redirectURL := "/user/login"
+	if app.isAuthenticated(r) {
+		redirectURL = "/account/view"
+	}
+
+	fields, err := app.signer.Verify(purposeVerifyEmail, r.PathValue("token"), time.Now())
+	if err == nil && len(fields) != 2 {
+		err = errInvalidToken
+	}
+	var id int
+	if err == nil {
+		id, err = strconv.Atoi(fields[0])
+	}
+	if err == nil {
+		err = app.users.VerifyEmail(id, fields[1])
+		if err != nil && !errors.Is(err, models.ErrNoRecord) {
+			app.serverError(w, r, err)
+			return
+		}
+	}
+	if err != nil {
+		app.sessionManager.Put(r.Context(), "flash", "This verification link is invalid or has expired.")
+		http.Redirect(w, r, redirectURL, http.StatusSeeOther)
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", "Your email address has been verified.")
+	http.Redirect(w, r, redirectURL, http.StatusSeeOther)
+}
+
+// accountVerifyPost sends the authenticated user a new verification email.
+func (app *application) accountVerifyPost(w http.ResponseWriter, r *http.Request) {
+	user, err := app.users.GetByID(app.authenticatedUserID(r))
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	key := strconv.Itoa(user.ID)
+	switch {
+	case user.EmailVerified:
+		app.sessionManager.Put(r.Context(), "flash", "Your email address is already verified.")
+	case !app.verificationLimiter.Allow(key):
+		app.sessionManager.Put(r.Context(), "flash", "Too many verification emails. Please try again later.")
+	default:
+		app.verificationLimiter.Fail(key)
+		app.sendVerificationEmail(user)
+		app.sessionManager.Put(r.Context(), "flash", "We sent a new verification link to "+user.Email+".")
+	}
+	http.Redirect(w, r, "/account/view", http.StatusSeeOther)
+}
+
+// Display the form asking for the email address to send a password reset
+// link to
+func (app *application) userForgotPassword(w http.ResponseWriter, r *http.Request) {
+	data := app.newTemplateData(r)
+	data.Form = userForgotPasswordForm{}
+	app.render(w, r, http.StatusOK, "forgot-password.tmpl", data)
+}
+
+// userForgotPasswordPost emails a password reset link to the address entered,
+// if it belongs to an account. The response is the same either way, so the
+// form can't be used to find out who has signed up.
+func (app *application) userForgotPasswordPost(w http.ResponseWriter, r *http.Request) {
+	var form userForgotPasswordForm
+
+	err := app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	form.CheckField(validator.NotBlank(form.Email), "email", "This field cannot be blank")
+	form.CheckField(validator.IsEmail(form.Email), "email", "This field must be a valid email address")
+
+	if !form.Valid() {
+		data := app.newTemplateData(r)
+		data.Form = form
+		app.render(w, r, http.StatusUnprocessableEntity, "forgot-password.tmpl", data)
+		return
+	}
+
+	user, err := app.users.GetByEmail(form.Email)
+	if err != nil && !errors.Is(err, models.ErrNoRecord) {
+		app.serverError(w, r, err)
+		return
+	}
+	if err == nil && app.passwordResetLimiter.Allow(user.Email) {
+		app.passwordResetLimiter.Fail(user.Email)
+		token, err := app.passwordResets.Insert(user.ID, passwordResetTTL)
+		if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+		app.sendPasswordResetEmail(user, token)
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", "If an account uses "+form.Email+", we sent it a link to reset the password.")
+	http.Redirect(w, r, "/user/login", http.StatusSeeOther)
+}
+
+// Display the form for choosing a new password with a reset link
+func (app *application) userResetPassword(w http.ResponseWriter, r *http.Request) {
+	token := r.PathValue("token")
+	exists, err := app.passwordResets.Exists(token)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+	if !exists {
+		app.sessionManager.Put(r.Context(), "flash", "This password reset link is invalid or has expired.")
+		http.Redirect(w, r, "/user/password/forgot", http.StatusSeeOther)
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.Form = userResetPasswordForm{Token: token}
+	app.render(w, r, http.StatusOK, "reset-password.tmpl", data)
+}
+
+// userResetPasswordPost sets a new password with a reset link, then logs the
+// user out of every session, in case someone else got hold of one.
+func (app *application) userResetPasswordPost(w http.ResponseWriter, r *http.Request) {
+	form := userResetPasswordForm{Token: r.PathValue("token")}
+
+	err := app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	form.CheckField(validator.NotBlank(form.NewPassword), "newPassword", "This field cannot be blank")
+	form.CheckField(validator.MinChars(form.NewPassword, 8), "newPassword", "This field must be at least 8 characters long")
+	form.CheckField(validator.EqualValue(form.ConfirmNewPassword, form.NewPassword), "confirmNewPassword", "Passwords do not match")
+
+	if !form.Valid() {
+		data := app.newTemplateData(r)
+		data.Form = form
+		app.render(w, r, http.StatusUnprocessableEntity, "reset-password.tmpl", data)
+		return
+	}
+
+	_, err = app.passwordResets.Reset(form.Token, form.NewPassword)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.sessionManager.Put(r.Context(), "flash", "This password reset link is invalid or has expired.")
+			http.Redirect(w, r, "/user/password/forgot", http.StatusSeeOther)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	// The reset logged the user out of every session, see
+	// UserModel.SessionGeneration; this one is logged out as well.
+	if err := app.sessionManager.RenewToken(r.Context()); err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+	app.sessionManager.Remove(r.Context(), "authenticatedUserID")
+
+	app.sessionManager.Put(r.Context(), "flash", "Your password has been reset. Please log in with your new password.")
 	http.Redirect(w, r, "/user/login", http.StatusSeeOther)
 }
 
@@ -348,9 +1992,30 @@ func (app *application) userLoginPost(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// While an account or IP is backing off, the password isn't even
+	// checked, so guessing it doesn't get any faster by trying harder.
+	throttled, err := app.loginThrottled(w, r, form.Email)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+	if throttled {
+		form.AddNonFieldError(loginThrottledMessage)
+
+		data := app.newTemplateData(r)
+		data.Form = form
+		app.render(w, r, http.StatusTooManyRequests, "login.tmpl", data)
+		return
+	}
+
 	id, err := app.users.Authenticate(form.Email, form.Password)
 	if err != nil {
 		if errors.Is(err, models.ErrInvalidCredentials) {
+			err = app.recordLoginFailure(form.Email, app.clientIP(r))
+			if err != nil {
+				app.serverError(w, r, err)
+				return
+			}
 			form.AddNonFieldError("your email address or password is wrong")
 
 			data := app.newTemplateData(r)
@@ -362,18 +2027,108 @@ func (app *application) userLoginPost(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := app.sessionManager.RenewToken(r.Context()); err != nil {
+	user, err := app.users.GetByID(id)
+	if err != nil {
 		app.serverError(w, r, err)
 		return
 	}
+	if user.TwoFactorEnabled {
+		// The password was right, but the session only gets logged in once
+		// the code from the authenticator app is too.
+		if err := app.sessionManager.RenewToken(r.Context()); err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+		app.sessionManager.Put(r.Context(), "twoFactorUserID", id)
+		app.sessionManager.Put(r.Context(), "twoFactorExpires", time.Now().Add(twoFactorLoginTTL).Unix())
+		http.Redirect(w, r, "/user/login/2fa", http.StatusSeeOther)
+		return
+	}
+
+	app.completeLogin(w, r, id)
+}
+
+// Display the form asking for the second factor of a login
+func (app *application) userLoginTwoFactor(w http.ResponseWriter, r *http.Request) {
+	if app.twoFactorUserID(r) == 0 {
+		app.sessionManager.Put(r.Context(), "flash", "Your login has expired. Please log in again.")
+		http.Redirect(w, r, "/user/login", http.StatusSeeOther)
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.Form = twoFactorForm{}
+	app.render(w, r, http.StatusOK, "login-2fa.tmpl", data)
+}
+
+// userLoginTwoFactorPost completes a login with a code from the user's
+// authenticator app or one of their recovery codes.
+func (app *application) userLoginTwoFactorPost(w http.ResponseWriter, r *http.Request) {
+	id := app.twoFactorUserID(r)
+	if id == 0 {
+		app.sessionManager.Put(r.Context(), "flash", "Your login has expired. Please log in again.")
+		http.Redirect(w, r, "/user/login", http.StatusSeeOther)
+		return
+	}
+
+	var form twoFactorForm
+
+	err := app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	form.CheckField(validator.NotBlank(form.Code), "code", "This field cannot be blank")
+
+	if !form.Valid() {
+		data := app.newTemplateData(r)
+		data.Form = form
+		app.render(w, r, http.StatusUnprocessableEntity, "login-2fa.tmpl", data)
+		return
+	}
 
-	app.sessionManager.Put(r.Context(), "authenticatedUserID", id)
-	path := app.sessionManager.PopString(r.Context(), "redirectPathAfterLogin")
-	if path != "" {
-		http.Redirect(w, r, path, http.StatusSeeOther)
+	// Six digits have few enough combinations to be guessed, so a login gets
+	// only a few tries before the user has to start over later.
+	key := strconv.Itoa(id)
+	if !app.twoFactorLimiter.Allow(key) {
+		app.sessionManager.Remove(r.Context(), "twoFactorUserID")
+		app.sessionManager.Put(r.Context(), "flash", "Too many wrong codes. Please try again later.")
+		http.Redirect(w, r, "/user/login", http.StatusSeeOther)
 		return
 	}
-	http.Redirect(w, r, "/note/create", http.StatusSeeOther)
+
+	usedRecoveryCode := false
+	err = app.twoFactor.Verify(id, form.Code)
+	if errors.Is(err, models.ErrInvalidCredentials) {
+		err = app.twoFactor.UseRecoveryCode(id, form.Code)
+		usedRecoveryCode = err == nil
+	}
+	if err != nil {
+		if errors.Is(err, models.ErrInvalidCredentials) {
+			app.twoFactorLimiter.Fail(key)
+			form.AddNonFieldError("the code is wrong or has already been used")
+			data := app.newTemplateData(r)
+			data.Form = form
+			app.render(w, r, http.StatusUnprocessableEntity, "login-2fa.tmpl", data)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+	app.twoFactorLimiter.Reset(key)
+
+	if usedRecoveryCode {
+		left, err := app.twoFactor.RecoveryCodesLeft(id)
+		if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+		app.sessionManager.Put(r.Context(), "flash", fmt.Sprintf("You logged in with a recovery code. You have %d left.", left))
+	}
+	app.sessionManager.Remove(r.Context(), "twoFactorUserID")
+	app.sessionManager.Remove(r.Context(), "twoFactorExpires")
+	app.completeLogin(w, r, id)
 }
 
 // log out a user
@@ -420,11 +2175,36 @@ func (app *application) accountPasswordUpdatePost(w http.ResponseWriter, r *http
 		return
 	}
 
-	userID := app.sessionManager.GetInt(r.Context(), "authenticatedUserID")
+	userID := app.authenticatedUserID(r)
+
+	// The current password is throttled as on the login form, so a session
+	// that has been taken over can't be used to guess it.
+	user, err := app.users.GetByID(userID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+	throttled, err := app.loginThrottled(w, r, user.Email)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+	if throttled {
+		form.AddNonFieldError(loginThrottledMessage)
+		data := app.newTemplateData(r)
+		data.Form = form
+		app.render(w, r, http.StatusTooManyRequests, "change-password.tmpl", data)
+		return
+	}
 
 	err = app.users.ChangePassword(userID, form.CurrentPassword, form.NewPassword)
 	if err != nil {
 		if errors.Is(err, models.ErrInvalidCredentials) {
+			err = app.recordLoginFailure(user.Email, app.clientIP(r))
+			if err != nil {
+				app.serverError(w, r, err)
+				return
+			}
 			form.AddFieldError("currentPassword", "password is wrong")
 			data := app.newTemplateData(r)
 			data.Form = form
@@ -449,7 +2229,15 @@ func (app *application) about(w http.ResponseWriter, r *http.Request) {
 }
 
 func (app *application) accountView(w http.ResponseWriter, r *http.Request) {
-	userID := app.sessionManager.GetInt(r.Context(), "authenticatedUserID")
+	data := app.newTemplateData(r)
+	data.Form = tokenCreateForm{Scope: models.ScopeRead}
+	app.renderAccount(w, r, http.StatusOK, data)
+}
+
+// renderAccount fills in the user and their access tokens and renders the
+// account page, so the token form can be re-displayed with its errors.
+func (app *application) renderAccount(w http.ResponseWriter, r *http.Request, status int, data templateData) {
+	userID := app.authenticatedUserID(r)
 	user, err := app.users.GetByID(userID)
 	if err != nil {
 		app.logger.Debug(err.Error())
@@ -461,11 +2249,284 @@ func (app *application) accountView(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	tokens, err := app.tokens.GetAllForUser(userID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	data.User = user
+	data.Tokens = tokens
+	data.NewToken = app.sessionManager.PopString(r.Context(), "newToken")
+
+	app.render(w, r, status, "account.tmpl", data)
+}
+
+// accountTwoFactor shows how to set up two-factor authentication, or how to
+// manage it once it is on.
+func (app *application) accountTwoFactor(w http.ResponseWriter, r *http.Request) {
 	data := app.newTemplateData(r)
+	data.Form = twoFactorForm{}
+	app.renderTwoFactor(w, r, http.StatusOK, data)
+}
+
+// renderTwoFactor fills in the user and either the secret to set up or the
+// recovery codes, and renders the two-factor page, so its forms can be
+// re-displayed with their errors.
+func (app *application) renderTwoFactor(w http.ResponseWriter, r *http.Request, status int, data templateData) {
+	user, err := app.users.GetByID(app.authenticatedUserID(r))
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
 	data.User = user
 
-	app.render(w, r, http.StatusOK, "account.tmpl", data)
+	if user.TwoFactorEnabled {
+		data.RecoveryLeft, err = app.twoFactor.RecoveryCodesLeft(user.ID)
+		if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+		if codes := app.sessionManager.PopString(r.Context(), "newRecoveryCodes"); codes != "" {
+			data.RecoveryCodes = strings.Split(codes, "\n")
+		}
+	} else {
+		// The secret waits in the session until the user proves they have
+		// set it up, so reloading the page keeps showing the same one.
+		secret := app.sessionManager.GetString(r.Context(), "twoFactorSecret")
+		if secret == "" {
+			secret, err = totp.NewSecret()
+			if err != nil {
+				app.serverError(w, r, err)
+				return
+			}
+			app.sessionManager.Put(r.Context(), "twoFactorSecret", secret)
+		}
+		data.TwoFactorSecret = secret
+		data.TwoFactorURL = totp.URL("Noter", user.Email, secret)
+	}
+
+	app.render(w, r, status, "two-factor.tmpl", data)
+}
+
+// accountTwoFactorEnablePost turns on two-factor authentication once the user
+// enters a code generated from the secret they were shown.
+func (app *application) accountTwoFactorEnablePost(w http.ResponseWriter, r *http.Request) {
+	var form twoFactorForm
+
+	err := app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	secret := app.sessionManager.GetString(r.Context(), "twoFactorSecret")
+	if secret == "" {
+		http.Redirect(w, r, "/account/2fa", http.StatusSeeOther)
+		return
+	}
+
+	form.CheckField(validator.NotBlank(form.Code), "code", "This field cannot be blank")
+	if form.Valid() {
+		_, ok := totp.Validate(secret, strings.TrimSpace(form.Code), time.Now())
+		form.CheckField(ok, "code", "The code is wrong. Check that your device's clock is right and try again")
+	}
+
+	if !form.Valid() {
+		data := app.newTemplateData(r)
+		data.Form = form
+		app.renderTwoFactor(w, r, http.StatusUnprocessableEntity, data)
+		return
+	}
+
+	codes, err := app.twoFactor.Enable(app.authenticatedUserID(r), secret)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	app.sessionManager.Remove(r.Context(), "twoFactorSecret")
+	// The plaintexts are never stored, so this is the only time they can be
+	// shown.
+	app.sessionManager.Put(r.Context(), "newRecoveryCodes", strings.Join(codes, "\n"))
+	app.sessionManager.Put(r.Context(), "flash", "Two-factor authentication is on. Save your recovery codes now, you won't be able to see them again!")
+	http.Redirect(w, r, "/account/2fa", http.StatusSeeOther)
+}
+
+// confirmTwoFactorPassword checks the current password that turning off
+// two-factor authentication and replacing the recovery codes ask for. When it
+// is wrong it re-renders the page and returns false.
+func (app *application) confirmTwoFactorPassword(w http.ResponseWriter, r *http.Request, action string) bool {
+	form := twoFactorForm{Action: action}
+
+	err := app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return false
+	}
+
+	form.CheckField(validator.NotBlank(form.Password), "password", "This field cannot be blank")
+	status := http.StatusUnprocessableEntity
+	if form.Valid() {
+		// The password is throttled as on the login form, so a session
+		// that has been taken over can't be used to guess it.
+		user, err := app.users.GetByID(app.authenticatedUserID(r))
+		if err != nil {
+			app.serverError(w, r, err)
+			return false
+		}
+		throttled, err := app.loginThrottled(w, r, user.Email)
+		if err != nil {
+			app.serverError(w, r, err)
+			return false
+		}
+		if throttled {
+			form.AddFieldError("password", loginThrottledMessage)
+			status = http.StatusTooManyRequests
+		} else {
+			_, err = app.users.Authenticate(user.Email, form.Password)
+			if errors.Is(err, models.ErrInvalidCredentials) {
+				err = app.recordLoginFailure(user.Email, app.clientIP(r))
+				form.AddFieldError("password", "password is wrong")
+			}
+			if err != nil {
+				app.serverError(w, r, err)
+				return false
+			}
+		}
+	}
+
+	if !form.Valid() {
+		data := app.newTemplateData(r)
+		data.Form = form
+		app.renderTwoFactor(w, r, status, data)
+		return false
+	}
+	return true
+}
+
+func (app *application) accountTwoFactorDisablePost(w http.ResponseWriter, r *http.Request) {
+	if !app.confirmTwoFactorPassword(w, r, "disable") {
+		return
+	}
+
+	err := app.twoFactor.Disable(app.authenticatedUserID(r))
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", "Two-factor authentication is off.")
+	http.Redirect(w, r, "/account/view", http.StatusSeeOther)
+}
+
+func (app *application) accountRecoveryCodesPost(w http.ResponseWriter, r *http.Request) {
+	if !app.confirmTwoFactorPassword(w, r, "regenerate") {
+		return
+	}
+
+	codes, err := app.twoFactor.RegenerateRecoveryCodes(app.authenticatedUserID(r))
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "newRecoveryCodes", strings.Join(codes, "\n"))
+	app.sessionManager.Put(r.Context(), "flash", "New recovery codes created, the old ones no longer work. Save them now, you won't be able to see them again!")
+	http.Redirect(w, r, "/account/2fa", http.StatusSeeOther)
+}
+
+func (app *application) accountTokenCreatePost(w http.ResponseWriter, r *http.Request) {
+	var form tokenCreateForm
+
+	err := app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	form.CheckField(validator.NotBlank(form.Name), "name", "This field cannot be blank")
+	form.CheckField(validator.MaxChars(form.Name, 100), "name", "This field cannot be more than 100 characters long")
+	form.CheckField(validator.PermittedValue(form.Scope, models.ScopeRead, models.ScopeWrite), "scope", "This field must equal read or write")
+
+	if !form.Valid() {
+		data := app.newTemplateData(r)
+		data.Form = form
+		app.renderAccount(w, r, http.StatusUnprocessableEntity, data)
+		return
+	}
+
+	userID := app.authenticatedUserID(r)
+	token, err := app.tokens.Insert(userID, form.Name, form.Scope)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	// The plaintext is never stored, so this is the only time it can be shown.
+	app.sessionManager.Put(r.Context(), "newToken", token)
+	app.sessionManager.Put(r.Context(), "flash", "Token created. Copy it now, you won't be able to see it again!")
+	http.Redirect(w, r, "/account/view", http.StatusSeeOther)
+}
+
+func (app *application) accountTokenRevokePost(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil || id < 1 {
+		app.clientError(w, http.StatusNotFound)
+		return
+	}
+
+	userID := app.authenticatedUserID(r)
+	err = app.tokens.Delete(id, userID)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.clientError(w, http.StatusNotFound)
+			return
+		}
+		app.serverError(w, r, err)
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", "Token successfully revoked!")
+	http.Redirect(w, r, "/account/view", http.StatusSeeOther)
+}
+
+// adminLockouts lists the latest accounts and client IPs locked out after
+// failed logins, so an admin can unlock the ones still in force.
+func (app *application) adminLockouts(w http.ResponseWriter, r *http.Request) {
+	lockouts, err := app.lockouts.GetRecent(recentLockouts)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.Lockouts = lockouts
+	app.render(w, r, http.StatusOK, "admin-lockouts.tmpl", data)
+}
+
+func (app *application) adminLockoutUnlockPost(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil || id < 1 {
+		app.clientError(w, http.StatusNotFound)
+		return
+	}
+
+	adminID := app.authenticatedUserID(r)
+	_, err = app.lockouts.Unlock(id, adminID)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.clientError(w, http.StatusNotFound)
+			return
+		}
+		app.serverError(w, r, err)
+		return
+	}
 
+	app.logger.Info("lockout lifted", slog.Int("lockout_id", id), slog.Int("admin_id", adminID))
+
+	app.sessionManager.Put(r.Context(), "flash", "Lockout lifted!")
+	http.Redirect(w, r, "/admin/lockouts", http.StatusSeeOther)
 }
 
 func (app *application) userProfile(w http.ResponseWriter, r *http.Request) {
@@ -487,7 +2548,7 @@ func (app *application) userProfile(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Check if the current user is viewing their own profile
-	currentUserID := app.sessionManager.GetInt(r.Context(), "authenticatedUserID")
+	currentUserID := app.authenticatedUserID(r)
 	isOwnProfile := currentUserID == id
 
 	var showPublic *bool
@@ -509,7 +2570,19 @@ func (app *application) userProfile(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	notes, metaData, err := app.notes.GetByPage(pageInt, 10, showPublic, &id)
+	sort, err := app.readSort(r)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	tag := app.readTagFilter(r)
+	notes, metaData, err := app.notes.GetByPage(pageInt, 10, &id, models.NotesFilters{ShowPublic: showPublic, Tag: tag, HideRestricted: !isOwnProfile, Sort: sort})
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+	err = app.attachTags(notes)
 	if err != nil {
 		app.serverError(w, r, err)
 		return
@@ -518,8 +2591,15 @@ func (app *application) userProfile(w http.ResponseWriter, r *http.Request) {
 	data := app.newTemplateData(r)
 	data.User = user
 	data.Notes = notes
+	data.Favorites, err = app.favoritesFor(r, notes)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
 	data.CurrentPage = pageInt
 	data.HasNext = metaData.HasNext
+	data.ActiveTag = tag
+	data.Sort = sort
 
 	// Only pass NotesFilters if it's their own profile
 	if isOwnProfile {
@@ -537,6 +2617,7 @@ func (app *application) userProfile(w http.ResponseWriter, r *http.Request) {
 
 		data.NotesFilters = &models.NotesFilters{
 			ShowPublic: filterShowPublic,
+			Tag:        tag,
 		}
 	}
 
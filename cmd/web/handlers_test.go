@@ -2,10 +2,20 @@ package main
 
 import (
 	"net/http"
+	"net/http/httptest"
 	"net/url"
+	"os"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/Abdelrahman-habib/noter/internal/assert"
+	"github.com/Abdelrahman-habib/noter/internal/models/mocks"
+	"github.com/Abdelrahman-habib/noter/internal/totp"
 )
 
 func TestPing(t *testing.T) {
@@ -36,6 +46,18 @@ func TestNoteView(t *testing.T) {
 			wantCode: http.StatusOK,
 			wantBody: "An old silent pond...",
 		},
+		{
+			name:     "Markdown note",
+			urlPath:  "/note/view/550e8400-e29b-41d4-a716-446655440003",
+			wantCode: http.StatusOK,
+			wantBody: "<h1>A frog jumps</h1>",
+		},
+		{
+			name:     "Code note",
+			urlPath:  "/note/view/550e8400-e29b-41d4-a716-446655440004",
+			wantCode: http.StatusOK,
+			wantBody: `<span class="kd">func</span>`,
+		},
 		{
 			name:     "Non-existent ID",
 			urlPath:  "/note/view/550e8400-e29b-41d4-a716-446655440999",
@@ -208,3 +230,1564 @@ func TestNoteCreate(t *testing.T) {
 		assert.StringContains(t, body, "<form action='/note/create' method='POST'>")
 	})
 }
+
+func TestAccountTokens(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	ts.login(t, "alice@example.com", "pa$$word")
+
+	code, _, body := ts.get(t, "/account/view")
+	assert.Equal(t, code, http.StatusOK)
+	assert.StringContains(t, body, "backup script")
+
+	tests := []struct {
+		name      string
+		tokenName string
+		scope     string
+		wantCode  int
+		wantBody  string
+	}{
+		{
+			name:      "Empty name",
+			tokenName: "",
+			scope:     "read",
+			wantCode:  http.StatusUnprocessableEntity,
+			wantBody:  "This field cannot be blank",
+		},
+		{
+			name:      "Invalid scope",
+			tokenName: "deploy",
+			scope:     "admin",
+			wantCode:  http.StatusUnprocessableEntity,
+			wantBody:  "This field must equal read or write",
+		},
+		{
+			name:      "Valid submission",
+			tokenName: "deploy",
+			scope:     "write",
+			wantCode:  http.StatusSeeOther,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			form := url.Values{}
+			form.Add("name", tt.tokenName)
+			form.Add("scope", tt.scope)
+			form.Add("csrf_token", extractCSRFToken(t, body))
+			code, _, respBody := ts.postForm(t, "/account/tokens/create", form)
+
+			assert.Equal(t, code, tt.wantCode)
+			if tt.wantBody != "" {
+				assert.StringContains(t, respBody, tt.wantBody)
+			}
+		})
+	}
+
+	t.Run("New token is shown once", func(t *testing.T) {
+		_, _, body := ts.get(t, "/account/view")
+		assert.StringContains(t, body, "noter_MOCKTOKENMOCKTOKENMOCKTOKENMOCK")
+	})
+}
+
+func TestListNotesTagFilter(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	code, _, body := ts.get(t, "/notes?tag=Haiku")
+	assert.Equal(t, code, http.StatusOK)
+	assert.StringContains(t, body, `title="Clear tag filter">#haiku`)
+	assert.StringContains(t, body, `<span class="tag">#poetry</span>`)
+}
+
+func TestListNotesSort(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	code, _, body := ts.get(t, "/notes?page=2&tag=haiku&sort=title")
+	assert.Equal(t, code, http.StatusOK)
+	assert.StringContains(t, body, "<option value='title' selected>Title</option>")
+	assert.StringContains(t, body, "<input type='hidden' name='tag' value='haiku'>")
+	assert.StringContains(t, body, "href='/notes?page=1&tag=haiku&sort=title'")
+
+	code, _, body = ts.get(t, "/?sort=updated")
+	assert.Equal(t, code, http.StatusOK)
+	assert.StringContains(t, body, "href='/notes?page=1&sort=updated'")
+
+	code, _, _ = ts.get(t, "/notes?sort=random")
+	assert.Equal(t, code, http.StatusBadRequest)
+}
+
+func TestSearch(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	tests := []struct {
+		name     string
+		urlPath  string
+		wantCode int
+		wantBody string
+	}{
+		{
+			name:     "Empty query",
+			urlPath:  "/search",
+			wantCode: http.StatusOK,
+			wantBody: "<form action='/search' method='GET'",
+		},
+		{
+			name:     "Matching query",
+			urlPath:  "/search?q=silent",
+			wantCode: http.StatusOK,
+			wantBody: "An old <mark>silent</mark> pond",
+		},
+		{
+			name:     "No matches",
+			urlPath:  "/search?q=frog",
+			wantCode: http.StatusOK,
+			wantBody: "No notes matched your search.",
+		},
+		{
+			name:     "Invalid page",
+			urlPath:  "/search?q=silent&page=foo",
+			wantCode: http.StatusBadRequest,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, _, body := ts.get(t, tt.urlPath)
+			assert.Equal(t, code, tt.wantCode)
+			if tt.wantBody != "" {
+				assert.StringContains(t, body, tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestNoteHistory(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	ts.login(t, "alice@example.com", "pa$$word")
+
+	tests := []struct {
+		name     string
+		urlPath  string
+		wantCode int
+		wantBody string
+	}{
+		{
+			name:     "History",
+			urlPath:  "/note/history/550e8400-e29b-41d4-a716-446655440000",
+			wantCode: http.StatusOK,
+			wantBody: "<input type='hidden' name='revision_id' value='1'>",
+		},
+		{
+			name:     "History of non-existent note",
+			urlPath:  "/note/history/550e8400-e29b-41d4-a716-446655440999",
+			wantCode: http.StatusNotFound,
+		},
+		{
+			name:     "Diff",
+			urlPath:  "/note/history/550e8400-e29b-41d4-a716-446655440000/diff?from=1&to=2",
+			wantCode: http.StatusOK,
+			wantBody: "<div class='diff-line diff-insert'>+ A frog jumps into the pond,</div>",
+		},
+		{
+			name:     "Diff with missing revision",
+			urlPath:  "/note/history/550e8400-e29b-41d4-a716-446655440000/diff?from=1&to=3",
+			wantCode: http.StatusNotFound,
+		},
+		{
+			name:     "Diff without revisions",
+			urlPath:  "/note/history/550e8400-e29b-41d4-a716-446655440000/diff",
+			wantCode: http.StatusBadRequest,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, _, body := ts.get(t, tt.urlPath)
+			assert.Equal(t, code, tt.wantCode)
+			if tt.wantBody != "" {
+				assert.StringContains(t, body, tt.wantBody)
+			}
+		})
+	}
+
+	t.Run("Restore", func(t *testing.T) {
+		_, _, body := ts.get(t, "/note/history/550e8400-e29b-41d4-a716-446655440000")
+		form := url.Values{}
+		form.Add("revision_id", "1")
+		form.Add("csrf_token", extractCSRFToken(t, body))
+		code, headers, _ := ts.postForm(t, "/note/history/550e8400-e29b-41d4-a716-446655440000/restore", form)
+		assert.Equal(t, code, http.StatusSeeOther)
+		assert.Equal(t, headers.Get("Location"), "/note/view/550e8400-e29b-41d4-a716-446655440000")
+	})
+}
+
+func TestTrash(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	ts.login(t, "alice@example.com", "pa$$word")
+
+	code, _, body := ts.get(t, "/trash")
+	assert.Equal(t, code, http.StatusOK)
+	assert.StringContains(t, body, "<form action='/trash/restore/550e8400-e29b-41d4-a716-446655440002' method='POST'>")
+	csrfToken := extractCSRFToken(t, body)
+
+	tests := []struct {
+		name         string
+		urlPath      string
+		wantCode     int
+		wantLocation string
+	}{
+		{
+			name:         "Restore",
+			urlPath:      "/trash/restore/550e8400-e29b-41d4-a716-446655440002",
+			wantCode:     http.StatusSeeOther,
+			wantLocation: "/note/view/550e8400-e29b-41d4-a716-446655440002",
+		},
+		{
+			name:     "Restore note not in trash",
+			urlPath:  "/trash/restore/550e8400-e29b-41d4-a716-446655440000",
+			wantCode: http.StatusNotFound,
+		},
+		{
+			name:         "Delete forever",
+			urlPath:      "/trash/delete/550e8400-e29b-41d4-a716-446655440002",
+			wantCode:     http.StatusSeeOther,
+			wantLocation: "/trash",
+		},
+		{
+			name:     "Delete forever with invalid ID",
+			urlPath:  "/trash/delete/foo",
+			wantCode: http.StatusNotFound,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			form := url.Values{}
+			form.Add("csrf_token", csrfToken)
+			code, headers, _ := ts.postForm(t, tt.urlPath, form)
+			assert.Equal(t, code, tt.wantCode)
+			assert.Equal(t, headers.Get("Location"), tt.wantLocation)
+		})
+	}
+}
+
+func TestNotePreview(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	ts.login(t, "alice@example.com", "pa$$word")
+
+	_, _, body := ts.get(t, "/note/create")
+	csrfToken := extractCSRFToken(t, body)
+
+	tests := []struct {
+		name        string
+		content     string
+		format      string
+		wantCode    int
+		wantBody    string
+		notWantBody string
+	}{
+		{
+			name:     "Plain text",
+			content:  "*not emphasised*",
+			format:   "plain",
+			wantCode: http.StatusOK,
+			wantBody: "<pre><code>*not emphasised*</code></pre>",
+		},
+		{
+			name:     "Detected language",
+			content:  "package main\n\nfunc main() {}",
+			format:   "plain",
+			wantCode: http.StatusOK,
+			wantBody: `<pre class="chroma">`,
+		},
+		{
+			name:        "Markdown",
+			content:     "*emphasised* <script>alert(1)</script>",
+			format:      "markdown",
+			wantCode:    http.StatusOK,
+			wantBody:    "<em>emphasised</em>",
+			notWantBody: "<script>",
+		},
+		{
+			name:     "Invalid format",
+			content:  "text",
+			format:   "html",
+			wantCode: http.StatusBadRequest,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			form := url.Values{}
+			form.Add("csrf_token", csrfToken)
+			form.Add("content", tt.content)
+			form.Add("format", tt.format)
+			code, _, body := ts.postForm(t, "/note/preview", form)
+			assert.Equal(t, code, tt.wantCode)
+			if tt.wantBody != "" {
+				assert.StringContains(t, body, tt.wantBody)
+			}
+			if tt.notWantBody != "" && strings.Contains(body, tt.notWantBody) {
+				t.Errorf("got %q; want it not to contain %q", body, tt.notWantBody)
+			}
+		})
+	}
+}
+
+func TestShareLinks(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	t.Run("Anonymous view", func(t *testing.T) {
+		code, headers, body := ts.get(t, "/s/validsharelink")
+		assert.Equal(t, code, http.StatusOK)
+		assert.Equal(t, headers.Get("Cache-Control"), "no-store")
+		assert.StringContains(t, body, "An old silent pond...")
+	})
+
+	t.Run("Unknown link", func(t *testing.T) {
+		code, _, _ := ts.get(t, "/s/nosuchlink")
+		assert.Equal(t, code, http.StatusNotFound)
+	})
+
+	ts.login(t, "alice@example.com", "pa$$word")
+
+	code, _, body := ts.get(t, "/note/view/550e8400-e29b-41d4-a716-446655440000")
+	assert.Equal(t, code, http.StatusOK)
+	assert.StringContains(t, body, "<form action='/note/share/550e8400-e29b-41d4-a716-446655440000/revoke/1' method='POST'>")
+	assert.StringContains(t, body, "<td>2 / 5</td>")
+	csrfToken := extractCSRFToken(t, body)
+
+	tests := []struct {
+		name         string
+		urlPath      string
+		maxViews     string
+		wantCode     int
+		wantLocation string
+	}{
+		{
+			name:     "Create with invalid view limit",
+			urlPath:  "/note/share/550e8400-e29b-41d4-a716-446655440000",
+			maxViews: "-1",
+			wantCode: http.StatusUnprocessableEntity,
+		},
+		{
+			name:     "Create for missing note",
+			urlPath:  "/note/share/550e8400-e29b-41d4-a716-446655440999",
+			wantCode: http.StatusNotFound,
+		},
+		{
+			name:         "Revoke",
+			urlPath:      "/note/share/550e8400-e29b-41d4-a716-446655440000/revoke/1",
+			wantCode:     http.StatusSeeOther,
+			wantLocation: "/note/view/550e8400-e29b-41d4-a716-446655440000",
+		},
+		{
+			name:     "Revoke unknown link",
+			urlPath:  "/note/share/550e8400-e29b-41d4-a716-446655440000/revoke/2",
+			wantCode: http.StatusNotFound,
+		},
+		{
+			name:         "Create",
+			urlPath:      "/note/share/550e8400-e29b-41d4-a716-446655440000",
+			maxViews:     "10",
+			wantCode:     http.StatusSeeOther,
+			wantLocation: "/note/view/550e8400-e29b-41d4-a716-446655440000",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			form := url.Values{}
+			form.Add("csrf_token", csrfToken)
+			form.Add("expires_in", "7")
+			form.Add("max_views", tt.maxViews)
+			code, headers, _ := ts.postForm(t, tt.urlPath, form)
+			assert.Equal(t, code, tt.wantCode)
+			assert.Equal(t, headers.Get("Location"), tt.wantLocation)
+		})
+	}
+
+	// The new link is shown once, on the page the form redirects to.
+	_, _, body = ts.get(t, "/note/view/550e8400-e29b-41d4-a716-446655440000")
+	assert.StringContains(t, body, "https://noter.test/s/MOCKSHARELINKMOCKSHARELINKMOCKSH")
+}
+
+func TestNoteShares(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	ts.login(t, "alice@example.com", "pa$$word")
+
+	code, _, body := ts.get(t, "/note/view/550e8400-e29b-41d4-a716-446655440000")
+	assert.Equal(t, code, http.StatusOK)
+	assert.StringContains(t, body, "<form action='/note/shares/550e8400-e29b-41d4-a716-446655440000/revoke/2' method='POST'>")
+	assert.StringContains(t, body, "<td>bob@example.com</td>")
+	csrfToken := extractCSRFToken(t, body)
+
+	tests := []struct {
+		name         string
+		urlPath      string
+		email        string
+		permission   string
+		wantCode     int
+		wantLocation string
+	}{
+		{
+			name:         "Grant",
+			urlPath:      "/note/shares/550e8400-e29b-41d4-a716-446655440000",
+			email:        "bob@example.com",
+			permission:   "edit",
+			wantCode:     http.StatusSeeOther,
+			wantLocation: "/note/view/550e8400-e29b-41d4-a716-446655440000",
+		},
+		{
+			name:       "Grant to unknown email",
+			urlPath:    "/note/shares/550e8400-e29b-41d4-a716-446655440000",
+			email:      "carol@example.com",
+			permission: "view",
+			wantCode:   http.StatusUnprocessableEntity,
+		},
+		{
+			name:       "Grant to owner",
+			urlPath:    "/note/shares/550e8400-e29b-41d4-a716-446655440000",
+			email:      "alice@example.com",
+			permission: "view",
+			wantCode:   http.StatusUnprocessableEntity,
+		},
+		{
+			name:       "Grant invalid permission",
+			urlPath:    "/note/shares/550e8400-e29b-41d4-a716-446655440000",
+			email:      "bob@example.com",
+			permission: "admin",
+			wantCode:   http.StatusUnprocessableEntity,
+		},
+		{
+			name:       "Grant for missing note",
+			urlPath:    "/note/shares/550e8400-e29b-41d4-a716-446655440999",
+			email:      "bob@example.com",
+			permission: "view",
+			wantCode:   http.StatusNotFound,
+		},
+		{
+			name:         "Revoke",
+			urlPath:      "/note/shares/550e8400-e29b-41d4-a716-446655440000/revoke/2",
+			wantCode:     http.StatusSeeOther,
+			wantLocation: "/note/view/550e8400-e29b-41d4-a716-446655440000",
+		},
+		{
+			name:     "Revoke unknown user",
+			urlPath:  "/note/shares/550e8400-e29b-41d4-a716-446655440000/revoke/3",
+			wantCode: http.StatusNotFound,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			form := url.Values{}
+			form.Add("csrf_token", csrfToken)
+			form.Add("email", tt.email)
+			form.Add("permission", tt.permission)
+			code, headers, _ := ts.postForm(t, tt.urlPath, form)
+			assert.Equal(t, code, tt.wantCode)
+			assert.Equal(t, headers.Get("Location"), tt.wantLocation)
+		})
+	}
+}
+
+func TestNoteSharesCollaborator(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	ts.login(t, "bob@example.com", "pa$$word")
+
+	t.Run("Shared with me", func(t *testing.T) {
+		code, _, body := ts.get(t, "/shared-with-me")
+		assert.Equal(t, code, http.StatusOK)
+		assert.StringContains(t, body, "An old silent pond")
+	})
+
+	t.Run("Editor sees the edit button only", func(t *testing.T) {
+		code, _, body := ts.get(t, "/note/view/550e8400-e29b-41d4-a716-446655440000")
+		assert.Equal(t, code, http.StatusOK)
+		assert.StringContains(t, body, `href="/note/edit/550e8400-e29b-41d4-a716-446655440000"`)
+		assert.StringNotContains(t, body, "/note/history/")
+		assert.StringNotContains(t, body, "Shared With")
+	})
+
+	t.Run("Editor can't change expiry or visibility", func(t *testing.T) {
+		code, _, body := ts.get(t, "/note/edit/550e8400-e29b-41d4-a716-446655440000")
+		assert.Equal(t, code, http.StatusOK)
+		assert.StringContains(t, body, "<input type='hidden' name='visibility' value='public'>")
+		assert.StringNotContains(t, body, "name='visibility' value='private'")
+	})
+
+	t.Run("Viewer can't edit", func(t *testing.T) {
+		code, _, _ := ts.get(t, "/note/edit/550e8400-e29b-41d4-a716-446655440003")
+		assert.Equal(t, code, http.StatusNotFound)
+	})
+
+	t.Run("Collaborator can't manage sharing", func(t *testing.T) {
+		_, _, body := ts.get(t, "/note/view/550e8400-e29b-41d4-a716-446655440000")
+		form := url.Values{}
+		form.Add("csrf_token", extractCSRFToken(t, body))
+		form.Add("email", "bob@example.com")
+		form.Add("permission", "edit")
+		code, _, _ := ts.postForm(t, "/note/shares/550e8400-e29b-41d4-a716-446655440000", form)
+		assert.Equal(t, code, http.StatusNotFound)
+	})
+}
+
+func TestBurnAfterReading(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	const burnURL = "/note/view/550e8400-e29b-41d4-a716-446655440005"
+
+	code, headers, body := ts.get(t, burnURL)
+	assert.Equal(t, code, http.StatusOK)
+	assert.Equal(t, headers.Get("Cache-Control"), "no-store")
+	assert.StringContains(t, body, "Read and delete the note")
+	assert.StringNotContains(t, body, "This message will self-destruct.")
+	csrfToken := extractCSRFToken(t, body)
+
+	tests := []struct {
+		name     string
+		urlPath  string
+		wantCode int
+		wantBody string
+	}{
+		{
+			name:     "Read",
+			urlPath:  burnURL,
+			wantCode: http.StatusOK,
+			wantBody: "This message will self-destruct.",
+		},
+		{
+			name:     "Ordinary note",
+			urlPath:  "/note/view/550e8400-e29b-41d4-a716-446655440000",
+			wantCode: http.StatusNotFound,
+		},
+		{
+			name:     "Invalid ID",
+			urlPath:  "/note/view/foo",
+			wantCode: http.StatusNotFound,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			form := url.Values{}
+			form.Add("csrf_token", csrfToken)
+			code, _, body := ts.postForm(t, tt.urlPath, form)
+			assert.Equal(t, code, tt.wantCode)
+			assert.StringContains(t, body, tt.wantBody)
+		})
+	}
+
+	t.Run("API hides it from non-owners", func(t *testing.T) {
+		code, _, _ := ts.get(t, "/api/v1/notes/550e8400-e29b-41d4-a716-446655440005")
+		assert.Equal(t, code, http.StatusNotFound)
+	})
+
+	t.Run("Owner reads without burning", func(t *testing.T) {
+		ts.login(t, "alice@example.com", "pa$$word")
+		code, _, body := ts.get(t, burnURL)
+		assert.Equal(t, code, http.StatusOK)
+		assert.StringContains(t, body, "This message will self-destruct.")
+		assert.StringContains(t, body, "Burn after reading")
+		assert.StringNotContains(t, body, "Create share link")
+	})
+}
+
+func TestNotePassword(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	const (
+		viewURL   = "/note/view/550e8400-e29b-41d4-a716-446655440006"
+		unlockURL = "/note/unlock/550e8400-e29b-41d4-a716-446655440006"
+		content   = "Only for those who know the password."
+	)
+
+	code, headers, body := ts.get(t, viewURL)
+	assert.Equal(t, code, http.StatusOK)
+	assert.Equal(t, headers.Get("Cache-Control"), "no-store")
+	assert.StringContains(t, body, "<form action='/note/unlock/550e8400-e29b-41d4-a716-446655440006' method='POST' novalidate>")
+	assert.StringNotContains(t, body, content)
+	csrfToken := extractCSRFToken(t, body)
+
+	t.Run("API hides it from non-owners", func(t *testing.T) {
+		code, _, _ := ts.get(t, "/api/v1/notes/550e8400-e29b-41d4-a716-446655440006")
+		assert.Equal(t, code, http.StatusNotFound)
+	})
+
+	tests := []struct {
+		name         string
+		password     string
+		wantCode     int
+		wantLocation string
+	}{
+		{
+			name:     "Blank password",
+			wantCode: http.StatusUnprocessableEntity,
+		},
+		{
+			name:     "Wrong password",
+			password: "open barley",
+			wantCode: http.StatusUnprocessableEntity,
+		},
+		{
+			name:         "Right password",
+			password:     "open sesame",
+			wantCode:     http.StatusSeeOther,
+			wantLocation: viewURL,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			form := url.Values{}
+			form.Add("csrf_token", csrfToken)
+			form.Add("password", tt.password)
+			code, headers, _ := ts.postForm(t, unlockURL, form)
+			assert.Equal(t, code, tt.wantCode)
+			assert.Equal(t, headers.Get("Location"), tt.wantLocation)
+		})
+	}
+
+	t.Run("Unlocked for the session", func(t *testing.T) {
+		code, _, body := ts.get(t, viewURL)
+		assert.Equal(t, code, http.StatusOK)
+		assert.StringContains(t, body, content)
+	})
+}
+
+func TestNotePasswordRateLimit(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	_, _, body := ts.get(t, "/note/view/550e8400-e29b-41d4-a716-446655440006")
+	csrfToken := extractCSRFToken(t, body)
+
+	unlock := func(password string) int {
+		form := url.Values{}
+		form.Add("csrf_token", csrfToken)
+		form.Add("password", password)
+		code, _, _ := ts.postForm(t, "/note/unlock/550e8400-e29b-41d4-a716-446655440006", form)
+		return code
+	}
+
+	for range notePasswordAttempts {
+		assert.Equal(t, unlock("wrong password"), http.StatusUnprocessableEntity)
+	}
+	// Once the limit is hit even the right password is refused.
+	assert.Equal(t, unlock("open sesame"), http.StatusTooManyRequests)
+}
+
+func TestNotePasswordOwner(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	ts.login(t, "alice@example.com", "pa$$word")
+
+	code, _, body := ts.get(t, "/note/view/550e8400-e29b-41d4-a716-446655440006")
+	assert.Equal(t, code, http.StatusOK)
+	assert.StringContains(t, body, "Only for those who know the password.")
+	assert.StringContains(t, body, "<form action='/note/password/550e8400-e29b-41d4-a716-446655440006/remove' method='POST'>")
+	csrfToken := extractCSRFToken(t, body)
+
+	tests := []struct {
+		name         string
+		urlPath      string
+		password     string
+		wantCode     int
+		wantLocation string
+	}{
+		{
+			name:     "Short password",
+			urlPath:  "/note/password/550e8400-e29b-41d4-a716-446655440006",
+			password: "short",
+			wantCode: http.StatusUnprocessableEntity,
+		},
+		{
+			name:         "Set password",
+			urlPath:      "/note/password/550e8400-e29b-41d4-a716-446655440006",
+			password:     "a new password",
+			wantCode:     http.StatusSeeOther,
+			wantLocation: "/note/view/550e8400-e29b-41d4-a716-446655440006",
+		},
+		{
+			name:         "Remove password",
+			urlPath:      "/note/password/550e8400-e29b-41d4-a716-446655440006/remove",
+			wantCode:     http.StatusSeeOther,
+			wantLocation: "/note/view/550e8400-e29b-41d4-a716-446655440006",
+		},
+		{
+			name:     "Missing note",
+			urlPath:  "/note/password/550e8400-e29b-41d4-a716-446655440999",
+			password: "a new password",
+			wantCode: http.StatusNotFound,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			form := url.Values{}
+			form.Add("csrf_token", csrfToken)
+			form.Add("password", tt.password)
+			code, headers, _ := ts.postForm(t, tt.urlPath, form)
+			assert.Equal(t, code, tt.wantCode)
+			assert.Equal(t, headers.Get("Location"), tt.wantLocation)
+		})
+	}
+}
+
+func TestNoteExpiry(t *testing.T) {
+	app := newTestApplication(t)
+	notes := &expiryRecorder{}
+	app.notes = notes
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	ts.login(t, "alice@example.com", "pa$$word")
+
+	code, _, body := ts.get(t, "/note/edit/550e8400-e29b-41d4-a716-446655440000")
+	assert.Equal(t, code, http.StatusOK)
+	assert.StringContains(t, body, "<input type='radio' name='lifetime' value='keep' checked>")
+	csrfToken := extractCSRFToken(t, body)
+
+	createTests := []struct {
+		name     string
+		lifetime string
+		field    string
+		value    string
+		wantCode int
+	}{
+		{"Preset", "7", "", "", http.StatusSeeOther},
+		{"Never", "never", "", "", http.StatusSeeOther},
+		{"Duration", "duration", "expires_in", "10d", http.StatusSeeOther},
+		{"Blank duration", "duration", "expires_in", "", http.StatusUnprocessableEntity},
+		{"Too long", "duration", "expires_in", "3651d", http.StatusUnprocessableEntity},
+		{"Date", "date", "expires_at", time.Now().UTC().AddDate(0, 1, 0).Format("2006-01-02T15:04"), http.StatusSeeOther},
+		{"Past date", "date", "expires_at", "2001-01-01T00:00", http.StatusUnprocessableEntity},
+		{"Unknown lifetime", "forever", "", "", http.StatusUnprocessableEntity},
+		{"Keep on create", "keep", "", "", http.StatusUnprocessableEntity},
+	}
+	for _, tt := range createTests {
+		t.Run(tt.name, func(t *testing.T) {
+			form := url.Values{}
+			form.Add("csrf_token", csrfToken)
+			form.Add("title", "Haiku")
+			form.Add("content", "An old silent pond")
+			form.Add("visibility", "public")
+			form.Add("lifetime", tt.lifetime)
+			if tt.field != "" {
+				form.Add(tt.field, tt.value)
+			}
+			code, _, _ := ts.postForm(t, "/note/create", form)
+			assert.Equal(t, code, tt.wantCode)
+		})
+	}
+
+	t.Run("Keep on edit", func(t *testing.T) {
+		note, err := app.notes.Get("550e8400-e29b-41d4-a716-446655440000", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		form := url.Values{}
+		form.Add("csrf_token", csrfToken)
+		form.Add("id", note.ID)
+		form.Add("version", strconv.Itoa(note.Version))
+		form.Add("title", "Haiku")
+		form.Add("content", "An old silent pond")
+		form.Add("visibility", "public")
+		form.Add("lifetime", "keep")
+		// The date field only shows the expiry to the minute.
+		form.Add("expires_at", note.Expires.UTC().Format("2006-01-02T15:04"))
+		code, _, _ := ts.postForm(t, "/note/create", form)
+		assert.Equal(t, code, http.StatusSeeOther)
+		assert.Equal(t, notes.updated().Equal(note.Expires), true)
+	})
+
+	extendTests := []struct {
+		name     string
+		urlPath  string
+		extendBy string
+		wantCode int
+	}{
+		{"Extend", "/note/expiry/550e8400-e29b-41d4-a716-446655440000", "7d", http.StatusSeeOther},
+		{"Never expire", "/note/expiry/550e8400-e29b-41d4-a716-446655440000", "never", http.StatusSeeOther},
+		{"Invalid extension", "/note/expiry/550e8400-e29b-41d4-a716-446655440000", "3d", http.StatusUnprocessableEntity},
+		{"Missing note", "/note/expiry/550e8400-e29b-41d4-a716-446655440999", "7d", http.StatusNotFound},
+	}
+	for _, tt := range extendTests {
+		t.Run(tt.name, func(t *testing.T) {
+			form := url.Values{}
+			form.Add("csrf_token", csrfToken)
+			form.Add("extend_by", tt.extendBy)
+			code, _, _ := ts.postForm(t, tt.urlPath, form)
+			assert.Equal(t, code, tt.wantCode)
+		})
+	}
+}
+
+func TestNoteEditConflict(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	ts.login(t, "alice@example.com", "pa$$word")
+
+	code, _, body := ts.get(t, "/note/edit/550e8400-e29b-41d4-a716-446655440000")
+	assert.Equal(t, code, http.StatusOK)
+	assert.StringContains(t, body, "<input type='hidden' name='version' value='2'>")
+	csrfToken := extractCSRFToken(t, body)
+
+	edit := func(version string) (int, string) {
+		form := url.Values{}
+		form.Add("csrf_token", csrfToken)
+		form.Add("id", "550e8400-e29b-41d4-a716-446655440000")
+		form.Add("version", version)
+		form.Add("title", "An old silent pond")
+		form.Add("content", "A frog jumps in")
+		form.Add("visibility", "public")
+		form.Add("lifetime", "7")
+		code, _, body := ts.postForm(t, "/note/create", form)
+		return code, body
+	}
+
+	t.Run("Current version", func(t *testing.T) {
+		code, _ := edit("2")
+		assert.Equal(t, code, http.StatusSeeOther)
+	})
+
+	t.Run("Stale version", func(t *testing.T) {
+		code, body := edit("1")
+		assert.Equal(t, code, http.StatusConflict)
+		assert.StringContains(t, body, "This note was changed while you were editing it")
+		assert.StringContains(t, body, "<input type='hidden' name='version' value='2'>")
+		assert.StringContains(t, body, "&lt;&lt;&lt;&lt;&lt;&lt;&lt; saved version\nAn old silent pond...\n=======\nA frog jumps in\n&gt;&gt;&gt;&gt;&gt;&gt;&gt; your version")
+	})
+}
+
+func TestNotebooks(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	ts.login(t, "alice@example.com", "pa$$word")
+
+	code, _, body := ts.get(t, "/my-notes")
+	assert.Equal(t, code, http.StatusOK)
+	assert.StringContains(t, body, "<a href='/my-notes?notebook=1' >Poems <span class=\"notebook-count\">2</span></a>")
+	assert.StringContains(t, body, "<option value='2'>\u00a0\u00a0\u00a0Haiku</option>")
+	assert.StringContains(t, body, "<input type='checkbox' name='note_id' value='550e8400-e29b-41d4-a716-446655440000' form='move-notes'")
+	csrfToken := extractCSRFToken(t, body)
+
+	code, _, _ = ts.get(t, "/my-notes?notebook=x")
+	assert.Equal(t, code, http.StatusBadRequest)
+
+	code, _, body = ts.get(t, "/note/create")
+	assert.Equal(t, code, http.StatusOK)
+	assert.StringContains(t, body, "<select name='notebook_id'>")
+
+	tests := []struct {
+		name     string
+		urlPath  string
+		fields   url.Values
+		wantCode int
+		wantBody string
+	}{
+		{"Create", "/notebooks/create", url.Values{"name": {"Recipes"}, "parent_id": {"1"}}, http.StatusSeeOther, ""},
+		{"Create blank", "/notebooks/create", url.Values{"name": {" "}}, http.StatusUnprocessableEntity, "This field cannot be blank"},
+		{"Create in unknown parent", "/notebooks/create", url.Values{"name": {"Recipes"}, "parent_id": {"99"}}, http.StatusUnprocessableEntity, "This field must be one of your notebooks"},
+		{"Move", "/notebooks/move", url.Values{"note_id": {"550e8400-e29b-41d4-a716-446655440000", "550e8400-e29b-41d4-a716-446655440003"}, "notebook_id": {"2"}}, http.StatusSeeOther, ""},
+		{"Move out", "/notebooks/move", url.Values{"note_id": {"550e8400-e29b-41d4-a716-446655440000"}, "notebook_id": {"0"}}, http.StatusSeeOther, ""},
+		{"Move nothing", "/notebooks/move", url.Values{"notebook_id": {"2"}}, http.StatusUnprocessableEntity, "Select the notes to move"},
+		{"Move to unknown notebook", "/notebooks/move", url.Values{"note_id": {"550e8400-e29b-41d4-a716-446655440000"}, "notebook_id": {"99"}}, http.StatusUnprocessableEntity, "This field must be one of your notebooks"},
+		{"Move invalid note", "/notebooks/move", url.Values{"note_id": {"foo"}, "notebook_id": {"2"}}, http.StatusBadRequest, ""},
+		{"Delete", "/notebooks/delete/1", url.Values{}, http.StatusSeeOther, ""},
+		{"Delete unknown", "/notebooks/delete/99", url.Values{}, http.StatusNotFound, ""},
+		{"Note in notebook", "/note/create", url.Values{"title": {"Haiku"}, "content": {"An old silent pond"}, "visibility": {"public"}, "lifetime": {"7"}, "notebook_id": {"3"}}, http.StatusSeeOther, ""},
+		{"Note in unknown notebook", "/note/create", url.Values{"title": {"Haiku"}, "content": {"An old silent pond"}, "visibility": {"public"}, "lifetime": {"7"}, "notebook_id": {"99"}}, http.StatusUnprocessableEntity, "This field must be one of your notebooks"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.fields.Add("csrf_token", csrfToken)
+			code, _, body := ts.postForm(t, tt.urlPath, tt.fields)
+			assert.Equal(t, code, tt.wantCode)
+			if tt.wantBody != "" {
+				assert.StringContains(t, body, tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestPinsAndFavorites(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	ts.login(t, "alice@example.com", "pa$$word")
+
+	code, _, body := ts.get(t, "/note/view/550e8400-e29b-41d4-a716-446655440000")
+	assert.Equal(t, code, http.StatusOK)
+	assert.StringContains(t, body, "<form action='/note/favorite/550e8400-e29b-41d4-a716-446655440000' method='POST'>")
+	assert.StringContains(t, body, "<form action='/note/pin/550e8400-e29b-41d4-a716-446655440000' method='POST'>")
+	csrfToken := extractCSRFToken(t, body)
+
+	code, _, body = ts.get(t, "/note/view/550e8400-e29b-41d4-a716-446655440003")
+	assert.Equal(t, code, http.StatusOK)
+	assert.StringContains(t, body, "★ Unstar")
+
+	code, _, body = ts.get(t, "/favorites")
+	assert.Equal(t, code, http.StatusOK)
+	assert.StringContains(t, body, "<a href='/note/view/550e8400-e29b-41d4-a716-446655440003' class=\"note-card\">")
+	assert.StringContains(t, body, `<abbr title="In your favorites" class="note-mark">★</abbr>`)
+
+	tests := []struct {
+		name     string
+		urlPath  string
+		wantCode int
+	}{
+		{"Pin", "/note/pin/550e8400-e29b-41d4-a716-446655440000", http.StatusSeeOther},
+		{"Unpin", "/note/pin/550e8400-e29b-41d4-a716-446655440000/remove", http.StatusSeeOther},
+		{"Pin missing note", "/note/pin/550e8400-e29b-41d4-a716-446655440999", http.StatusNotFound},
+		{"Star", "/note/favorite/550e8400-e29b-41d4-a716-446655440000", http.StatusSeeOther},
+		{"Unstar", "/note/favorite/550e8400-e29b-41d4-a716-446655440000/remove", http.StatusSeeOther},
+		{"Star missing note", "/note/favorite/550e8400-e29b-41d4-a716-446655440999", http.StatusNotFound},
+		{"Star invalid id", "/note/favorite/foo", http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			form := url.Values{}
+			form.Add("csrf_token", csrfToken)
+			code, _, _ := ts.postForm(t, tt.urlPath, form)
+			assert.Equal(t, code, tt.wantCode)
+		})
+	}
+
+	// Only the owner can pin a note.
+	ts.login(t, "bob@example.com", "pa$$word")
+	_, _, body = ts.get(t, "/note/view/550e8400-e29b-41d4-a716-446655440000")
+	assert.StringNotContains(t, body, "/note/pin/")
+	form := url.Values{}
+	form.Add("csrf_token", extractCSRFToken(t, body))
+	code, _, _ = ts.postForm(t, "/note/pin/550e8400-e29b-41d4-a716-446655440000", form)
+	assert.Equal(t, code, http.StatusNotFound)
+
+	// Nor can someone else's private protected note be starred.
+	code, _, _ = ts.postForm(t, "/note/favorite/550e8400-e29b-41d4-a716-446655440006", form)
+	assert.Equal(t, code, http.StatusNotFound)
+}
+
+func TestEmailVerification(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	// mail returns the emails sent so far, with the soft line breaks of
+	// their quoted-printable bodies removed.
+	mail := func(t *testing.T) string {
+		app.wg.Wait()
+		data, err := os.ReadFile(app.config.mailFile)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return strings.ReplaceAll(string(data), "=\r\n", "")
+	}
+	linkRX := regexp.MustCompile(`https://noter\.test(/user/verify/[^\s=]+)`)
+
+	_, _, body := ts.get(t, "/user/signup")
+	form := url.Values{}
+	form.Add("name", "Bob")
+	form.Add("email", "bob@example.com")
+	form.Add("password", "pa$$word")
+	form.Add("csrf_token", extractCSRFToken(t, body))
+	code, _, _ := ts.postForm(t, "/user/signup", form)
+	assert.Equal(t, code, http.StatusSeeOther)
+
+	sent := mail(t)
+	assert.StringContains(t, sent, "To: bob@example.com")
+	assert.StringContains(t, sent, "Subject: Verify your email address")
+	match := linkRX.FindStringSubmatch(sent)
+	if match == nil {
+		t.Fatalf("no verification link in %q", sent)
+	}
+	link := match[1]
+
+	// Unverified users can write private notes, but not publish them.
+	ts.login(t, "bob@example.com", "pa$$word")
+	_, _, body = ts.get(t, "/account/view")
+	assert.StringContains(t, body, "Not verified")
+	csrfToken := extractCSRFToken(t, body)
+
+	note := url.Values{}
+	note.Add("csrf_token", csrfToken)
+	note.Add("title", "Hello")
+	note.Add("content", "World")
+	note.Add("expires", "7")
+	note.Add("visibility", "public")
+	code, _, body = ts.postForm(t, "/note/create", note)
+	assert.Equal(t, code, http.StatusUnprocessableEntity)
+	assert.StringContains(t, body, "Verify your email address to publish public notes")
+	note.Set("visibility", "private")
+	code, _, _ = ts.postForm(t, "/note/create", note)
+	assert.Equal(t, code, http.StatusSeeOther)
+
+	code, _, body = ts.doJSON(t, http.MethodPost, "/api/v1/notes", `{"title": "Hello", "content": "World", "expires": 7, "visibility": "public"}`)
+	assert.Equal(t, code, http.StatusUnprocessableEntity)
+	assert.StringContains(t, body, `"visibility": "Verify your email address to publish public notes"`)
+
+	// New links can be asked for, up to a limit.
+	resend := url.Values{}
+	resend.Add("csrf_token", csrfToken)
+	for range verificationEmails {
+		code, _, _ = ts.postForm(t, "/account/verify", resend)
+		assert.Equal(t, code, http.StatusSeeOther)
+		_, _, body = ts.get(t, "/account/view")
+		assert.StringContains(t, body, "We sent a new verification link to bob@example.com.")
+	}
+	ts.postForm(t, "/account/verify", resend)
+	_, _, body = ts.get(t, "/account/view")
+	assert.StringContains(t, body, "Too many verification emails.")
+	assert.Equal(t, strings.Count(mail(t), "Subject: Verify your email address"), 1+verificationEmails)
+
+	code, _, _ = ts.get(t, link[:len(link)-2]+"xx")
+	assert.Equal(t, code, http.StatusSeeOther)
+	_, _, body = ts.get(t, "/account/view")
+	assert.StringContains(t, body, "This verification link is invalid or has expired.")
+
+	code, headers, _ := ts.get(t, link)
+	assert.Equal(t, code, http.StatusSeeOther)
+	assert.Equal(t, headers.Get("Location"), "/account/view")
+	_, _, body = ts.get(t, "/account/view")
+	assert.StringContains(t, body, "Your email address has been verified.")
+}
+
+func TestPasswordReset(t *testing.T) {
+	app := newTestApplication(t)
+	users := &sessionGenerations{}
+	app.users = users
+	app.passwordResets = &generationBumper{users: users}
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	// Alice is logged in elsewhere, through a second server sharing the
+	// session store.
+	elsewhere := newTestServer(t, app.routes())
+	defer elsewhere.Close()
+	elsewhere.login(t, "alice@example.com", "pa$$word")
+	code, _, _ := elsewhere.get(t, "/account/view")
+	assert.Equal(t, code, http.StatusOK)
+
+	_, _, body := ts.get(t, "/user/password/forgot")
+	csrfToken := extractCSRFToken(t, body)
+
+	// Unknown addresses get the same answer, but no email.
+	for _, email := range []string{"nobody@example.com", "alice@example.com"} {
+		form := url.Values{}
+		form.Add("email", email)
+		form.Add("csrf_token", csrfToken)
+		code, headers, _ := ts.postForm(t, "/user/password/forgot", form)
+		assert.Equal(t, code, http.StatusSeeOther)
+		assert.Equal(t, headers.Get("Location"), "/user/login")
+		_, _, body = ts.get(t, "/user/login")
+		assert.StringContains(t, body, "If an account uses "+email+", we sent it a link to reset the password.")
+	}
+
+	app.wg.Wait()
+	data, err := os.ReadFile(app.config.mailFile)
+	assert.NilError(t, err)
+	sent := strings.ReplaceAll(string(data), "=\r\n", "")
+	assert.Equal(t, strings.Count(sent, "Subject: Reset your password"), 1)
+	assert.StringContains(t, sent, "To: alice@example.com")
+	assert.StringContains(t, sent, "https://noter.test/user/password/reset/MOCKRESETTOKENMOCKRESETTOKENMOCK")
+
+	code, headers, _ := ts.get(t, "/user/password/reset/unknowntoken")
+	assert.Equal(t, code, http.StatusSeeOther)
+	assert.Equal(t, headers.Get("Location"), "/user/password/forgot")
+	_, _, body = ts.get(t, "/user/password/forgot")
+	assert.StringContains(t, body, "This password reset link is invalid or has expired.")
+
+	code, _, body = ts.get(t, "/user/password/reset/validresettoken")
+	assert.Equal(t, code, http.StatusOK)
+	assert.StringContains(t, body, "<form action='/user/password/reset/validresettoken'")
+
+	form := url.Values{}
+	form.Add("newPassword", "new password")
+	form.Add("confirmNewPassword", "another password")
+	form.Add("csrf_token", extractCSRFToken(t, body))
+	code, _, body = ts.postForm(t, "/user/password/reset/validresettoken", form)
+	assert.Equal(t, code, http.StatusUnprocessableEntity)
+	assert.StringContains(t, body, "Passwords do not match")
+
+	form.Set("confirmNewPassword", "new password")
+	code, headers, _ = ts.postForm(t, "/user/password/reset/validresettoken", form)
+	assert.Equal(t, code, http.StatusSeeOther)
+	assert.Equal(t, headers.Get("Location"), "/user/login")
+	_, _, body = ts.get(t, "/user/login")
+	assert.StringContains(t, body, "Your password has been reset.")
+
+	// Resetting the password logged Alice out everywhere.
+	code, headers, _ = elsewhere.get(t, "/account/view")
+	assert.Equal(t, code, http.StatusSeeOther)
+	assert.Equal(t, headers.Get("Location"), "/user/login")
+}
+
+// sessionGenerations is a mock UserModel whose users share one session
+// generation.
+type sessionGenerations struct {
+	mocks.UserModel
+	mu         sync.Mutex
+	generation int
+}
+
+func (m *sessionGenerations) SessionGeneration(id int) (int, error) {
+	_, err := m.UserModel.SessionGeneration(id)
+	if err != nil {
+		return 0, err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.generation, nil
+}
+
+// generationBumper is a mock PasswordResetModel bumping the session
+// generation on every reset, like the real one.
+type generationBumper struct {
+	mocks.PasswordResetModel
+	users *sessionGenerations
+}
+
+func (m *generationBumper) Reset(plaintext, password string) (int, error) {
+	id, err := m.PasswordResetModel.Reset(plaintext, password)
+	if err == nil {
+		m.users.mu.Lock()
+		m.users.generation++
+		m.users.mu.Unlock()
+	}
+	return id, err
+}
+
+func TestTwoFactorLogin(t *testing.T) {
+	app := newTestApplication(t)
+
+	// submitCode logs Dana in with her password on a fresh client and
+	// enters code as the second factor.
+	submitCode := func(t *testing.T, ts *testServer, code string) (int, http.Header, string) {
+		ts.login(t, "dana@example.com", "pa$$word")
+		_, _, body := ts.get(t, "/user/login/2fa")
+		form := url.Values{}
+		form.Add("code", code)
+		form.Add("csrf_token", extractCSRFToken(t, body))
+		return ts.postForm(t, "/user/login/2fa", form)
+	}
+
+	t.Run("Code", func(t *testing.T) {
+		ts := newTestServer(t, app.routes())
+		defer ts.Close()
+
+		_, _, body := ts.get(t, "/user/login")
+		form := url.Values{}
+		form.Add("email", "dana@example.com")
+		form.Add("password", "pa$$word")
+		form.Add("csrf_token", extractCSRFToken(t, body))
+		code, headers, _ := ts.postForm(t, "/user/login", form)
+		assert.Equal(t, code, http.StatusSeeOther)
+		assert.Equal(t, headers.Get("Location"), "/user/login/2fa")
+
+		// The password alone doesn't log the session in.
+		code, headers, _ = ts.get(t, "/account/view")
+		assert.Equal(t, code, http.StatusSeeOther)
+		assert.Equal(t, headers.Get("Location"), "/user/login")
+
+		code, _, body = submitCode(t, ts, "654321")
+		assert.Equal(t, code, http.StatusUnprocessableEntity)
+		assert.StringContains(t, body, "the code is wrong or has already been used")
+
+		// The page asked for before logging in is still where the login ends.
+		code, headers, _ = submitCode(t, ts, "123456")
+		assert.Equal(t, code, http.StatusSeeOther)
+		assert.Equal(t, headers.Get("Location"), "/account/view")
+		code, _, body = ts.get(t, "/account/view")
+		assert.Equal(t, code, http.StatusOK)
+		assert.StringContains(t, body, "<a href='/account/2fa'>Manage</a>")
+	})
+
+	t.Run("Recovery code", func(t *testing.T) {
+		ts := newTestServer(t, app.routes())
+		defer ts.Close()
+
+		code, _, _ := submitCode(t, ts, "ABCDE-FGHJK")
+		assert.Equal(t, code, http.StatusUnprocessableEntity)
+		code, headers, _ := submitCode(t, ts, "abcde-fghjk")
+		assert.Equal(t, code, http.StatusSeeOther)
+		assert.Equal(t, headers.Get("Location"), "/note/create")
+		_, _, body := ts.get(t, "/note/create")
+		assert.StringContains(t, body, "You logged in with a recovery code. You have 10 left.")
+	})
+
+	t.Run("No password", func(t *testing.T) {
+		ts := newTestServer(t, app.routes())
+		defer ts.Close()
+
+		code, headers, _ := ts.get(t, "/user/login/2fa")
+		assert.Equal(t, code, http.StatusSeeOther)
+		assert.Equal(t, headers.Get("Location"), "/user/login")
+	})
+
+	t.Run("Too many wrong codes", func(t *testing.T) {
+		ts := newTestServer(t, app.routes())
+		defer ts.Close()
+
+		for range twoFactorAttempts {
+			code, _, _ := submitCode(t, ts, "000000")
+			assert.Equal(t, code, http.StatusUnprocessableEntity)
+		}
+		code, headers, _ := submitCode(t, ts, "123456")
+		assert.Equal(t, code, http.StatusSeeOther)
+		assert.Equal(t, headers.Get("Location"), "/user/login")
+		_, _, body := ts.get(t, "/user/login")
+		assert.StringContains(t, body, "Too many wrong codes.")
+	})
+}
+
+func TestTwoFactorSettings(t *testing.T) {
+	app := newTestApplication(t)
+
+	t.Run("Enable", func(t *testing.T) {
+		ts := newTestServer(t, app.routes())
+		defer ts.Close()
+		ts.login(t, "alice@example.com", "pa$$word")
+
+		_, _, body := ts.get(t, "/account/2fa")
+		assert.StringContains(t, body, `<svg class="qr-code"`)
+		match := regexp.MustCompile(`<code class='two-factor-secret'>([A-Z2-7]+)</code>`).FindStringSubmatch(body)
+		if match == nil {
+			t.Fatalf("no secret in %q", body)
+		}
+		secret := match[1]
+
+		// Reloading the page keeps the same secret.
+		_, _, body = ts.get(t, "/account/2fa")
+		assert.StringContains(t, body, secret)
+
+		form := url.Values{}
+		form.Add("code", "abcdef")
+		form.Add("csrf_token", extractCSRFToken(t, body))
+		code, _, body := ts.postForm(t, "/account/2fa/enable", form)
+		assert.Equal(t, code, http.StatusUnprocessableEntity)
+		assert.StringContains(t, body, "The code is wrong.")
+
+		totpCode, err := totp.Code(secret, time.Now())
+		assert.NilError(t, err)
+		form.Set("code", totpCode)
+		code, headers, _ := ts.postForm(t, "/account/2fa/enable", form)
+		assert.Equal(t, code, http.StatusSeeOther)
+		assert.Equal(t, headers.Get("Location"), "/account/2fa")
+	})
+
+	t.Run("Manage", func(t *testing.T) {
+		ts := newTestServer(t, app.routes())
+		defer ts.Close()
+		ts.login(t, "dana@example.com", "pa$$word")
+		_, _, body := ts.get(t, "/user/login/2fa")
+		form := url.Values{}
+		form.Add("code", "123456")
+		form.Add("csrf_token", extractCSRFToken(t, body))
+		ts.postForm(t, "/user/login/2fa", form)
+
+		_, _, body = ts.get(t, "/account/2fa")
+		assert.StringContains(t, body, "You have 10 unused recovery codes left.")
+
+		form = url.Values{}
+		form.Add("password", "wrong password")
+		form.Add("csrf_token", extractCSRFToken(t, body))
+		for _, action := range []string{"/account/2fa/recovery-codes", "/account/2fa/disable"} {
+			code, _, body := ts.postForm(t, action, form)
+			assert.Equal(t, code, http.StatusUnprocessableEntity)
+			assert.Equal(t, strings.Count(body, "password is wrong"), 1)
+		}
+
+		form.Set("password", "pa$$word")
+		code, headers, _ := ts.postForm(t, "/account/2fa/recovery-codes", form)
+		assert.Equal(t, code, http.StatusSeeOther)
+		assert.Equal(t, headers.Get("Location"), "/account/2fa")
+		_, _, body = ts.get(t, "/account/2fa")
+		assert.StringContains(t, body, "<li><code>abcde-fghjk</code></li>")
+		_, _, body = ts.get(t, "/account/2fa")
+		assert.StringContains(t, body, "You have 10 unused recovery codes left.")
+
+		code, headers, _ = ts.postForm(t, "/account/2fa/disable", form)
+		assert.Equal(t, code, http.StatusSeeOther)
+		assert.Equal(t, headers.Get("Location"), "/account/view")
+	})
+}
+
+func TestLoginThrottling(t *testing.T) {
+	login := func(t *testing.T, ts *testServer, email, password string) (int, http.Header, string) {
+		_, _, body := ts.get(t, "/user/login")
+		form := url.Values{}
+		form.Add("email", email)
+		form.Add("password", password)
+		form.Add("csrf_token", extractCSRFToken(t, body))
+		return ts.postForm(t, "/user/login", form)
+	}
+
+	t.Run("Locked account", func(t *testing.T) {
+		app := newTestApplication(t)
+		ts := newTestServer(t, app.routes())
+		defer ts.Close()
+
+		code, headers, body := login(t, ts, "locked@example.com", "pa$$word")
+		assert.Equal(t, code, http.StatusTooManyRequests)
+		assert.Equal(t, headers.Get("Retry-After") != "", true)
+		assert.StringContains(t, body, loginThrottledMessage)
+	})
+
+	t.Run("Reset after the second factor", func(t *testing.T) {
+		app := newTestApplication(t)
+		lockouts := &resetRecorder{}
+		app.lockouts = lockouts
+		ts := newTestServer(t, app.routes())
+		defer ts.Close()
+
+		// The right password alone doesn't forgive the failed logins.
+		code, headers, _ := login(t, ts, "dana@example.com", "pa$$word")
+		assert.Equal(t, code, http.StatusSeeOther)
+		assert.Equal(t, headers.Get("Location"), "/user/login/2fa")
+		assert.Equal(t, len(lockouts.reset()), 0)
+
+		_, _, body := ts.get(t, "/user/login/2fa")
+		form := url.Values{}
+		form.Add("code", "123456")
+		form.Add("csrf_token", extractCSRFToken(t, body))
+		code, _, _ = ts.postForm(t, "/user/login/2fa", form)
+		assert.Equal(t, code, http.StatusSeeOther)
+		assert.Equal(t, slices.Equal(lockouts.reset(), []int{3}), true)
+	})
+
+	t.Run("Client IP", func(t *testing.T) {
+		app := newTestApplication(t)
+		ts := newTestServer(t, app.routes())
+		defer ts.Close()
+
+		for range ipLoginPolicy.free + 1 {
+			code, _, body := login(t, ts, "nobody@example.com", "wrong password")
+			assert.Equal(t, code, http.StatusUnprocessableEntity)
+			assert.StringContains(t, body, "your email address or password is wrong")
+		}
+		// While the client backs off, even the right password is refused,
+		// with the same message as for a locked account.
+		code, _, body := login(t, ts, "alice@example.com", "pa$$word")
+		assert.Equal(t, code, http.StatusTooManyRequests)
+		assert.StringContains(t, body, loginThrottledMessage)
+
+		app.loginLimiter.Reset("127.0.0.1")
+		code, headers, _ := login(t, ts, "alice@example.com", "pa$$word")
+		assert.Equal(t, code, http.StatusSeeOther)
+		assert.Equal(t, headers.Get("Location"), "/note/create")
+	})
+}
+
+func TestClientIP(t *testing.T) {
+	tests := []struct {
+		name         string
+		trustProxy   bool
+		forwardedFor []string
+		wantIP       string
+	}{
+		{"Direct", false, nil, "192.0.2.1"},
+		{"Untrusted header", false, []string{"203.0.113.7"}, "192.0.2.1"},
+		{"Behind a proxy", true, []string{"203.0.113.7"}, "203.0.113.7"},
+		{"Spoofed hops", true, []string{"198.51.100.9, 203.0.113.7"}, "203.0.113.7"},
+		{"Several headers", true, []string{"198.51.100.9", "203.0.113.7"}, "203.0.113.7"},
+		{"Garbage", true, []string{"not an ip"}, "192.0.2.1"},
+		{"No header", true, nil, "192.0.2.1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApplication(t)
+			app.config.trustProxy = tt.trustProxy
+
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.RemoteAddr = "192.0.2.1:1234"
+			for _, value := range tt.forwardedFor {
+				r.Header.Add("X-Forwarded-For", value)
+			}
+			assert.Equal(t, app.clientIP(r), tt.wantIP)
+		})
+	}
+}
+
+// resetRecorder is a mock LockoutModel remembering whose failed logins were
+// reset.
+type resetRecorder struct {
+	mocks.LockoutModel
+	mu     sync.Mutex
+	resets []int
+}
+
+func (m *resetRecorder) Reset(userID int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.resets = append(m.resets, userID)
+	return nil
+}
+
+func (m *resetRecorder) reset() []int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return slices.Clone(m.resets)
+}
+
+// expiryRecorder is a mock NoteModel remembering the expiry of the last
+// update.
+type expiryRecorder struct {
+	mocks.NoteModel
+	mu      sync.Mutex
+	expires time.Time
+}
+
+func (m *expiryRecorder) Update(id string, version int, title string, content string, format string, language string, expires time.Time, public bool, createdBy int) (string, error) {
+	m.mu.Lock()
+	m.expires = expires
+	m.mu.Unlock()
+	return m.NoteModel.Update(id, version, title, content, format, language, expires, public, createdBy)
+}
+
+func (m *expiryRecorder) updated() time.Time {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.expires
+}
+
+func TestPasswordReentryThrottling(t *testing.T) {
+	tests := []struct {
+		name     string
+		email    string
+		urlPath  string
+		formPath string
+		field    string
+		extra    url.Values
+		code     string // for users with two-factor authentication
+	}{
+		{
+			name:     "Change password",
+			email:    "alice@example.com",
+			urlPath:  "/account/password/update",
+			formPath: "/account/password/update",
+			field:    "currentPassword",
+			extra:    url.Values{"newPassword": {"brand new password"}, "confirmNewPassword": {"brand new password"}},
+		},
+		{
+			name:     "Two-factor settings",
+			email:    "dana@example.com",
+			urlPath:  "/account/2fa/recovery-codes",
+			formPath: "/account/2fa",
+			field:    "password",
+			code:     "123456",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApplication(t)
+			ts := newTestServer(t, app.routes())
+			defer ts.Close()
+
+			ts.login(t, tt.email, "pa$$word")
+			if tt.code != "" {
+				_, _, body := ts.get(t, "/user/login/2fa")
+				form := url.Values{"code": {tt.code}, "csrf_token": {extractCSRFToken(t, body)}}
+				ts.postForm(t, "/user/login/2fa", form)
+			}
+			_, _, body := ts.get(t, tt.formPath)
+			csrfToken := extractCSRFToken(t, body)
+
+			submit := func(password string) (int, http.Header, string) {
+				form := url.Values{"csrf_token": {csrfToken}, tt.field: {password}}
+				for k, v := range tt.extra {
+					form[k] = v
+				}
+				return ts.postForm(t, tt.urlPath, form)
+			}
+
+			// Wrong passwords count as failed logins.
+			for range ipLoginPolicy.free + 1 {
+				code, _, body := submit("wrong password")
+				assert.Equal(t, code, http.StatusUnprocessableEntity)
+				assert.StringContains(t, body, "password is wrong")
+			}
+			code, headers, body := submit("pa$$word")
+			assert.Equal(t, code, http.StatusTooManyRequests)
+			assert.Equal(t, headers.Get("Retry-After") != "", true)
+			assert.StringContains(t, body, loginThrottledMessage)
+		})
+	}
+}
+
+func TestAdminLockouts(t *testing.T) {
+	app := newTestApplication(t)
+
+	t.Run("Not an admin", func(t *testing.T) {
+		ts := newTestServer(t, app.routes())
+		defer ts.Close()
+
+		ts.login(t, "bob@example.com", "pa$$word")
+		code, _, _ := ts.get(t, "/admin/lockouts")
+		assert.Equal(t, code, http.StatusNotFound)
+		_, _, body := ts.get(t, "/account/view")
+		assert.Equal(t, strings.Contains(body, "/admin/lockouts"), false)
+	})
+
+	t.Run("Admin", func(t *testing.T) {
+		ts := newTestServer(t, app.routes())
+		defer ts.Close()
+
+		ts.login(t, "alice@example.com", "pa$$word")
+		_, _, body := ts.get(t, "/account/view")
+		assert.StringContains(t, body, "<a href='/admin/lockouts'>Login lockouts</a>")
+
+		code, _, body := ts.get(t, "/admin/lockouts")
+		assert.Equal(t, code, http.StatusOK)
+		assert.StringContains(t, body, "bob@example.com")
+		assert.StringContains(t, body, "192.0.2.2")
+		assert.StringContains(t, body, "<form action='/admin/lockouts/1/unlock' method='POST'>")
+		assert.Equal(t, strings.Contains(body, "/admin/lockouts/2/unlock"), false)
+
+		unlock := func(id string) (int, http.Header) {
+			form := url.Values{}
+			form.Add("csrf_token", extractCSRFToken(t, body))
+			code, headers, _ := ts.postForm(t, "/admin/lockouts/"+id+"/unlock", form)
+			return code, headers
+		}
+
+		code, headers := unlock("1")
+		assert.Equal(t, code, http.StatusSeeOther)
+		assert.Equal(t, headers.Get("Location"), "/admin/lockouts")
+		_, _, body = ts.get(t, "/admin/lockouts")
+		assert.StringContains(t, body, "Lockout lifted!")
+
+		code, _ = unlock("2")
+		assert.Equal(t, code, http.StatusNotFound)
+		code, _ = unlock("x")
+		assert.Equal(t, code, http.StatusNotFound)
+	})
+}
@@ -4,10 +4,18 @@ import (
 	"bytes"
 	"errors"
 	"fmt"
+	"log/slog"
+	"math"
+	"net"
 	"net/http"
 	"runtime/debug"
+	"slices"
+	"strconv"
+	"strings"
 	"time"
 
+	"github.com/Abdelrahman-habib/noter/internal/mailer"
+	"github.com/Abdelrahman-habib/noter/internal/models"
 	"github.com/go-playground/form/v4"
 	"github.com/justinas/nosurf"
 )
@@ -53,6 +61,27 @@ func (app *application) render(w http.ResponseWriter, r *http.Request, status in
 	buf.WriteTo(w)
 }
 
+// renderFragment writes a single named template, such as a partial, without
+// the base layout. Any page's template set can be used, since they all
+// include the partials.
+func (app *application) renderFragment(w http.ResponseWriter, r *http.Request, status int, page string, name string, data any) {
+	ts, ok := app.templateCache[page]
+	if !ok {
+		err := fmt.Errorf("the template %s does not exist", page)
+		app.serverError(w, r, err)
+		return
+	}
+
+	buf := new(bytes.Buffer)
+	err := ts.ExecuteTemplate(buf, name, data)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+	w.WriteHeader(status)
+	buf.WriteTo(w)
+}
+
 func (app *application) newTemplateData(r *http.Request) templateData {
 	return templateData{
 		CurrentYear:     time.Now().Year(),
@@ -88,3 +117,395 @@ func (app *application) isAuthenticated(r *http.Request) bool {
 	}
 	return isAuthenticated
 }
+
+// authenticatedUserID returns the ID of the user making the request, whether
+// they signed in through the session or with a bearer token, or 0 for
+// anonymous requests.
+func (app *application) authenticatedUserID(r *http.Request) int {
+	id, ok := r.Context().Value(authenticatedUserIDContextKey).(int)
+	if !ok {
+		return 0
+	}
+	return id
+}
+
+// completeLogin logs the session in as the user with the given id and sends
+// them on to the page they were trying to reach, if any.
+func (app *application) completeLogin(w http.ResponseWriter, r *http.Request, id int) {
+	// The failed logins are only forgiven once every factor is right.
+	if err := app.lockouts.Reset(id); err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+	if err := app.sessionManager.RenewToken(r.Context()); err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+	generation, err := app.users.SessionGeneration(id)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "authenticatedUserID", id)
+	app.sessionManager.Put(r.Context(), "sessionGeneration", generation)
+	path := app.sessionManager.PopString(r.Context(), "redirectPathAfterLogin")
+	if path != "" {
+		http.Redirect(w, r, path, http.StatusSeeOther)
+		return
+	}
+	http.Redirect(w, r, "/note/create", http.StatusSeeOther)
+}
+
+// twoFactorUserID returns the ID of the user who entered their password but
+// still has to enter a code to log in, or 0 when there is no such login or it
+// has expired.
+func (app *application) twoFactorUserID(r *http.Request) int {
+	if time.Now().Unix() >= app.sessionManager.GetInt64(r.Context(), "twoFactorExpires") {
+		return 0
+	}
+	return app.sessionManager.GetInt(r.Context(), "twoFactorUserID")
+}
+
+// authScope returns the scope granted to the request. Session logins can do
+// everything their user can; bearer tokens are limited to the scope they were
+// minted with.
+func (app *application) authScope(r *http.Request) string {
+	scope, ok := r.Context().Value(authScopeContextKey).(string)
+	if !ok {
+		return ""
+	}
+	return scope
+}
+
+// readTagFilter returns the normalized ?tag= query parameter, or "".
+func (app *application) readTagFilter(r *http.Request) string {
+	return strings.ToLower(strings.TrimSpace(r.URL.Query().Get("tag")))
+}
+
+// readNotebookFilter returns the notebook id from the ?notebook= query
+// parameter, or zero when there is none.
+func (app *application) readNotebookFilter(r *http.Request) (int, error) {
+	notebook := r.URL.Query().Get("notebook")
+	if notebook == "" {
+		return 0, nil
+	}
+	id, err := strconv.Atoi(notebook)
+	if err != nil || id < 1 {
+		return 0, errors.New("notebook must be a positive integer")
+	}
+	return id, nil
+}
+
+// readSort returns the sort order from the ?sort= query parameter, or "" for
+// the default one.
+func (app *application) readSort(r *http.Request) (string, error) {
+	sort := r.URL.Query().Get("sort")
+	if sort != "" && !slices.Contains(models.NoteSorts, sort) {
+		return "", fmt.Errorf("sort must be one of %s", strings.Join(models.NoteSorts, ", "))
+	}
+	return sort, nil
+}
+
+// attachTags loads the tags of every note in notes in a single query.
+func (app *application) attachTags(notes []models.NoteWithUsername) error {
+	ids := make([]string, len(notes))
+	for i := range notes {
+		ids[i] = notes[i].ID
+	}
+
+	tags, err := app.tags.GetForNotes(ids...)
+	if err != nil {
+		return err
+	}
+
+	for i := range notes {
+		notes[i].Tags = tags[notes[i].ID]
+	}
+	return nil
+}
+
+func (app *application) attachNoteTags(note *models.NoteWithUsername) error {
+	tags, err := app.tags.GetForNotes(note.ID)
+	if err != nil {
+		return err
+	}
+	note.Tags = tags[note.ID]
+	return nil
+}
+
+// canEdit reports whether userID may change the content of note, either as its
+// owner or through an edit grant.
+func (app *application) canEdit(note models.NoteWithUsername, userID int) (bool, error) {
+	if userID == 0 {
+		return false, nil
+	}
+	if note.CreatedBy == userID {
+		return true, nil
+	}
+	permission, err := app.noteShares.Permission(note.ID, userID)
+	if err != nil {
+		return false, err
+	}
+	return permission == models.PermissionEdit, nil
+}
+
+// noteUnlocked reports whether userID may read note without entering its
+// password: because it isn't protected, they own it or it is shared with
+// them, or they already entered the password in this session.
+func (app *application) noteUnlocked(r *http.Request, note models.NoteWithUsername, userID int) (bool, error) {
+	if !note.Protected || note.CreatedBy == userID || app.sessionManager.GetBool(r.Context(), unlockedNoteKey(note.ID)) {
+		return true, nil
+	}
+	if userID == 0 {
+		return false, nil
+	}
+	permission, err := app.noteShares.Permission(note.ID, userID)
+	if err != nil {
+		return false, err
+	}
+	return permission != "", nil
+}
+
+// unlockedNoteKey is the session key recording that a protected note's
+// password has been entered.
+func unlockedNoteKey(id string) string {
+	return "unlockedNote:" + id
+}
+
+// expiryDateLayout is the format of note expiry dates in forms, the one used
+// by datetime-local inputs. The times are in UTC.
+const expiryDateLayout = "2006-01-02T15:04"
+
+// parseLifetime parses a note lifetime: a Go duration such as 90m or 36h, or
+// a whole number of days or weeks such as 10d or 2w.
+func parseLifetime(s string) (time.Duration, error) {
+	s = strings.TrimSpace(s)
+	var unit time.Duration
+	switch {
+	case strings.HasSuffix(s, "d"):
+		unit = 24 * time.Hour
+	case strings.HasSuffix(s, "w"):
+		unit = 7 * 24 * time.Hour
+	default:
+		return time.ParseDuration(s)
+	}
+	count, err := strconv.Atoi(s[:len(s)-1])
+	if err != nil {
+		return 0, err
+	}
+	return time.Duration(count) * unit, nil
+}
+
+// parseExpiryDate parses an absolute expiry, either in expiryDateLayout or,
+// from API clients, RFC 3339.
+func parseExpiryDate(s string) (time.Time, error) {
+	s = strings.TrimSpace(s)
+	t, err := time.Parse(expiryDateLayout, s)
+	if err != nil {
+		t, err = time.Parse(time.RFC3339, s)
+	}
+	return t, err
+}
+
+// shareURL returns the absolute URL of a share link, for its owner to copy.
+// Like the links sent by email it points at -base-url: behind a proxy the
+// request's scheme is the proxy's, and its Host header is up to the client.
+func (app *application) shareURL(token string) string {
+	return app.config.baseURL + "/s/" + token
+}
+
+// readPage returns the ?page= query parameter, defaulting to 1.
+func (app *application) readPage(r *http.Request) (int, error) {
+	page := r.URL.Query().Get("page")
+	if page == "" {
+		return 1, nil
+	}
+	pageInt, err := strconv.Atoi(page)
+	if err != nil || pageInt < 1 {
+		return 0, errors.New("page must be a positive integer")
+	}
+	return pageInt, nil
+}
+
+// background runs fn in its own goroutine, tracked by app.wg so a graceful
+// shutdown waits for it to return. A panic in fn is logged instead of taking
+// the whole process down.
+func (app *application) background(fn func()) {
+	app.backgroundTasks.Add(1)
+	app.wg.Go(func() {
+		defer app.backgroundTasks.Add(-1)
+		defer func() {
+			if err := recover(); err != nil {
+				app.logger.Error(fmt.Sprintf("background task panicked: %v", err))
+			}
+		}()
+		fn()
+	})
+}
+
+// purposeVerifyEmail is what the tokens in email verification links are
+// signed for.
+const purposeVerifyEmail = "verify-email"
+
+// sendVerificationEmail mails user a link verifying their email address. It
+// is sent in the background, so that a slow mail server doesn't hold up the
+// request, and failures are only logged.
+func (app *application) sendVerificationEmail(user models.User) {
+	token := app.signer.Sign(purposeVerifyEmail, time.Now().Add(emailVerificationTTL), strconv.Itoa(user.ID), user.Email)
+	msg := mailer.Message{
+		To:      user.Email,
+		Subject: "Verify your email address",
+		Body: fmt.Sprintf("Hi %s,\n\n"+
+			"Please confirm that this is your email address by opening the link below\n"+
+			"within %s:\n\n"+
+			"%s/user/verify/%s\n\n"+
+			"Until then you can write private notes, but not publish public ones.\n"+
+			"If you didn't sign up for Noter, you can ignore this email.\n",
+			user.Name, humanDuration(emailVerificationTTL), app.config.baseURL, token),
+	}
+
+	app.background(func() {
+		err := app.mailer.Send(msg)
+		if err != nil {
+			app.logger.Error("sending verification email failed", slog.Int("user_id", user.ID), slog.String("error", err.Error()))
+		}
+	})
+}
+
+// canPublish reports whether userID may make public the note with the given
+// id, or a new note when id is empty. Only users who have verified their email
+// address can, except when they save someone else's note, whose visibility
+// they can't change anyway.
+func (app *application) canPublish(userID int, id string) (bool, error) {
+	user, err := app.users.GetByID(userID)
+	if err != nil {
+		return false, err
+	}
+	if user.EmailVerified || id == "" {
+		return user.EmailVerified, nil
+	}
+
+	note, err := app.notes.Get(id, &userID)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			// Saving the note will fail with a 404 anyway.
+			return true, nil
+		}
+		return false, err
+	}
+	return note.CreatedBy != userID, nil
+}
+
+// sendPasswordResetEmail mails user the link to reset their password with
+// token. Like verification emails, it is sent in the background.
+func (app *application) sendPasswordResetEmail(user models.User, token string) {
+	msg := mailer.Message{
+		To:      user.Email,
+		Subject: "Reset your password",
+		Body: fmt.Sprintf("Hi %s,\n\n"+
+			"Someone asked to reset the password of your Noter account. To choose a\n"+
+			"new one, open the link below within %d minutes:\n\n"+
+			"%s/user/password/reset/%s\n\n"+
+			"The link works once. Resetting your password logs you out everywhere.\n"+
+			"If you didn't ask for this, you can ignore this email.\n",
+			user.Name, int(passwordResetTTL.Minutes()), app.config.baseURL, token),
+	}
+
+	app.background(func() {
+		err := app.mailer.Send(msg)
+		if err != nil {
+			app.logger.Error("sending password reset email failed", slog.Int("user_id", user.ID), slog.String("error", err.Error()))
+		}
+	})
+}
+
+// clientIP returns the IP address a request came from. Behind a reverse proxy
+// that is the proxy's, unless -trust-proxy takes it from the last address the
+// proxy appended to X-Forwarded-For; the ones before it are up to the client.
+func (app *application) clientIP(r *http.Request) string {
+	if app.config.trustProxy {
+		forwarded := r.Header.Values("X-Forwarded-For")
+		if len(forwarded) > 0 {
+			hops := strings.Split(forwarded[len(forwarded)-1], ",")
+			if ip := net.ParseIP(strings.TrimSpace(hops[len(hops)-1])); ip != nil {
+				return ip.String()
+			}
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// loginThrottled reports whether the account with the given email or the
+// client IP is backing off from failed logins, in which case it sets the
+// Retry-After header. The password must not be checked then.
+func (app *application) loginThrottled(w http.ResponseWriter, r *http.Request, email string) (bool, error) {
+	lockedUntil, err := app.lockouts.LockedUntil(email)
+	if err != nil {
+		return false, err
+	}
+	wait := max(app.loginLimiter.Wait(app.clientIP(r)), time.Until(lockedUntil))
+	if wait <= 0 {
+		return false, nil
+	}
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+	return true, nil
+}
+
+// recordLoginFailure counts a failed login against the client IP and, if it
+// exists, the account with the given email, backing both off as their
+// policies say. Account lockouts are recorded for the admins to see.
+func (app *application) recordLoginFailure(email, ip string) error {
+	app.loginLimiter.Fail(ip)
+
+	userID, failures, err := app.lockouts.Fail(email, loginFailureMemory)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			return nil
+		}
+		return err
+	}
+	wait := accountLoginPolicy.wait(failures)
+	if wait == 0 {
+		return nil
+	}
+	until := time.Now().Add(wait)
+	err = app.lockouts.Lock(userID, until)
+	if err != nil {
+		return err
+	}
+	if failures >= accountLoginPolicy.lockAfter {
+		_, err = app.lockouts.Record(userID, ip, failures, until)
+		if err != nil {
+			return err
+		}
+		app.logger.Warn("account locked out after failed logins", slog.Int("user_id", userID), slog.String("ip", ip), slog.Int("failures", failures))
+	}
+	return nil
+}
+
+// hasNotebook reports whether id is one of notebooks.
+func hasNotebook(notebooks []models.Notebook, id int) bool {
+	return slices.ContainsFunc(notebooks, func(n models.Notebook) bool {
+		return n.ID == id
+	})
+}
+
+// favoritesFor reports which of notes the authenticated user has starred, for
+// notes-grid. It returns nil for anonymous requests.
+func (app *application) favoritesFor(r *http.Request, notes []models.NoteWithUsername) (map[string]bool, error) {
+	userID := app.authenticatedUserID(r)
+	if userID == 0 {
+		return nil, nil
+	}
+
+	ids := make([]string, len(notes))
+	for i := range notes {
+		ids[i] = notes[i].ID
+	}
+	return app.favorites.GetForNotes(userID, ids...)
+}
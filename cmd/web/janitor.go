@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"time"
+)
+
+// A janitorTask deletes up to limit rows of one kind of stale data and
+// reports how many it removed.
+type janitorTask struct {
+	name string
+	run  func(limit int) (int64, error)
+}
+
+// runJanitor deletes expired notes, notes past the trash retention period,
+// expired sessions, share links that can no longer be opened and expired
+// password reset links, once at startup and then every janitorInterval, until
+// ctx is cancelled.
+func (app *application) runJanitor(ctx context.Context) {
+	app.logger.Info("starting janitor", slog.Duration("interval", app.config.janitorInterval))
+
+	ticker := time.NewTicker(app.config.janitorInterval)
+	defer ticker.Stop()
+
+	for {
+		app.sweep(ctx)
+
+		select {
+		case <-ctx.Done():
+			app.logger.Info("janitor stopped")
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// sweep runs every janitor task in batches of janitorBatchSize until a batch
+// comes back short, so a large backlog never holds locks for long. It returns
+// the number of rows removed per task.
+func (app *application) sweep(ctx context.Context) map[string]int64 {
+	tasks := []janitorTask{
+		{name: "expired notes", run: app.notes.DeleteExpired},
+		{name: "trashed notes", run: func(limit int) (int64, error) {
+			return app.notes.PurgeTrash(app.config.trashRetention, limit)
+		}},
+		{name: "expired sessions", run: app.sessions.DeleteExpired},
+		{name: "expired share links", run: app.shareLinks.DeleteExpired},
+		{name: "expired password resets", run: app.passwordResets.DeleteExpired},
+	}
+
+	limit := app.config.janitorBatchSize
+	removed := make(map[string]int64, len(tasks))
+	for _, task := range tasks {
+		for ctx.Err() == nil {
+			n, err := task.run(limit)
+			if err != nil {
+				app.logger.Error("janitor task failed", slog.String("task", task.name), slog.String("error", err.Error()))
+				break
+			}
+			removed[task.name] += n
+			if n < int64(limit) {
+				break
+			}
+		}
+		if removed[task.name] > 0 {
+			app.logger.Info("janitor removed rows", slog.String("task", task.name), slog.Int64("rows", removed[task.name]))
+		}
+	}
+	return removed
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Abdelrahman-habib/noter/internal/assert"
+	"github.com/Abdelrahman-habib/noter/internal/models/mocks"
+)
+
+// backlogNoteModel reports a backlog of expired notes that takes several
+// batches to clear.
+type backlogNoteModel struct {
+	mocks.NoteModel
+	backlog int64
+	calls   int
+}
+
+func (m *backlogNoteModel) DeleteExpired(limit int) (int64, error) {
+	m.calls++
+	n := min(m.backlog, int64(limit))
+	m.backlog -= n
+	return n, nil
+}
+
+func TestJanitorSweep(t *testing.T) {
+	app := newTestApplication(t)
+	notes := &backlogNoteModel{backlog: 230}
+	app.notes = notes
+
+	removed := app.sweep(context.Background())
+	assert.Equal(t, removed["expired notes"], 230)
+	assert.Equal(t, removed["expired sessions"], 0)
+	assert.Equal(t, notes.calls, 3)
+}
+
+func TestJanitorStops(t *testing.T) {
+	app := newTestApplication(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		app.runJanitor(ctx)
+		close(done)
+	}()
+	cancel()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("janitor did not stop after its context was cancelled")
+	}
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// attemptLimiter counts failed attempts per key, such as wrong passwords for
+// a note, and refuses further attempts once a key has failed max times within
+// window. The counts are kept in memory, so they are per process and reset on
+// restart.
+type attemptLimiter struct {
+	mu       sync.Mutex
+	max      int
+	window   time.Duration
+	failures map[string]attemptWindow
+}
+
+type attemptWindow struct {
+	count   int
+	started time.Time
+}
+
+func newAttemptLimiter(maxFailures int, window time.Duration) *attemptLimiter {
+	return &attemptLimiter{
+		max:      maxFailures,
+		window:   window,
+		failures: make(map[string]attemptWindow),
+	}
+}
+
+// Allow reports whether key may make another attempt.
+func (l *attemptLimiter) Allow(key string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	w, ok := l.failures[key]
+	if !ok || time.Since(w.started) >= l.window {
+		return true
+	}
+	return w.count < l.max
+}
+
+// Fail records a failed attempt for key.
+func (l *attemptLimiter) Fail(key string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	w, ok := l.failures[key]
+	if !ok || now.Sub(w.started) >= l.window {
+		// Drop the windows that have run out while we are here, so the map
+		// doesn't grow with every key ever tried.
+		for k, w := range l.failures {
+			if now.Sub(w.started) >= l.window {
+				delete(l.failures, k)
+			}
+		}
+		w = attemptWindow{started: now}
+	}
+	w.count++
+	l.failures[key] = w
+}
+
+// Reset forgets the failed attempts of key, after a successful one.
+func (l *attemptLimiter) Reset(key string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	delete(l.failures, key)
+}
+
+// A backoffPolicy lets a key fail free times in a row, then makes it wait
+// twice as long after every further failure, starting at a second and up to
+// maxWait. Unless lockAfter is zero, that many failures lock it out for the
+// lockout duration.
+type backoffPolicy struct {
+	free      int
+	maxWait   time.Duration
+	lockAfter int
+	lockout   time.Duration
+}
+
+// wait returns how long a key has to wait after its failures-th failure in
+// a row.
+func (p backoffPolicy) wait(failures int) time.Duration {
+	switch {
+	case failures <= p.free:
+		return 0
+	case p.lockAfter > 0 && failures >= p.lockAfter:
+		return p.lockout
+	}
+	wait := time.Second
+	for i := p.free + 1; i < failures && wait < p.maxWait; i++ {
+		wait *= 2
+	}
+	return min(wait, p.maxWait)
+}
+
+// backoffLimiter applies a backoffPolicy to keys, such as client IPs, in
+// memory. A key's failures are forgotten once it hasn't failed for forget.
+// Like attemptLimiter, it is per process and resets on restart.
+type backoffLimiter struct {
+	mu     sync.Mutex
+	policy backoffPolicy
+	forget time.Duration
+	keys   map[string]backoffState
+}
+
+type backoffState struct {
+	failures int
+	last     time.Time
+	until    time.Time
+}
+
+func newBackoffLimiter(policy backoffPolicy, forget time.Duration) *backoffLimiter {
+	return &backoffLimiter{
+		policy: policy,
+		forget: forget,
+		keys:   make(map[string]backoffState),
+	}
+}
+
+// Wait returns how long key still has to wait before its next attempt, or
+// zero when it may go ahead.
+func (l *backoffLimiter) Wait(key string) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return max(time.Until(l.keys[key].until), 0)
+}
+
+// Fail records a failed attempt for key and returns how many it has made in
+// a row, and until when it has to wait.
+func (l *backoffLimiter) Fail(key string) (int, time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	s, ok := l.keys[key]
+	if !ok || now.Sub(s.last) >= l.forget {
+		// As in attemptLimiter, drop the keys that have been forgotten.
+		for k, s := range l.keys {
+			if now.Sub(s.last) >= l.forget && !now.Before(s.until) {
+				delete(l.keys, k)
+			}
+		}
+		s = backoffState{}
+	}
+	s.failures++
+	s.last = now
+	s.until = now.Add(l.policy.wait(s.failures))
+	l.keys[key] = s
+	return s.failures, s.until
+}
+
+// Reset forgets the failed attempts of key.
+func (l *backoffLimiter) Reset(key string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	delete(l.keys, key)
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Abdelrahman-habib/noter/internal/assert"
+)
+
+func TestAttemptLimiter(t *testing.T) {
+	l := newAttemptLimiter(2, time.Hour)
+
+	assert.Equal(t, l.Allow("a"), true)
+	l.Fail("a")
+	assert.Equal(t, l.Allow("a"), true)
+	l.Fail("a")
+	assert.Equal(t, l.Allow("a"), false)
+	assert.Equal(t, l.Allow("b"), true)
+
+	l.Reset("a")
+	assert.Equal(t, l.Allow("a"), true)
+
+	expired := newAttemptLimiter(1, -time.Second)
+	expired.Fail("a")
+	assert.Equal(t, expired.Allow("a"), true)
+}
+
+func TestBackoffPolicy(t *testing.T) {
+	p := backoffPolicy{free: 2, maxWait: time.Hour, lockAfter: 6, lockout: time.Hour}
+
+	want := []time.Duration{0, 0, 0, time.Second, 2 * time.Second, 4 * time.Second, time.Hour, time.Hour}
+	for failures, wait := range want {
+		assert.Equal(t, p.wait(failures), wait)
+	}
+
+	// Long runs of failures are capped at the longest wait, without
+	// overflowing.
+	assert.Equal(t, backoffPolicy{free: 0, maxWait: time.Hour, lockAfter: 200, lockout: time.Hour}.wait(150), time.Hour)
+
+	// Without lockAfter the waits never go past maxWait.
+	backoffOnly := backoffPolicy{free: 2, maxWait: 3 * time.Second}
+	want = []time.Duration{0, 0, 0, time.Second, 2 * time.Second, 3 * time.Second, 3 * time.Second}
+	for failures, wait := range want {
+		assert.Equal(t, backoffOnly.wait(failures), wait)
+	}
+	assert.Equal(t, backoffOnly.wait(1000), 3*time.Second)
+}
+
+func TestBackoffLimiter(t *testing.T) {
+	l := newBackoffLimiter(backoffPolicy{free: 1, maxWait: time.Hour, lockAfter: 3, lockout: time.Hour}, time.Hour)
+
+	failures, until := l.Fail("a")
+	assert.Equal(t, failures, 1)
+	assert.Equal(t, l.Wait("a"), 0)
+
+	failures, until = l.Fail("a")
+	assert.Equal(t, failures, 2)
+	assert.Equal(t, l.Wait("a") > 0, true)
+	assert.Equal(t, until.After(time.Now()), true)
+	assert.Equal(t, l.Wait("b"), 0)
+
+	l.Reset("a")
+	assert.Equal(t, l.Wait("a"), 0)
+
+	forgetful := newBackoffLimiter(backoffPolicy{free: 0, maxWait: time.Hour, lockAfter: 3, lockout: time.Hour}, -time.Second)
+	forgetful.Fail("a")
+	failures, _ = forgetful.Fail("a")
+	assert.Equal(t, failures, 1)
+}
@@ -1,17 +1,27 @@
 package main
 
 import (
+	"crypto/rand"
 	"database/sql"
+	"log/slog"
 	"os"
 	"time"
 
+	schema "github.com/Abdelrahman-habib/noter/db/schema"
+
 	"github.com/Abdelrahman-habib/noter/internal/logger"
+	"github.com/Abdelrahman-habib/noter/internal/mailer"
 	"github.com/Abdelrahman-habib/noter/internal/models"
 	"github.com/alexedwards/scs/mysqlstore"
+	"github.com/alexedwards/scs/postgresstore"
+	"github.com/alexedwards/scs/sqlite3store"
 	"github.com/alexedwards/scs/v2"
 	"github.com/go-playground/form/v4"
+	"github.com/pressly/goose/v3"
 
 	_ "github.com/go-sql-driver/mysql"
+	_ "github.com/jackc/pgx/v5/stdlib"
+	_ "modernc.org/sqlite"
 )
 
 func main() {
@@ -25,43 +35,117 @@ func main() {
 	}
 
 	// Build the DSN with safe parameter handling
-	dsn, err := buildDSN(config.dsn)
+	dsn, err := buildDSN(config.dbDialect, config.dsn)
 	if err != nil {
 		logger.Error(err.Error())
 		os.Exit(1)
 	}
 
-	db, err := openDB(dsn)
+	db, err := openDB(config.dbDialect, dsn)
 	if err != nil {
 		logger.Error(err.Error())
 		os.Exit(1)
 	}
 
+	// A SQLite database is a single local file that nobody else manages, so
+	// it is brought up to date with the embedded migrations on every start.
+	if config.dbDialect == models.SQLite {
+		err = migrateDB(db, config.dbDialect, logger)
+		if err != nil {
+			logger.Error(err.Error())
+			db.Close()
+			os.Exit(1)
+		}
+	}
+
 	sessionManager := scs.New()
-	sessionManager.Store = mysqlstore.New(db)
+	// Expired sessions are removed by the janitor, in batches, alongside
+	// expired notes, so the store's own cleanup goroutine is disabled.
+	switch config.dbDialect {
+	case models.Postgres:
+		sessionManager.Store = postgresstore.NewWithCleanupInterval(db, 0)
+	case models.SQLite:
+		sessionManager.Store = sqlite3store.NewWithCleanupInterval(db, 0)
+	default:
+		sessionManager.Store = mysqlstore.NewWithCleanupInterval(db, 0)
+	}
 	sessionManager.Lifetime = 12 * time.Hour
 	sessionManager.Cookie.Secure = true
 
-	defer db.Close()
+	secretKey := []byte(config.secretKey)
+	if len(secretKey) == 0 {
+		secretKey = make([]byte, 32)
+		rand.Read(secretKey)
+		logger.Warn("no secret key set, links sent by email stop working on restart")
+	}
+
+	var mail mailer.Mailer
+	switch {
+	case config.smtpHost != "":
+		mail = mailer.NewSMTP(config.smtpHost, config.smtpPort, config.smtpUsername, config.smtpPassword, config.mailSender)
+	case config.mailFile != "":
+		mail = mailer.NewFile(config.mailFile, config.mailSender)
+	default:
+		mail = mailer.NewLog(logger, config.mailSender)
+	}
 
 	app := &application{
-		logger:         logger,
-		config:         config,
-		templateCache:  templateCache,
-		notes:          &models.NoteModel{DB: db},
-		users:          &models.UserModel{DB: db},
-		formDecoder:    form.NewDecoder(),
-		sessionManager: sessionManager,
+		logger:               logger,
+		config:               config,
+		templateCache:        templateCache,
+		notes:                &models.NoteModel{DB: db, Dialect: config.dbDialect},
+		users:                &models.UserModel{DB: db, Dialect: config.dbDialect},
+		tokens:               &models.TokenModel{DB: db, Dialect: config.dbDialect},
+		tags:                 &models.TagModel{DB: db, Dialect: config.dbDialect},
+		revisions:            &models.RevisionModel{DB: db, Dialect: config.dbDialect},
+		shareLinks:           &models.ShareLinkModel{DB: db, Dialect: config.dbDialect},
+		noteShares:           &models.NoteShareModel{DB: db, Dialect: config.dbDialect},
+		notebooks:            &models.NotebookModel{DB: db, Dialect: config.dbDialect},
+		favorites:            &models.FavoriteModel{DB: db, Dialect: config.dbDialect},
+		passwordResets:       &models.PasswordResetModel{DB: db, Dialect: config.dbDialect},
+		twoFactor:            &models.TwoFactorModel{DB: db, Dialect: config.dbDialect},
+		lockouts:             &models.LockoutModel{DB: db, Dialect: config.dbDialect},
+		sessions:             &models.SessionModel{DB: db, Dialect: config.dbDialect},
+		formDecoder:          form.NewDecoder(),
+		sessionManager:       sessionManager,
+		mailer:               mail,
+		signer:               newSigner(secretKey),
+		notePasswordLimiter:  newAttemptLimiter(notePasswordAttempts, notePasswordWindow),
+		verificationLimiter:  newAttemptLimiter(verificationEmails, verificationEmailWindow),
+		passwordResetLimiter: newAttemptLimiter(passwordResetEmails, passwordResetEmailWindow),
+		twoFactorLimiter:     newAttemptLimiter(twoFactorAttempts, twoFactorWindow),
+		loginLimiter:         newBackoffLimiter(ipLoginPolicy, loginFailureMemory),
 	}
 
 	err = app.serve()
+	if err != nil {
+		app.logger.Error(err.Error())
+		db.Close()
+		os.Exit(1)
+	}
 
-	app.logger.Error(err.Error())
-	os.Exit(1)
+	err = db.Close()
+	if err != nil {
+		app.logger.Error(err.Error())
+		os.Exit(1)
+	}
+	app.logger.Info("closed database connection pool")
+}
+
+func migrateDB(db *sql.DB, dialect models.Dialect, logger *slog.Logger) error {
+	migrationsDir, _ := schema.Dirs(string(dialect))
+
+	goose.SetBaseFS(schema.EmbedMigrations)
+	goose.SetLogger(slog.NewLogLogger(logger.Handler(), slog.LevelInfo))
+	err := goose.SetDialect(dialect.GooseDialect())
+	if err != nil {
+		return err
+	}
+	return goose.Up(db, migrationsDir)
 }
 
-func openDB(dsn string) (*sql.DB, error) {
-	db, err := sql.Open("mysql", dsn)
+func openDB(dialect models.Dialect, dsn string) (*sql.DB, error) {
+	db, err := sql.Open(dialect.DriverName(), dsn)
 	if err != nil {
 		return nil, err
 	}
@@ -2,9 +2,12 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net/http"
+	"strings"
 
+	"github.com/Abdelrahman-habib/noter/internal/models"
 	"github.com/justinas/nosurf"
 )
 
@@ -34,6 +37,16 @@ func (app *application) cacheControlMiddleware(next http.Handler) http.Handler {
 	})
 }
 
+// trackInFlightMiddleware counts the requests currently being served, so a
+// graceful shutdown can report how many it waited for.
+func (app *application) trackInFlightMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		app.inFlight.Add(1)
+		defer app.inFlight.Add(-1)
+		next.ServeHTTP(w, r)
+	})
+}
+
 func (app *application) loggerMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		app.logger.Info("Received Request", "ip", r.RemoteAddr, "proto", r.Proto, "method", r.Method, "uri", r.URL.RequestURI())
@@ -66,6 +79,59 @@ func (app *application) requireAuthenticationMiddleware(next http.Handler) http.
 	})
 }
 
+// requireAdminMiddleware only lets admins through. It goes after
+// requireAuthenticationMiddleware, and answers everyone else with a 404 so
+// the admin pages don't give themselves away.
+func (app *application) requireAdminMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, err := app.users.GetByID(app.authenticatedUserID(r))
+		if err != nil {
+			if errors.Is(err, models.ErrNoRecord) {
+				app.clientError(w, http.StatusNotFound)
+				return
+			}
+			app.serverError(w, r, err)
+			return
+		}
+		if !user.Admin {
+			app.clientError(w, http.StatusNotFound)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// requireAPIAuthenticationMiddleware is the JSON API counterpart of
+// requireAuthenticationMiddleware: it answers with a 401 envelope instead of
+// redirecting to the login form.
+func (app *application) requireAPIAuthenticationMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !app.isAuthenticated(r) {
+			app.apiAuthenticationRequired(w, r)
+			return
+		}
+
+		w.Header().Add("Cache-Control", "no-store")
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (app *application) requireWriteScopeMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if app.authScope(r) != models.ScopeWrite {
+			app.apiErrorResponse(w, r, http.StatusForbidden, apiError{
+				Message: "your authentication token does not have the write scope",
+			})
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// authenticateMiddleware identifies the user from authenticatedUserID in the
+// session, and stores who they are in the request context. Sessions from
+// before the user's session generation was last bumped are logged out.
 func (app *application) authenticateMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		id := app.sessionManager.GetInt(r.Context(), "authenticatedUserID")
@@ -73,21 +139,59 @@ func (app *application) authenticateMiddleware(next http.Handler) http.Handler {
 			next.ServeHTTP(w, r)
 			return
 		}
-		exists, err := app.users.Exists(id)
-		if err != nil {
+		generation, err := app.users.SessionGeneration(id)
+		if err != nil && !errors.Is(err, models.ErrNoRecord) {
 			app.serverError(w, r, err)
 			return
 		}
 
-		if exists {
-			ctx := context.WithValue(r.Context(), isAuthenticatedContextKey, true)
-			r = r.WithContext(ctx)
+		if err == nil && generation == app.sessionManager.GetInt(r.Context(), "sessionGeneration") {
+			r = r.WithContext(withAuthenticatedUser(r.Context(), id, models.ScopeWrite))
 		}
 
 		next.ServeHTTP(w, r)
 	})
 }
 
+// authenticateTokenMiddleware identifies API clients from an
+// "Authorization: Bearer <token>" header, and falls back to the session
+// without one. Only the API accepts tokens: the HTML pages ignore the header.
+func (app *application) authenticateTokenMiddleware(next http.Handler) http.Handler {
+	session := app.authenticateMiddleware(next)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authorizationHeader := r.Header.Get("Authorization")
+		if authorizationHeader == "" {
+			session.ServeHTTP(w, r)
+			return
+		}
+		w.Header().Add("Vary", "Authorization")
+
+		token, ok := strings.CutPrefix(authorizationHeader, "Bearer ")
+		if !ok || token == "" {
+			app.invalidAuthenticationToken(w, r)
+			return
+		}
+
+		id, scope, err := app.tokens.Authenticate(token)
+		if err != nil {
+			if errors.Is(err, models.ErrInvalidCredentials) {
+				app.invalidAuthenticationToken(w, r)
+			} else {
+				app.apiServerError(w, r, err)
+			}
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(withAuthenticatedUser(r.Context(), id, scope)))
+	})
+}
+
+func withAuthenticatedUser(ctx context.Context, id int, scope string) context.Context {
+	ctx = context.WithValue(ctx, isAuthenticatedContextKey, true)
+	ctx = context.WithValue(ctx, authenticatedUserIDContextKey, id)
+	return context.WithValue(ctx, authScopeContextKey, scope)
+}
+
 func (app *application) noSurfMiddleware(next http.Handler) http.Handler {
 	csrfHandler := nosurf.New(next)
 	csrfHandler.SetBaseCookie(http.Cookie{
@@ -20,29 +20,93 @@ func (app *application) routes() http.Handler {
 	mux.Handle("GET /{$}", dynamic.ThenFunc(app.home))
 	mux.Handle("GET /about", dynamic.ThenFunc(app.about))
 	mux.Handle("GET /notes", dynamic.ThenFunc(app.listNotes))
+	mux.Handle("GET /search", dynamic.ThenFunc(app.search))
 	mux.Handle("GET /note/view/{id}", dynamic.ThenFunc(app.noteView))
+	mux.Handle("POST /note/view/{id}", dynamic.ThenFunc(app.noteBurnPost))
+	mux.Handle("POST /note/unlock/{id}", dynamic.ThenFunc(app.noteUnlockPost))
+	mux.Handle("GET /s/{token}", dynamic.ThenFunc(app.shareLinkView))
 	mux.Handle("GET /user/signup", dynamic.ThenFunc(app.userSignup))
 	mux.Handle("POST /user/signup", dynamic.ThenFunc(app.userSignupPost))
 	mux.Handle("GET /user/login", dynamic.ThenFunc(app.userLogin))
 	mux.Handle("POST /user/login", dynamic.ThenFunc(app.userLoginPost))
+	mux.Handle("GET /user/login/2fa", dynamic.ThenFunc(app.userLoginTwoFactor))
+	mux.Handle("POST /user/login/2fa", dynamic.ThenFunc(app.userLoginTwoFactorPost))
+	mux.Handle("GET /user/verify/{token}", dynamic.ThenFunc(app.userVerifyEmail))
+	mux.Handle("GET /user/password/forgot", dynamic.ThenFunc(app.userForgotPassword))
+	mux.Handle("POST /user/password/forgot", dynamic.ThenFunc(app.userForgotPasswordPost))
+	mux.Handle("GET /user/password/reset/{token}", dynamic.ThenFunc(app.userResetPassword))
+	mux.Handle("POST /user/password/reset/{token}", dynamic.ThenFunc(app.userResetPasswordPost))
 	mux.Handle("GET /user/{id}", dynamic.ThenFunc(app.userProfile))
 
 	portected := dynamic.Append(app.requireAuthenticationMiddleware)
 
 	mux.Handle("GET /my-notes", portected.ThenFunc(app.myNotes))
+	mux.Handle("GET /shared-with-me", portected.ThenFunc(app.sharedWithMe))
+	mux.Handle("GET /favorites", portected.ThenFunc(app.favoriteNotes))
+	mux.Handle("POST /notebooks/create", portected.ThenFunc(app.notebookCreatePost))
+	mux.Handle("POST /notebooks/delete/{id}", portected.ThenFunc(app.notebookDeletePost))
+	mux.Handle("POST /notebooks/move", portected.ThenFunc(app.notebookMovePost))
 	mux.Handle("GET /note/create", portected.ThenFunc(app.noteCreate))
 	mux.Handle("POST /note/create", portected.ThenFunc(app.noteCreatePost))
+	mux.Handle("POST /note/preview", portected.ThenFunc(app.notePreviewPost))
 	mux.Handle("GET /note/edit/{id}", portected.ThenFunc(app.noteEdit))
 	mux.Handle("POST /note/edit/{id}", portected.ThenFunc(app.noteCreatePost))
 	mux.Handle("POST /note/delete/{id}", portected.ThenFunc(app.noteDeletePost))
+	mux.Handle("POST /note/share/{id}", portected.ThenFunc(app.shareLinkCreatePost))
+	mux.Handle("POST /note/share/{id}/revoke/{linkID}", portected.ThenFunc(app.shareLinkRevokePost))
+	mux.Handle("POST /note/shares/{id}", portected.ThenFunc(app.noteShareGrantPost))
+	mux.Handle("POST /note/expiry/{id}", portected.ThenFunc(app.noteExtendPost))
+	mux.Handle("POST /note/pin/{id}", portected.ThenFunc(app.notePinPost))
+	mux.Handle("POST /note/pin/{id}/remove", portected.ThenFunc(app.notePinRemovePost))
+	mux.Handle("POST /note/favorite/{id}", portected.ThenFunc(app.noteFavoritePost))
+	mux.Handle("POST /note/favorite/{id}/remove", portected.ThenFunc(app.noteFavoriteRemovePost))
+	mux.Handle("POST /note/password/{id}", portected.ThenFunc(app.notePasswordPost))
+	mux.Handle("POST /note/password/{id}/remove", portected.ThenFunc(app.notePasswordRemovePost))
+	mux.Handle("POST /note/shares/{id}/revoke/{userID}", portected.ThenFunc(app.noteShareRevokePost))
+	mux.Handle("GET /note/history/{id}", portected.ThenFunc(app.noteHistory))
+	mux.Handle("GET /note/history/{id}/diff", portected.ThenFunc(app.noteDiff))
+	mux.Handle("POST /note/history/{id}/restore", portected.ThenFunc(app.noteRestorePost))
+	mux.Handle("GET /trash", portected.ThenFunc(app.trash))
+	mux.Handle("POST /trash/restore/{id}", portected.ThenFunc(app.trashRestorePost))
+	mux.Handle("POST /trash/delete/{id}", portected.ThenFunc(app.trashDeletePost))
 	mux.Handle("GET /account/view", portected.ThenFunc(app.accountView))
+	mux.Handle("POST /account/verify", portected.ThenFunc(app.accountVerifyPost))
 	mux.Handle("GET /account/password/update", portected.ThenFunc(app.accountPasswordUpdate))
 	mux.Handle("POST /account/password/update", portected.ThenFunc(app.accountPasswordUpdatePost))
+	mux.Handle("GET /account/2fa", portected.ThenFunc(app.accountTwoFactor))
+	mux.Handle("POST /account/2fa/enable", portected.ThenFunc(app.accountTwoFactorEnablePost))
+	mux.Handle("POST /account/2fa/disable", portected.ThenFunc(app.accountTwoFactorDisablePost))
+	mux.Handle("POST /account/2fa/recovery-codes", portected.ThenFunc(app.accountRecoveryCodesPost))
+	mux.Handle("POST /account/tokens/create", portected.ThenFunc(app.accountTokenCreatePost))
+	mux.Handle("POST /account/tokens/revoke/{id}", portected.ThenFunc(app.accountTokenRevokePost))
 	mux.Handle("POST /user/logout", portected.ThenFunc(app.userLogoutPost))
 
+	admin := portected.Append(app.requireAdminMiddleware)
+
+	mux.Handle("GET /admin/lockouts", admin.ThenFunc(app.adminLockouts))
+	mux.Handle("POST /admin/lockouts/{id}/unlock", admin.ThenFunc(app.adminLockoutUnlockPost))
+
+	// The JSON API shares the session with the HTML pages but skips nosurf:
+	// readJSON only accepts application/json bodies, which can't be posted
+	// cross-site without a CORS preflight. Scripts authenticate with a
+	// personal access token in the Authorization header instead.
+	api := alice.New(app.sessionManager.LoadAndSave, app.authenticateTokenMiddleware)
+
+	mux.Handle("/api/v1/", api.ThenFunc(app.apiNotFound))
+	mux.Handle("GET /api/v1/notes", api.ThenFunc(app.apiListNotes))
+	mux.Handle("GET /api/v1/notes/{id}", api.ThenFunc(app.apiNoteView))
+	mux.Handle("GET /api/v1/users/{id}", api.ThenFunc(app.apiUserView))
+	mux.Handle("GET /api/v1/users/{id}/notes", api.ThenFunc(app.apiUserNotes))
+
+	apiProtected := api.Append(app.requireAPIAuthenticationMiddleware, app.requireWriteScopeMiddleware)
+
+	mux.Handle("POST /api/v1/notes", apiProtected.ThenFunc(app.apiNoteCreate))
+	mux.Handle("PUT /api/v1/notes/{id}", apiProtected.ThenFunc(app.apiNoteUpdate))
+	mux.Handle("DELETE /api/v1/notes/{id}", apiProtected.ThenFunc(app.apiNoteDelete))
+
 	app.logger.Debug("routes registered")
 
-	standard := alice.New(app.recoverPanicMiddleware, app.loggerMiddleware, commonHeadersMiddleware)
+	standard := alice.New(app.trackInFlightMiddleware, app.recoverPanicMiddleware, app.loggerMiddleware, commonHeadersMiddleware)
 
 	return standard.Then(mux)
 }
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Abdelrahman-habib/noter/internal/assert"
+)
+
+func TestSigner(t *testing.T) {
+	s := newSigner([]byte("0123456789abcdef0123456789abcdef"))
+	now := time.Now()
+	token := s.Sign("verify-email", now.Add(time.Hour), "2", "bob@example.com")
+	other := s.Sign("verify-email", now.Add(time.Hour), "1", "bob@example.com")
+	payload, _, _ := strings.Cut(other, ".")
+	_, mac, _ := strings.Cut(token, ".")
+
+	fields, err := s.Verify("verify-email", token, now)
+	assert.NilError(t, err)
+	assert.Equal(t, slices.Equal(fields, []string{"2", "bob@example.com"}), true)
+
+	tests := []struct {
+		name    string
+		signer  *signer
+		purpose string
+		token   string
+		now     time.Time
+	}{
+		{"Expired", s, "verify-email", token, now.Add(time.Hour)},
+		{"Other purpose", s, "reset-password", token, now},
+		{"Other key", newSigner([]byte("another key, just as long as the 1st")), "verify-email", token, now},
+		{"Tampered", s, "verify-email", payload + "." + mac, now},
+		{"Malformed", s, "verify-email", "not a token", now},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := tt.signer.Verify(tt.purpose, tt.token, tt.now)
+			assert.Equal(t, errors.Is(err, errInvalidToken), true)
+		})
+	}
+}
@@ -1,13 +1,21 @@
 package main
 
 import (
+	"fmt"
 	"html/template"
 	"io/fs"
 	"path/filepath"
+	"regexp"
+	"strings"
 	"time"
+	"unicode/utf8"
 
+	"github.com/Abdelrahman-habib/noter/internal/diff"
+	"github.com/Abdelrahman-habib/noter/internal/markdown"
 	"github.com/Abdelrahman-habib/noter/internal/models"
+	"github.com/Abdelrahman-habib/noter/internal/syntax"
 	"github.com/Abdelrahman-habib/noter/ui"
+	"github.com/skip2/go-qrcode"
 )
 
 // Define a templateData type to act as the holding structure for
@@ -17,8 +25,32 @@ type templateData struct {
 	Note            models.NoteWithUsername
 	Notes           []models.NoteWithUsername
 	IsUserNote      bool
+	CanEdit         bool
+	Burned          bool
+	Conflict        bool
+	IsFavorite      bool
+	Favorites       map[string]bool
 	NotesFilters    *models.NotesFilters
+	ActiveTag       string
+	Sort            string
+	SearchQuery     string
+	Revisions       []models.Revision
+	FromRevision    models.Revision
+	ToRevision      models.Revision
+	Diff            []diff.Line
 	User            models.User
+	Tokens          []models.Token
+	NewToken        string
+	TwoFactorSecret string
+	TwoFactorURL    string
+	RecoveryCodes   []string
+	RecoveryLeft    int
+	Lockouts        []models.Lockout
+	ShareLinks      []models.ShareLink
+	NewShareLink    string
+	NoteShares      []models.NoteShare
+	Notebooks       []models.Notebook
+	TrashRetention  time.Duration
 	Form            any
 	Flash           string
 	IsAuthenticated bool
@@ -27,6 +59,12 @@ type templateData struct {
 	HasNext         bool
 }
 
+// indent pads the label of a nested item with non-breaking spaces, to draw an
+// outline where markup isn't allowed, such as in select options.
+func indent(depth int) string {
+	return strings.Repeat("\u00a0\u00a0\u00a0", depth)
+}
+
 func humanDate(t time.Time) string {
 	if t.IsZero() {
 		return ""
@@ -34,6 +72,25 @@ func humanDate(t time.Time) string {
 	return t.UTC().Format("02 Jan 2006 at 15:04")
 }
 
+// humanDuration formats whole days as "30 days" and falls back to the
+// time.Duration notation for anything shorter or uneven.
+func humanDuration(d time.Duration) string {
+	day := 24 * time.Hour
+	switch {
+	case d == day:
+		return "1 day"
+	case d > day && d%day == 0:
+		return fmt.Sprintf("%d days", d/day)
+	default:
+		return d.String()
+	}
+}
+
+// languages returns the languages offered in the note form.
+func languages() []syntax.Language {
+	return syntax.Languages
+}
+
 func truncate(s string, n int) string {
 	if len(s) <= n {
 		return s
@@ -41,6 +98,77 @@ func truncate(s string, n int) string {
 	return s[:n] + "..."
 }
 
+// highlight returns an excerpt of content around the first occurrence of any
+// word in query, with every occurrence wrapped in <mark>. The text is escaped
+// before the marks are added, so the result is safe to render as HTML.
+func highlight(content, query string) template.HTML {
+	const radius = 120
+
+	var terms []string
+	for _, term := range strings.Fields(query) {
+		terms = append(terms, regexp.QuoteMeta(term))
+	}
+	if len(terms) == 0 {
+		return template.HTML(template.HTMLEscapeString(truncate(content, 2*radius)))
+	}
+	rx := regexp.MustCompile(`(?i)` + strings.Join(terms, "|"))
+
+	start, end := 0, len(content)
+	if loc := rx.FindStringIndex(content); loc != nil {
+		start = max(loc[0]-radius, 0)
+	}
+	end = min(start+2*radius, end)
+	// Don't cut a multi-byte character in half.
+	for start > 0 && !utf8.RuneStart(content[start]) {
+		start--
+	}
+	for end < len(content) && !utf8.RuneStart(content[end]) {
+		end++
+	}
+	excerpt := content[start:end]
+
+	var b strings.Builder
+	if start > 0 {
+		b.WriteString("...")
+	}
+	last := 0
+	for _, loc := range rx.FindAllStringIndex(excerpt, -1) {
+		b.WriteString(template.HTMLEscapeString(excerpt[last:loc[0]]))
+		b.WriteString("<mark>")
+		b.WriteString(template.HTMLEscapeString(excerpt[loc[0]:loc[1]]))
+		b.WriteString("</mark>")
+		last = loc[1]
+	}
+	b.WriteString(template.HTMLEscapeString(excerpt[last:]))
+	if end < len(content) {
+		b.WriteString("...")
+	}
+	return template.HTML(b.String())
+}
+
+// qrCode renders content as a QR code in inline SVG, one unit per module, so
+// it scales with the CSS width of the image and needs no image request.
+func qrCode(content string) (template.HTML, error) {
+	q, err := qrcode.New(content, qrcode.Medium)
+	if err != nil {
+		return "", err
+	}
+	bitmap := q.Bitmap()
+
+	var b strings.Builder
+	fmt.Fprintf(&b, `<svg class="qr-code" xmlns="http://www.w3.org/2000/svg" viewBox="0 0 %d %d" shape-rendering="crispEdges" role="img" aria-label="QR code">`, len(bitmap), len(bitmap))
+	fmt.Fprintf(&b, `<rect width="%d" height="%d" fill="#fff"/><path fill="#000" d="`, len(bitmap), len(bitmap))
+	for y, row := range bitmap {
+		for x, dark := range row {
+			if dark {
+				fmt.Fprintf(&b, "M%d %dh1v1h-1z", x, y)
+			}
+		}
+	}
+	b.WriteString(`"/></svg>`)
+	return template.HTML(b.String()), nil
+}
+
 func add(a, b int) int {
 	return a + b
 }
@@ -66,12 +194,21 @@ func boolPtrIsNil(b *bool) bool {
 
 var functions = template.FuncMap{
 	"humanDate":      humanDate,
+	"humanDuration":  humanDuration,
+	"qrCode":         qrCode,
 	"truncate":       truncate,
 	"add":            add,
 	"sub":            sub,
 	"boolPtrIsTrue":  boolPtrIsTrue,
 	"boolPtrIsFalse": boolPtrIsFalse,
 	"boolPtrIsNil":   boolPtrIsNil,
+	"join":           strings.Join,
+	"highlight":      highlight,
+	"markdown":       markdown.Render,
+	"syntax":         syntax.Render,
+	"languages":      languages,
+	"languageName":   syntax.Name,
+	"indent":         indent,
 }
 
 func newTemplateCache() (map[string]*template.Template, error) {
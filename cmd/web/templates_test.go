@@ -1,6 +1,7 @@
 package main
 
 import (
+	"strings"
 	"testing"
 	"time"
 
@@ -39,3 +40,48 @@ func TestHumanDate(t *testing.T) {
 		})
 	}
 }
+
+func TestHighlight(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		query   string
+		want    string
+	}{
+		{
+			name:    "Single match",
+			content: "An old silent pond",
+			query:   "silent",
+			want:    "An old <mark>silent</mark> pond",
+		},
+		{
+			name:    "Case insensitive, several terms",
+			content: "An old silent Pond",
+			query:   "pond OLD",
+			want:    "An <mark>old</mark> silent <mark>Pond</mark>",
+		},
+		{
+			name:    "Escapes HTML",
+			content: "<b>pond</b>",
+			query:   "pond",
+			want:    "&lt;b&gt;<mark>pond</mark>&lt;/b&gt;",
+		},
+		{
+			name:    "Regexp characters are literal",
+			content: "a+b pond",
+			query:   "a+b",
+			want:    "<mark>a+b</mark> pond",
+		},
+		{
+			name:    "Excerpt around match",
+			content: strings.Repeat("x", 200) + "pond",
+			query:   "pond",
+			want:    "..." + strings.Repeat("x", 120) + "<mark>pond</mark>",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, string(highlight(tt.content, tt.query)), tt.want)
+		})
+	}
+}
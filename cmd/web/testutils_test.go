@@ -9,11 +9,13 @@ import (
 	"net/http/cookiejar"
 	"net/http/httptest"
 	"net/url"
+	"path/filepath"
 	"regexp"
 	"strings"
 	"testing"
 	"time"
 
+	"github.com/Abdelrahman-habib/noter/internal/mailer"
 	"github.com/Abdelrahman-habib/noter/internal/models/mocks"
 	"github.com/alexedwards/scs/v2"
 	"github.com/go-playground/form/v4"
@@ -33,13 +35,42 @@ func newTestApplication(t *testing.T) *application {
 	sessionManager.Lifetime = 12 * time.Hour
 	sessionManager.Cookie.Secure = true
 
+	config := &config{
+		env:              envTest,
+		baseURL:          "https://noter.test",
+		mailSender:       "Noter <no-reply@noter.test>",
+		mailFile:         filepath.Join(t.TempDir(), "mail.txt"),
+		trashRetention:   30 * 24 * time.Hour,
+		janitorInterval:  time.Minute,
+		janitorBatchSize: 100,
+	}
+
 	return &application{
-		logger:         slog.New(slog.DiscardHandler),
-		notes:          &mocks.NoteModel{},
-		users:          &mocks.UserModel{},
-		templateCache:  templateCache,
-		formDecoder:    formDecoder,
-		sessionManager: sessionManager,
+		logger:               slog.New(slog.DiscardHandler),
+		config:               config,
+		notes:                &mocks.NoteModel{},
+		users:                &mocks.UserModel{},
+		tokens:               &mocks.TokenModel{},
+		tags:                 &mocks.TagModel{},
+		revisions:            &mocks.RevisionModel{},
+		shareLinks:           &mocks.ShareLinkModel{},
+		noteShares:           &mocks.NoteShareModel{},
+		notebooks:            &mocks.NotebookModel{},
+		favorites:            &mocks.FavoriteModel{},
+		passwordResets:       &mocks.PasswordResetModel{},
+		twoFactor:            &mocks.TwoFactorModel{},
+		lockouts:             &mocks.LockoutModel{},
+		sessions:             &mocks.SessionModel{},
+		templateCache:        templateCache,
+		formDecoder:          formDecoder,
+		sessionManager:       sessionManager,
+		mailer:               mailer.NewFile(config.mailFile, config.mailSender),
+		signer:               newSigner([]byte("a test key that is 32 bytes long")),
+		notePasswordLimiter:  newAttemptLimiter(notePasswordAttempts, notePasswordWindow),
+		verificationLimiter:  newAttemptLimiter(verificationEmails, verificationEmailWindow),
+		passwordResetLimiter: newAttemptLimiter(passwordResetEmails, passwordResetEmailWindow),
+		twoFactorLimiter:     newAttemptLimiter(twoFactorAttempts, twoFactorWindow),
+		loginLimiter:         newBackoffLimiter(ipLoginPolicy, loginFailureMemory),
 	}
 }
 
@@ -118,3 +149,38 @@ func (ts *testServer) postForm(t *testing.T, urlPath string, form url.Values) (i
 	body = bytes.TrimSpace(body)
 	return rs.StatusCode, rs.Header, string(body)
 }
+
+// login signs the test server's client in through the login form, so the
+// session cookie in its jar is sent with subsequent requests.
+func (ts *testServer) login(t *testing.T, email, password string) {
+	_, _, body := ts.get(t, "/user/login")
+	form := url.Values{}
+	form.Add("email", email)
+	form.Add("password", password)
+	form.Add("csrf_token", extractCSRFToken(t, body))
+	code, _, _ := ts.postForm(t, "/user/login", form)
+	if code != http.StatusSeeOther {
+		t.Fatalf("login failed with status %d", code)
+	}
+}
+
+func (ts *testServer) doJSON(t *testing.T, method, urlPath, body string) (int, http.Header, string) {
+	req, err := http.NewRequest(method, ts.URL+urlPath, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	rs, err := ts.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer rs.Body.Close()
+	respBody, err := io.ReadAll(rs.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	respBody = bytes.TrimSpace(respBody)
+	return rs.StatusCode, rs.Header, string(respBody)
+}
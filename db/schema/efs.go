@@ -1,6 +1,23 @@
 package db
 
-import "embed"
+import (
+	"embed"
+	"path"
+)
 
 //go:embed "migrations/*.sql" "seed/*.sql"
+//go:embed "postgres/migrations/*.sql" "postgres/seed/*.sql"
+//go:embed "sqlite/migrations/*.sql" "sqlite/seed/*.sql"
 var EmbedMigrations embed.FS
+
+// Dirs returns the directories of EmbedMigrations that hold the goose
+// migrations and seed data for a database dialect. The MySQL files predate
+// the other dialects and live at the top level.
+func Dirs(dialect string) (migrations, seed string) {
+	switch dialect {
+	case "postgres", "sqlite":
+		return path.Join(dialect, "migrations"), path.Join(dialect, "seed")
+	default:
+		return "migrations", "seed"
+	}
+}
@@ -0,0 +1,5 @@
+-- +goose Up
+CREATE FULLTEXT INDEX idx_notes_fulltext ON notes(title, content);
+
+-- +goose Down
+DROP INDEX idx_notes_fulltext ON notes;
@@ -0,0 +1,22 @@
+-- +goose Up
+CREATE TABLE note_revisions (
+    id INTEGER NOT NULL PRIMARY KEY AUTO_INCREMENT,
+    note_id CHAR(36) NOT NULL,
+    title VARCHAR(100) NOT NULL,
+    content TEXT NOT NULL,
+    author_id INTEGER NOT NULL,
+    created DATETIME NOT NULL
+);
+CREATE INDEX idx_note_revisions_note_id ON note_revisions(note_id, id);
+ALTER TABLE note_revisions ADD CONSTRAINT fk_note_revisions_note_id FOREIGN KEY (note_id) REFERENCES notes(id) ON DELETE CASCADE;
+ALTER TABLE note_revisions ADD CONSTRAINT fk_note_revisions_author_id FOREIGN KEY (author_id) REFERENCES users(id) ON DELETE CASCADE;
+
+-- Existing notes start their history with their current content.
+INSERT INTO note_revisions (note_id, title, content, author_id, created)
+SELECT id, title, content, created_by, created FROM notes;
+
+-- +goose Down
+ALTER TABLE note_revisions DROP CONSTRAINT fk_note_revisions_author_id;
+ALTER TABLE note_revisions DROP CONSTRAINT fk_note_revisions_note_id;
+DROP INDEX idx_note_revisions_note_id ON note_revisions;
+DROP TABLE note_revisions;
@@ -0,0 +1,7 @@
+-- +goose Up
+ALTER TABLE notes ADD COLUMN deleted_at DATETIME NULL;
+CREATE INDEX idx_notes_deleted_at ON notes(deleted_at);
+
+-- +goose Down
+DROP INDEX idx_notes_deleted_at ON notes;
+ALTER TABLE notes DROP COLUMN deleted_at;
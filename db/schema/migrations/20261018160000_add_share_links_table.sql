@@ -0,0 +1,17 @@
+-- +goose Up
+CREATE TABLE share_links (
+    id INTEGER NOT NULL PRIMARY KEY AUTO_INCREMENT,
+    note_id CHAR(36) NOT NULL,
+    hash BINARY(32) NOT NULL,
+    created DATETIME NOT NULL,
+    expires DATETIME NULL,
+    max_views INTEGER NULL,
+    views INTEGER NOT NULL DEFAULT 0
+);
+ALTER TABLE share_links ADD CONSTRAINT share_links_uc_hash UNIQUE (hash);
+ALTER TABLE share_links ADD CONSTRAINT fk_share_links_note_id FOREIGN KEY (note_id) REFERENCES notes(id) ON DELETE CASCADE;
+
+-- +goose Down
+ALTER TABLE share_links DROP CONSTRAINT fk_share_links_note_id;
+ALTER TABLE share_links DROP CONSTRAINT share_links_uc_hash;
+DROP TABLE share_links;
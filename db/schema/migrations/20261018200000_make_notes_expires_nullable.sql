@@ -0,0 +1,7 @@
+-- +goose Up
+-- A NULL expiry means the note never expires.
+ALTER TABLE notes MODIFY expires DATETIME NULL;
+
+-- +goose Down
+UPDATE notes SET expires = '9999-12-31 23:59:59' WHERE expires IS NULL;
+ALTER TABLE notes MODIFY expires DATETIME NOT NULL;
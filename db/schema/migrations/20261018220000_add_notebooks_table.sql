@@ -0,0 +1,22 @@
+-- +goose Up
+CREATE TABLE notebooks (
+    id INTEGER NOT NULL PRIMARY KEY AUTO_INCREMENT,
+    user_id INTEGER NOT NULL,
+    parent_id INTEGER NULL,
+    name VARCHAR(100) NOT NULL,
+    created DATETIME NOT NULL
+);
+CREATE INDEX idx_notebooks_user_id ON notebooks(user_id);
+ALTER TABLE notebooks ADD CONSTRAINT fk_notebooks_user_id FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE;
+ALTER TABLE notebooks ADD CONSTRAINT fk_notebooks_parent_id FOREIGN KEY (parent_id) REFERENCES notebooks(id) ON DELETE SET NULL;
+ALTER TABLE notes ADD COLUMN notebook_id INTEGER NULL;
+CREATE INDEX idx_notes_notebook_id ON notes(notebook_id);
+ALTER TABLE notes ADD CONSTRAINT fk_notes_notebook_id FOREIGN KEY (notebook_id) REFERENCES notebooks(id) ON DELETE SET NULL;
+
+-- +goose Down
+ALTER TABLE notes DROP CONSTRAINT fk_notes_notebook_id;
+DROP INDEX idx_notes_notebook_id ON notes;
+ALTER TABLE notes DROP COLUMN notebook_id;
+ALTER TABLE notebooks DROP CONSTRAINT fk_notebooks_parent_id;
+ALTER TABLE notebooks DROP CONSTRAINT fk_notebooks_user_id;
+DROP TABLE notebooks;
@@ -0,0 +1,17 @@
+-- +goose Up
+ALTER TABLE notes ADD COLUMN pinned_at DATETIME NULL;
+CREATE TABLE favorites (
+    user_id INTEGER NOT NULL,
+    note_id CHAR(36) NOT NULL,
+    created DATETIME NOT NULL,
+    PRIMARY KEY (user_id, note_id)
+);
+CREATE INDEX idx_favorites_note_id ON favorites(note_id);
+ALTER TABLE favorites ADD CONSTRAINT fk_favorites_user_id FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE;
+ALTER TABLE favorites ADD CONSTRAINT fk_favorites_note_id FOREIGN KEY (note_id) REFERENCES notes(id) ON DELETE CASCADE;
+
+-- +goose Down
+ALTER TABLE favorites DROP CONSTRAINT fk_favorites_note_id;
+ALTER TABLE favorites DROP CONSTRAINT fk_favorites_user_id;
+DROP TABLE favorites;
+ALTER TABLE notes DROP COLUMN pinned_at;
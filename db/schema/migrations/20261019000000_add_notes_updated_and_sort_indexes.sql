@@ -0,0 +1,13 @@
+-- +goose Up
+ALTER TABLE notes ADD COLUMN updated DATETIME NULL;
+UPDATE notes SET updated = created;
+ALTER TABLE notes MODIFY updated DATETIME NOT NULL;
+CREATE INDEX idx_notes_updated ON notes(updated, id);
+CREATE INDEX idx_notes_expires ON notes(expires, id);
+CREATE INDEX idx_notes_title ON notes((LOWER(title)), id);
+
+-- +goose Down
+DROP INDEX idx_notes_title ON notes;
+DROP INDEX idx_notes_expires ON notes;
+DROP INDEX idx_notes_updated ON notes;
+ALTER TABLE notes DROP COLUMN updated;
@@ -0,0 +1,15 @@
+-- +goose Up
+CREATE TABLE password_resets (
+    id INTEGER NOT NULL PRIMARY KEY AUTO_INCREMENT,
+    user_id INTEGER NOT NULL,
+    hash BINARY(32) NOT NULL,
+    created DATETIME NOT NULL,
+    expires DATETIME NOT NULL
+);
+ALTER TABLE password_resets ADD CONSTRAINT password_resets_uc_hash UNIQUE (hash);
+ALTER TABLE password_resets ADD CONSTRAINT fk_password_resets_user_id FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE;
+
+-- +goose Down
+ALTER TABLE password_resets DROP CONSTRAINT fk_password_resets_user_id;
+ALTER TABLE password_resets DROP CONSTRAINT password_resets_uc_hash;
+DROP TABLE password_resets;
@@ -0,0 +1,18 @@
+-- +goose Up
+ALTER TABLE users ADD COLUMN totp_secret VARCHAR(64) NULL;
+ALTER TABLE users ADD COLUMN totp_last_step BIGINT NULL;
+CREATE TABLE recovery_codes (
+    id INTEGER NOT NULL PRIMARY KEY AUTO_INCREMENT,
+    user_id INTEGER NOT NULL,
+    hash BINARY(32) NOT NULL,
+    created DATETIME NOT NULL
+);
+ALTER TABLE recovery_codes ADD CONSTRAINT recovery_codes_uc_user_id_hash UNIQUE (user_id, hash);
+ALTER TABLE recovery_codes ADD CONSTRAINT fk_recovery_codes_user_id FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE;
+
+-- +goose Down
+ALTER TABLE recovery_codes DROP CONSTRAINT fk_recovery_codes_user_id;
+ALTER TABLE recovery_codes DROP CONSTRAINT recovery_codes_uc_user_id_hash;
+DROP TABLE recovery_codes;
+ALTER TABLE users DROP COLUMN totp_last_step;
+ALTER TABLE users DROP COLUMN totp_secret;
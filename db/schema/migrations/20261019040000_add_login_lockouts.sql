@@ -0,0 +1,26 @@
+-- +goose Up
+ALTER TABLE users ADD COLUMN admin BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE users ADD COLUMN failed_logins INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE users ADD COLUMN last_failed_login DATETIME NULL;
+ALTER TABLE users ADD COLUMN locked_until DATETIME NULL;
+CREATE TABLE lockouts (
+    id INTEGER NOT NULL PRIMARY KEY AUTO_INCREMENT,
+    user_id INTEGER NULL,
+    ip VARCHAR(45) NOT NULL,
+    failures INTEGER NOT NULL,
+    created DATETIME NOT NULL,
+    expires DATETIME NOT NULL,
+    unlocked DATETIME NULL,
+    unlocked_by INTEGER NULL
+);
+ALTER TABLE lockouts ADD CONSTRAINT fk_lockouts_user_id FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE;
+ALTER TABLE lockouts ADD CONSTRAINT fk_lockouts_unlocked_by FOREIGN KEY (unlocked_by) REFERENCES users(id) ON DELETE SET NULL;
+
+-- +goose Down
+ALTER TABLE lockouts DROP CONSTRAINT fk_lockouts_unlocked_by;
+ALTER TABLE lockouts DROP CONSTRAINT fk_lockouts_user_id;
+DROP TABLE lockouts;
+ALTER TABLE users DROP COLUMN locked_until;
+ALTER TABLE users DROP COLUMN last_failed_login;
+ALTER TABLE users DROP COLUMN failed_logins;
+ALTER TABLE users DROP COLUMN admin;
@@ -0,0 +1,15 @@
+-- +goose Up
+CREATE TABLE users (
+    id SERIAL NOT NULL PRIMARY KEY,
+    name VARCHAR(255) NOT NULL,
+    email VARCHAR(255) NOT NULL,
+    hashed_password CHAR(60) NOT NULL,
+    created TIMESTAMPTZ NOT NULL
+);
+ALTER TABLE users ADD CONSTRAINT users_uc_email UNIQUE (email);
+
+
+-- +goose Down
+ALTER TABLE users DROP CONSTRAINT users_uc_email;
+DROP TABLE users;
+
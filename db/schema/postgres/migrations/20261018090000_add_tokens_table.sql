@@ -0,0 +1,17 @@
+-- +goose Up
+CREATE TABLE tokens (
+    id SERIAL NOT NULL PRIMARY KEY,
+    user_id INTEGER NOT NULL,
+    name VARCHAR(100) NOT NULL,
+    hash BYTEA NOT NULL,
+    scope VARCHAR(10) NOT NULL,
+    created TIMESTAMPTZ NOT NULL,
+    last_used TIMESTAMPTZ NULL
+);
+ALTER TABLE tokens ADD CONSTRAINT tokens_uc_hash UNIQUE (hash);
+ALTER TABLE tokens ADD CONSTRAINT fk_tokens_user_id FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE;
+
+-- +goose Down
+ALTER TABLE tokens DROP CONSTRAINT fk_tokens_user_id;
+ALTER TABLE tokens DROP CONSTRAINT tokens_uc_hash;
+DROP TABLE tokens;
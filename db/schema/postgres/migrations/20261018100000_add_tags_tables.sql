@@ -0,0 +1,23 @@
+-- +goose Up
+CREATE TABLE tags (
+    id SERIAL NOT NULL PRIMARY KEY,
+    name VARCHAR(30) NOT NULL
+);
+ALTER TABLE tags ADD CONSTRAINT tags_uc_name UNIQUE (name);
+
+CREATE TABLE note_tags (
+    note_id CHAR(36) NOT NULL,
+    tag_id INTEGER NOT NULL,
+    PRIMARY KEY (note_id, tag_id)
+);
+CREATE INDEX idx_note_tags_tag_id ON note_tags(tag_id);
+ALTER TABLE note_tags ADD CONSTRAINT fk_note_tags_note_id FOREIGN KEY (note_id) REFERENCES notes(id) ON DELETE CASCADE;
+ALTER TABLE note_tags ADD CONSTRAINT fk_note_tags_tag_id FOREIGN KEY (tag_id) REFERENCES tags(id) ON DELETE CASCADE;
+
+-- +goose Down
+ALTER TABLE note_tags DROP CONSTRAINT fk_note_tags_tag_id;
+ALTER TABLE note_tags DROP CONSTRAINT fk_note_tags_note_id;
+DROP INDEX idx_note_tags_tag_id;
+DROP TABLE note_tags;
+ALTER TABLE tags DROP CONSTRAINT tags_uc_name;
+DROP TABLE tags;
@@ -0,0 +1,6 @@
+-- +goose Up
+-- Matches the to_tsvector expression used by NoteModel.Search.
+CREATE INDEX idx_notes_fulltext ON notes USING GIN (to_tsvector('english', title || ' ' || content));
+
+-- +goose Down
+DROP INDEX idx_notes_fulltext;
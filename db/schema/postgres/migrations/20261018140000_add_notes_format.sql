@@ -0,0 +1,5 @@
+-- +goose Up
+ALTER TABLE notes ADD COLUMN format VARCHAR(16) NOT NULL DEFAULT 'plain';
+
+-- +goose Down
+ALTER TABLE notes DROP COLUMN format;
@@ -0,0 +1,16 @@
+-- +goose Up
+CREATE TABLE note_shares (
+    note_id CHAR(36) NOT NULL,
+    user_id INTEGER NOT NULL,
+    permission VARCHAR(10) NOT NULL,
+    created TIMESTAMPTZ NOT NULL,
+    PRIMARY KEY (note_id, user_id)
+);
+CREATE INDEX idx_note_shares_user_id ON note_shares(user_id);
+ALTER TABLE note_shares ADD CONSTRAINT fk_note_shares_note_id FOREIGN KEY (note_id) REFERENCES notes(id) ON DELETE CASCADE;
+ALTER TABLE note_shares ADD CONSTRAINT fk_note_shares_user_id FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE;
+
+-- +goose Down
+ALTER TABLE note_shares DROP CONSTRAINT fk_note_shares_user_id;
+ALTER TABLE note_shares DROP CONSTRAINT fk_note_shares_note_id;
+DROP TABLE note_shares;
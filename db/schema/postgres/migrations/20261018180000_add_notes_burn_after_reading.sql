@@ -0,0 +1,5 @@
+-- +goose Up
+ALTER TABLE notes ADD COLUMN burn_after_reading BOOLEAN NOT NULL DEFAULT FALSE;
+
+-- +goose Down
+ALTER TABLE notes DROP COLUMN burn_after_reading;
@@ -0,0 +1,5 @@
+-- +goose Up
+ALTER TABLE notes ADD COLUMN hashed_password CHAR(60) NULL;
+
+-- +goose Down
+ALTER TABLE notes DROP COLUMN hashed_password;
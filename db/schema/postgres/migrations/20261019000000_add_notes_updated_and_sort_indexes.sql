@@ -0,0 +1,13 @@
+-- +goose Up
+ALTER TABLE notes ADD COLUMN updated TIMESTAMPTZ NULL;
+UPDATE notes SET updated = created;
+ALTER TABLE notes ALTER COLUMN updated SET NOT NULL;
+CREATE INDEX idx_notes_updated ON notes(updated, id);
+CREATE INDEX idx_notes_expires ON notes(expires, id);
+CREATE INDEX idx_notes_title ON notes(LOWER(title), id);
+
+-- +goose Down
+DROP INDEX idx_notes_title;
+DROP INDEX idx_notes_expires;
+DROP INDEX idx_notes_updated;
+ALTER TABLE notes DROP COLUMN updated;
@@ -0,0 +1,7 @@
+-- +goose Up
+ALTER TABLE users ADD COLUMN email_verified BOOLEAN NOT NULL DEFAULT FALSE;
+-- Accounts created before verification existed keep their privileges.
+UPDATE users SET email_verified = TRUE;
+
+-- +goose Down
+ALTER TABLE users DROP COLUMN email_verified;
@@ -1,11 +1,13 @@
 -- +goose Up
 
 -- Insert user first to get the ID for foreign key reference
-INSERT INTO users (name, email, hashed_password, created) VALUES (
+INSERT INTO users (name, email, hashed_password, created, email_verified, admin) VALUES (
     'Alice Jones',
     'alice@example.com',
     '$2a$12$NuTjWXm3KKntReFwyBVHyuf/to.HEwTy.eS206TNfkGfr6HzGJSWG',
-    '2022-01-01 09:18:24'
+    '2022-01-01 09:18:24',
+    TRUE,
+    TRUE
 );
 
 -- Insert notes with UUID, public field, and created_by reference
@@ -38,6 +40,11 @@ INSERT INTO notes (id, title, content, created, expires, public, created_by) VAL
     FALSE,
     1
 );
+
+-- Every note starts its history with a first revision
+INSERT INTO note_revisions (note_id, title, content, author_id, created)
+SELECT id, title, content, created_by, created FROM notes
+WHERE id IN ('550e8400-e29b-41d4-a716-446655440000', '550e8400-e29b-41d4-a716-446655440001', '550e8400-e29b-41d4-a716-446655440002');
 -- +goose Down
 
 DELETE FROM notes WHERE id = '550e8400-e29b-41d4-a716-446655440000';
@@ -0,0 +1,20 @@
+-- +goose Up
+CREATE TABLE tags (
+    id INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
+    name VARCHAR(30) NOT NULL,
+    CONSTRAINT tags_uc_name UNIQUE (name)
+);
+
+CREATE TABLE note_tags (
+    note_id CHAR(36) NOT NULL,
+    tag_id INTEGER NOT NULL,
+    PRIMARY KEY (note_id, tag_id),
+    CONSTRAINT fk_note_tags_note_id FOREIGN KEY (note_id) REFERENCES notes(id) ON DELETE CASCADE,
+    CONSTRAINT fk_note_tags_tag_id FOREIGN KEY (tag_id) REFERENCES tags(id) ON DELETE CASCADE
+);
+CREATE INDEX idx_note_tags_tag_id ON note_tags(tag_id);
+
+-- +goose Down
+DROP INDEX idx_note_tags_tag_id;
+DROP TABLE note_tags;
+DROP TABLE tags;
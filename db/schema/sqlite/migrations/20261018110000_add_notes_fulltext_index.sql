@@ -0,0 +1,7 @@
+-- +goose Up
+-- SQLite searches notes with a plain substring match and has no full-text
+-- index. This migration keeps the version numbers in step with MySQL.
+SELECT 1;
+
+-- +goose Down
+SELECT 1;
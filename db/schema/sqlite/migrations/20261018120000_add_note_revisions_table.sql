@@ -0,0 +1,20 @@
+-- +goose Up
+CREATE TABLE note_revisions (
+    id INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
+    note_id CHAR(36) NOT NULL,
+    title VARCHAR(100) NOT NULL,
+    content TEXT NOT NULL,
+    author_id INTEGER NOT NULL,
+    created DATETIME NOT NULL,
+    CONSTRAINT fk_note_revisions_note_id FOREIGN KEY (note_id) REFERENCES notes(id) ON DELETE CASCADE,
+    CONSTRAINT fk_note_revisions_author_id FOREIGN KEY (author_id) REFERENCES users(id) ON DELETE CASCADE
+);
+CREATE INDEX idx_note_revisions_note_id ON note_revisions(note_id, id);
+
+-- Existing notes start their history with their current content.
+INSERT INTO note_revisions (note_id, title, content, author_id, created)
+SELECT id, title, content, created_by, created FROM notes;
+
+-- +goose Down
+DROP INDEX idx_note_revisions_note_id;
+DROP TABLE note_revisions;
@@ -0,0 +1,5 @@
+-- +goose Up
+ALTER TABLE notes ADD COLUMN language VARCHAR(32) NOT NULL DEFAULT '';
+
+-- +goose Down
+ALTER TABLE notes DROP COLUMN language;
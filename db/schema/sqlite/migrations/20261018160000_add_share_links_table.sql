@@ -0,0 +1,15 @@
+-- +goose Up
+CREATE TABLE share_links (
+    id INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
+    note_id CHAR(36) NOT NULL,
+    hash BLOB NOT NULL,
+    created DATETIME NOT NULL,
+    expires DATETIME NULL,
+    max_views INTEGER NULL,
+    views INTEGER NOT NULL DEFAULT 0,
+    CONSTRAINT share_links_uc_hash UNIQUE (hash),
+    CONSTRAINT fk_share_links_note_id FOREIGN KEY (note_id) REFERENCES notes(id) ON DELETE CASCADE
+);
+
+-- +goose Down
+DROP TABLE share_links;
@@ -0,0 +1,14 @@
+-- +goose Up
+CREATE TABLE note_shares (
+    note_id CHAR(36) NOT NULL,
+    user_id INTEGER NOT NULL,
+    permission VARCHAR(10) NOT NULL,
+    created DATETIME NOT NULL,
+    PRIMARY KEY (note_id, user_id),
+    CONSTRAINT fk_note_shares_note_id FOREIGN KEY (note_id) REFERENCES notes(id) ON DELETE CASCADE,
+    CONSTRAINT fk_note_shares_user_id FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+CREATE INDEX idx_note_shares_user_id ON note_shares(user_id);
+
+-- +goose Down
+DROP TABLE note_shares;
@@ -0,0 +1,14 @@
+-- +goose Up
+-- A NULL expiry means the note never expires. SQLite can't drop a NOT NULL
+-- constraint, and rebuilding the table would cascade deletes to the tables
+-- referencing notes, so the column is replaced instead.
+ALTER TABLE notes ADD COLUMN expires_nullable DATETIME;
+UPDATE notes SET expires_nullable = expires;
+ALTER TABLE notes DROP COLUMN expires;
+ALTER TABLE notes RENAME COLUMN expires_nullable TO expires;
+
+-- +goose Down
+ALTER TABLE notes ADD COLUMN expires_required DATETIME NOT NULL DEFAULT '9999-12-31 23:59:59+00:00';
+UPDATE notes SET expires_required = COALESCE(expires, '9999-12-31 23:59:59+00:00');
+ALTER TABLE notes DROP COLUMN expires;
+ALTER TABLE notes RENAME COLUMN expires_required TO expires;
@@ -0,0 +1,21 @@
+-- +goose Up
+CREATE TABLE notebooks (
+    id INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
+    user_id INTEGER NOT NULL,
+    parent_id INTEGER NULL,
+    name VARCHAR(100) NOT NULL,
+    created DATETIME NOT NULL,
+    CONSTRAINT fk_notebooks_user_id FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+    CONSTRAINT fk_notebooks_parent_id FOREIGN KEY (parent_id) REFERENCES notebooks(id) ON DELETE SET NULL
+);
+CREATE INDEX idx_notebooks_user_id ON notebooks(user_id);
+-- SQLite can't drop a column that references another table, so notes point
+-- at their notebook without a foreign key. NotebookModel.Delete moves a
+-- notebook's notes out before removing it.
+ALTER TABLE notes ADD COLUMN notebook_id INTEGER NULL;
+CREATE INDEX idx_notes_notebook_id ON notes(notebook_id);
+
+-- +goose Down
+DROP INDEX idx_notes_notebook_id;
+ALTER TABLE notes DROP COLUMN notebook_id;
+DROP TABLE notebooks;
@@ -0,0 +1,14 @@
+-- +goose Up
+-- SQLite only adds NOT NULL columns with a constant default, which the
+-- backfill overwrites straight away.
+ALTER TABLE notes ADD COLUMN updated DATETIME NOT NULL DEFAULT '1970-01-01 00:00:00';
+UPDATE notes SET updated = created;
+CREATE INDEX idx_notes_updated ON notes(updated, id);
+CREATE INDEX idx_notes_expires ON notes(expires, id);
+CREATE INDEX idx_notes_title ON notes(LOWER(title), id);
+
+-- +goose Down
+DROP INDEX idx_notes_title;
+DROP INDEX idx_notes_expires;
+DROP INDEX idx_notes_updated;
+ALTER TABLE notes DROP COLUMN updated;
@@ -0,0 +1,54 @@
+-- +goose Up
+
+-- Insert user first to get the ID for foreign key reference
+INSERT INTO users (name, email, hashed_password, created, email_verified, admin) VALUES (
+    'Alice Jones',
+    'alice@example.com',
+    '$2a$12$NuTjWXm3KKntReFwyBVHyuf/to.HEwTy.eS206TNfkGfr6HzGJSWG',
+    '2022-01-01 09:18:24+00:00',
+    TRUE,
+    TRUE
+);
+
+-- Insert notes with UUID, public field, and created_by reference
+INSERT INTO notes (id, title, content, created, expires, public, created_by) VALUES (
+    '550e8400-e29b-41d4-a716-446655440000',
+    '[seed] An old silent pond',
+    replace('An old silent pond...\nA frog jumps into the pond,\nsplash! Silence again.\n\n– Matsuo Bashō', '\n', char(10)),
+    strftime('%Y-%m-%d %H:%M:%S+00:00', 'now'),
+    strftime('%Y-%m-%d %H:%M:%S+00:00', 'now', '+365 days'),
+    TRUE,
+    1
+);
+
+INSERT INTO notes (id, title, content, created, expires, public, created_by) VALUES (
+    '550e8400-e29b-41d4-a716-446655440001',
+    '[seed] Over the wintry forest',
+    replace('Over the wintry\nforest, winds howl in rage\nwith no leaves to blow.\n\n– Natsume Soseki', '\n', char(10)),
+    strftime('%Y-%m-%d %H:%M:%S+00:00', 'now'),
+    strftime('%Y-%m-%d %H:%M:%S+00:00', 'now', '+365 days'),
+    TRUE,
+    1
+);
+
+INSERT INTO notes (id, title, content, created, expires, public, created_by) VALUES (
+    '550e8400-e29b-41d4-a716-446655440002',
+    '[seed] First autumn morning',
+    replace('First autumn morning\nthe mirror I stare into\nshows my father''s face.\n\n– Murakami Kijo', '\n', char(10)),
+    strftime('%Y-%m-%d %H:%M:%S+00:00', 'now'),
+    strftime('%Y-%m-%d %H:%M:%S+00:00', 'now', '+7 days'),
+    FALSE,
+    1
+);
+
+-- Every note starts its history with a first revision
+INSERT INTO note_revisions (note_id, title, content, author_id, created)
+SELECT id, title, content, created_by, created FROM notes
+WHERE id IN ('550e8400-e29b-41d4-a716-446655440000', '550e8400-e29b-41d4-a716-446655440001', '550e8400-e29b-41d4-a716-446655440002');
+-- +goose Down
+
+DELETE FROM notes WHERE id = '550e8400-e29b-41d4-a716-446655440000';
+DELETE FROM notes WHERE id = '550e8400-e29b-41d4-a716-446655440001';
+DELETE FROM notes WHERE id = '550e8400-e29b-41d4-a716-446655440002';
+DELETE FROM users WHERE name = 'Alice Jones';
+
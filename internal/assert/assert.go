@@ -21,6 +21,14 @@ func StringContains(t *testing.T, actual, expected string) {
 	}
 }
 
+func StringNotContains(t *testing.T, actual, unexpected string) {
+	t.Helper()
+
+	if strings.Contains(actual, unexpected) {
+		t.Errorf("got: %q; expected not to contain: %q", actual, unexpected)
+	}
+}
+
 func NilError(t *testing.T, actual error) {
 	t.Helper()
 
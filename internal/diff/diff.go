@@ -0,0 +1,163 @@
+// Package diff computes line-level differences between two texts.
+package diff
+
+import "strings"
+
+type Op int
+
+const (
+	Equal Op = iota
+	Insert
+	Delete
+)
+
+func (op Op) String() string {
+	switch op {
+	case Insert:
+		return "insert"
+	case Delete:
+		return "delete"
+	default:
+		return "equal"
+	}
+}
+
+// A Line is one line of a diff: a line present in both texts (Equal), only
+// in the new text (Insert) or only in the old text (Delete).
+type Line struct {
+	Op   Op
+	Text string
+}
+
+// maxCells bounds the size of the LCS table. Texts that would need more are
+// reported as a full replacement instead.
+const maxCells = 4_000_000
+
+// Lines returns the line-level diff that turns a into b, based on their
+// longest common subsequence of lines.
+func Lines(a, b string) []Line {
+	x, y := splitLines(a), splitLines(b)
+
+	// Trim the common prefix and suffix, which is most of the text for
+	// typical edits, to keep the table small.
+	prefix := 0
+	for prefix < len(x) && prefix < len(y) && x[prefix] == y[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(x)-prefix && suffix < len(y)-prefix && x[len(x)-1-suffix] == y[len(y)-1-suffix] {
+		suffix++
+	}
+
+	var lines []Line
+	for _, text := range x[:prefix] {
+		lines = append(lines, Line{Equal, text})
+	}
+	lines = append(lines, middle(x[prefix:len(x)-suffix], y[prefix:len(y)-suffix])...)
+	for _, text := range x[len(x)-suffix:] {
+		lines = append(lines, Line{Equal, text})
+	}
+	return lines
+}
+
+func middle(x, y []string) []Line {
+	var lines []Line
+	if (len(x)+1)*(len(y)+1) > maxCells {
+		for _, text := range x {
+			lines = append(lines, Line{Delete, text})
+		}
+		for _, text := range y {
+			lines = append(lines, Line{Insert, text})
+		}
+		return lines
+	}
+
+	// lcs[i][j] is the length of the longest common subsequence of x[i:]
+	// and y[j:].
+	lcs := make([][]int, len(x)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(y)+1)
+	}
+	for i := len(x) - 1; i >= 0; i-- {
+		for j := len(y) - 1; j >= 0; j-- {
+			if x[i] == y[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	i, j := 0, 0
+	for i < len(x) && j < len(y) {
+		switch {
+		case x[i] == y[j]:
+			lines = append(lines, Line{Equal, x[i]})
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			lines = append(lines, Line{Delete, x[i]})
+			i++
+		default:
+			lines = append(lines, Line{Insert, y[j]})
+			j++
+		}
+	}
+	for ; i < len(x); i++ {
+		lines = append(lines, Line{Delete, x[i]})
+	}
+	for ; j < len(y); j++ {
+		lines = append(lines, Line{Insert, y[j]})
+	}
+	return lines
+}
+
+// Merge combines two versions of a text for someone to reconcile by hand.
+// Lines they share are kept once, and each run of lines where they differ is
+// wrapped in conflict markers, with a's lines first:
+//
+//	<<<<<<< labelA
+//	a's lines
+//	=======
+//	b's lines
+//	>>>>>>> labelB
+func Merge(a, b, labelA, labelB string) string {
+	var sb strings.Builder
+	var fromA, fromB []string
+	flush := func() {
+		if len(fromA) == 0 && len(fromB) == 0 {
+			return
+		}
+		sb.WriteString("<<<<<<< " + labelA + "\n")
+		for _, text := range fromA {
+			sb.WriteString(text + "\n")
+		}
+		sb.WriteString("=======\n")
+		for _, text := range fromB {
+			sb.WriteString(text + "\n")
+		}
+		sb.WriteString(">>>>>>> " + labelB + "\n")
+		fromA, fromB = nil, nil
+	}
+	for _, line := range Lines(a, b) {
+		switch line.Op {
+		case Delete:
+			fromA = append(fromA, line.Text)
+		case Insert:
+			fromB = append(fromB, line.Text)
+		default:
+			flush()
+			sb.WriteString(line.Text + "\n")
+		}
+	}
+	flush()
+	return sb.String()
+}
+
+func splitLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	s = strings.ReplaceAll(s, "\r\n", "\n")
+	return strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+}
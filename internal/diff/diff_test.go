@@ -0,0 +1,96 @@
+package diff
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestLines(t *testing.T) {
+	tests := []struct {
+		name string
+		a    string
+		b    string
+		want []Line
+	}{
+		{
+			name: "Identical",
+			a:    "one\ntwo",
+			b:    "one\ntwo",
+			want: []Line{{Equal, "one"}, {Equal, "two"}},
+		},
+		{
+			name: "Changed line",
+			a:    "one\ntwo\nthree",
+			b:    "one\n2\nthree",
+			want: []Line{{Equal, "one"}, {Delete, "two"}, {Insert, "2"}, {Equal, "three"}},
+		},
+		{
+			name: "Appended line",
+			a:    "one",
+			b:    "one\ntwo\n",
+			want: []Line{{Equal, "one"}, {Insert, "two"}},
+		},
+		{
+			name: "Removed lines",
+			a:    "one\ntwo\nthree\nfour",
+			b:    "one\nfour",
+			want: []Line{{Equal, "one"}, {Delete, "two"}, {Delete, "three"}, {Equal, "four"}},
+		},
+		{
+			name: "From empty",
+			a:    "",
+			b:    "one",
+			want: []Line{{Insert, "one"}},
+		},
+		{
+			name: "CRLF line endings",
+			a:    "one\r\ntwo",
+			b:    "one\ntwo",
+			want: []Line{{Equal, "one"}, {Equal, "two"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Lines(tt.a, tt.b)
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("got %v; want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMerge(t *testing.T) {
+	tests := []struct {
+		name string
+		a    string
+		b    string
+		want string
+	}{
+		{
+			name: "Identical",
+			a:    "one\ntwo",
+			b:    "one\ntwo\n",
+			want: "one\ntwo\n",
+		},
+		{
+			name: "Changed line",
+			a:    "one\ntwo\nthree",
+			b:    "one\n2\nthree",
+			want: "one\n<<<<<<< theirs\ntwo\n=======\n2\n>>>>>>> yours\nthree\n",
+		},
+		{
+			name: "Separate changes",
+			a:    "one\ntwo\nthree",
+			b:    "1\ntwo\nthree\nfour",
+			want: "<<<<<<< theirs\none\n=======\n1\n>>>>>>> yours\ntwo\nthree\n<<<<<<< theirs\n=======\nfour\n>>>>>>> yours\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Merge(tt.a, tt.b, "theirs", "yours")
+			if got != tt.want {
+				t.Errorf("got %q; want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,127 @@
+// Package mailer sends the plain-text emails noter needs, such as address
+// verification links. Mail goes out through an SMTP server in production;
+// during development and in tests it is appended to a file or written to the
+// log instead.
+package mailer
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime"
+	"mime/quotedprintable"
+	"net/mail"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// A Message is a plain-text email to a single recipient.
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// A Mailer sends messages from a fixed sender.
+type Mailer interface {
+	Send(msg Message) error
+}
+
+var errHeaderInjection = errors.New("mailer: header value contains a line break")
+
+// format renders msg as an RFC 5322 message from sender, with its body
+// quoted-printable encoded so that any text survives 7-bit transports.
+func format(sender string, msg Message, date time.Time) ([]byte, error) {
+	for _, value := range []string{sender, msg.To, msg.Subject} {
+		if strings.ContainsAny(value, "\r\n") {
+			return nil, errHeaderInjection
+		}
+	}
+
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "From: %s\r\n", sender)
+	fmt.Fprintf(&b, "To: %s\r\n", msg.To)
+	fmt.Fprintf(&b, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", msg.Subject))
+	fmt.Fprintf(&b, "Date: %s\r\n", date.Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+	b.WriteString("Content-Transfer-Encoding: quoted-printable\r\n")
+	b.WriteString("\r\n")
+
+	w := quotedprintable.NewWriter(&b)
+	_, err := io.WriteString(w, strings.ReplaceAll(msg.Body, "\n", "\r\n"))
+	if err != nil {
+		return nil, err
+	}
+	err = w.Close()
+	if err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+// address returns the bare email address of a "Name <address>" sender.
+func address(sender string) (string, error) {
+	addr, err := mail.ParseAddress(sender)
+	if err != nil {
+		return "", fmt.Errorf("mailer: invalid sender %q: %w", sender, err)
+	}
+	return addr.Address, nil
+}
+
+// File appends every message to a file, separated by blank lines, where
+// developers and tests can pick up the links they contain.
+type File struct {
+	mu     sync.Mutex
+	path   string
+	sender string
+}
+
+func NewFile(path, sender string) *File {
+	return &File{path: path, sender: sender}
+}
+
+func (m *File) Send(msg Message) error {
+	data, err := format(m.sender, msg, time.Now())
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	f, err := os.OpenFile(m.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(append(data, "\r\n\r\n"...))
+	if err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// Log writes every message to a logger instead of sending it.
+type Log struct {
+	logger *slog.Logger
+	sender string
+}
+
+func NewLog(logger *slog.Logger, sender string) *Log {
+	return &Log{logger: logger, sender: sender}
+}
+
+func (m *Log) Send(msg Message) error {
+	m.logger.Info("email not sent, no SMTP server configured",
+		slog.String("from", m.sender),
+		slog.String("to", msg.To),
+		slog.String("subject", msg.Subject),
+		slog.String("body", msg.Body),
+	)
+	return nil
+}
@@ -0,0 +1,107 @@
+package mailer
+
+import (
+	"errors"
+	"io"
+	"net"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Abdelrahman-habib/noter/internal/assert"
+)
+
+const sender = "Noter <no-reply@example.com>"
+
+func TestFormat(t *testing.T) {
+	date := time.Date(2026, 10, 18, 9, 30, 0, 0, time.UTC)
+	msg := Message{To: "alice@example.com", Subject: "Vérifiez", Body: "Hello Alice,\n\nhttps://example.com/user/verify/abc=def\n"}
+
+	data, err := format(sender, msg, date)
+	assert.NilError(t, err)
+	got := string(data)
+	assert.StringContains(t, got, "From: Noter <no-reply@example.com>\r\n")
+	assert.StringContains(t, got, "To: alice@example.com\r\n")
+	assert.StringContains(t, got, "Subject: =?utf-8?q?V=C3=A9rifiez?=\r\n")
+	assert.StringContains(t, got, "Date: Sun, 18 Oct 2026 09:30:00 +0000\r\n")
+	assert.StringContains(t, got, "\r\n\r\nHello Alice,\r\n\r\nhttps://example.com/user/verify/abc=3Ddef\r\n")
+
+	// Line breaks would let a value add headers of its own.
+	_, err = format(sender, Message{To: "alice@example.com\r\nBcc: eve@example.com"}, date)
+	assert.Equal(t, errors.Is(err, errHeaderInjection), true)
+}
+
+func TestFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "mail.txt")
+	m := NewFile(path, sender)
+
+	assert.NilError(t, m.Send(Message{To: "alice@example.com", Subject: "First", Body: "One"}))
+	assert.NilError(t, m.Send(Message{To: "bob@example.com", Subject: "Second", Body: "Two"}))
+
+	data, err := os.ReadFile(path)
+	assert.NilError(t, err)
+	assert.StringContains(t, string(data), "To: alice@example.com")
+	assert.StringContains(t, string(data), "To: bob@example.com")
+	assert.Equal(t, strings.Count(string(data), "MIME-Version: 1.0"), 2)
+}
+
+func TestSMTP(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NilError(t, err)
+	defer ln.Close()
+
+	// A minimal server that accepts one message without STARTTLS or AUTH.
+	received := make(chan []string, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		tp := textproto.NewConn(conn)
+		var commands []string
+		tp.PrintfLine("220 localhost ESMTP")
+		for {
+			line, err := tp.ReadLine()
+			if err != nil {
+				received <- commands
+				return
+			}
+			commands = append(commands, line)
+			switch {
+			case strings.HasPrefix(line, "EHLO"):
+				tp.PrintfLine("250 localhost")
+			case line == "DATA":
+				tp.PrintfLine("354 go ahead")
+				body, _ := io.ReadAll(tp.DotReader())
+				commands = append(commands, string(body))
+				tp.PrintfLine("250 queued")
+			case line == "QUIT":
+				tp.PrintfLine("221 bye")
+				received <- commands
+				return
+			default:
+				tp.PrintfLine("250 ok")
+			}
+		}
+	}()
+
+	host, port, err := net.SplitHostPort(ln.Addr().String())
+	assert.NilError(t, err)
+	portNumber, err := strconv.Atoi(port)
+	assert.NilError(t, err)
+
+	m := NewSMTP(host, portNumber, "", "", sender)
+	err = m.Send(Message{To: "alice@example.com", Subject: "Hello", Body: "Hi there"})
+	assert.NilError(t, err)
+
+	commands := strings.Join(<-received, "\n")
+	assert.StringContains(t, commands, "MAIL FROM:<no-reply@example.com>")
+	assert.StringContains(t, commands, "RCPT TO:<alice@example.com>")
+	assert.StringContains(t, commands, "Subject: Hello")
+	assert.StringContains(t, commands, "Hi there")
+}
@@ -0,0 +1,100 @@
+package mailer
+
+import (
+	"crypto/tls"
+	"net"
+	"net/smtp"
+	"strconv"
+	"time"
+)
+
+// smtpTimeout bounds a whole delivery, from dialing the server to QUIT, so
+// that a stuck server can't hold up a graceful shutdown forever.
+const smtpTimeout = 30 * time.Second
+
+// SMTP delivers messages through an SMTP server, upgrading the connection
+// with STARTTLS whenever the server offers it.
+type SMTP struct {
+	host     string
+	addr     string
+	username string
+	password string
+	sender   string
+}
+
+// NewSMTP returns a Mailer for the server at host:port. The username and
+// password are only used when username is not empty.
+func NewSMTP(host string, port int, username, password, sender string) *SMTP {
+	return &SMTP{
+		host:     host,
+		addr:     net.JoinHostPort(host, strconv.Itoa(port)),
+		username: username,
+		password: password,
+		sender:   sender,
+	}
+}
+
+func (m *SMTP) Send(msg Message) error {
+	data, err := format(m.sender, msg, time.Now())
+	if err != nil {
+		return err
+	}
+	from, err := address(m.sender)
+	if err != nil {
+		return err
+	}
+
+	conn, err := net.DialTimeout("tcp", m.addr, smtpTimeout)
+	if err != nil {
+		return err
+	}
+	err = conn.SetDeadline(time.Now().Add(smtpTimeout))
+	if err != nil {
+		conn.Close()
+		return err
+	}
+
+	c, err := smtp.NewClient(conn, m.host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer c.Close()
+
+	if ok, _ := c.Extension("STARTTLS"); ok {
+		err = c.StartTLS(&tls.Config{ServerName: m.host})
+		if err != nil {
+			return err
+		}
+	}
+	// PlainAuth refuses to send the password over an unencrypted
+	// connection to anything but localhost.
+	if m.username != "" {
+		err = c.Auth(smtp.PlainAuth("", m.username, m.password, m.host))
+		if err != nil {
+			return err
+		}
+	}
+
+	err = c.Mail(from)
+	if err != nil {
+		return err
+	}
+	err = c.Rcpt(msg.To)
+	if err != nil {
+		return err
+	}
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(data)
+	if err != nil {
+		return err
+	}
+	err = w.Close()
+	if err != nil {
+		return err
+	}
+	return c.Quit()
+}
@@ -0,0 +1,68 @@
+// Package markdown renders note content written in Markdown to HTML that is
+// safe to embed in the site's pages.
+package markdown
+
+import (
+	"bytes"
+	"html/template"
+	"regexp"
+
+	"github.com/microcosm-cc/bluemonday"
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/extension"
+)
+
+// The converter supports the GitHub flavoured extensions people expect from
+// a notes app. Table alignment is written as an align attribute rather than
+// an inline style, which the Content-Security-Policy would block.
+var converter = goldmark.New(
+	goldmark.WithExtensions(
+		extension.NewTable(extension.WithTableCellAlignMethod(extension.TableCellAlignAttribute)),
+		extension.Strikethrough,
+		extension.Linkify,
+		extension.TaskList,
+	),
+)
+
+// policy is an allowlist of the elements and attributes the converter
+// produces. Anything else, including raw HTML written in the note, scripts,
+// event handlers and style attributes, is stripped. Images are left out on
+// purpose: the Content-Security-Policy only allows them from our own origin.
+var policy = newPolicy()
+
+func newPolicy() *bluemonday.Policy {
+	p := bluemonday.NewPolicy()
+
+	p.AllowElements(
+		"p", "br", "hr", "blockquote", "pre",
+		"h1", "h2", "h3", "h4", "h5", "h6",
+		"ul", "ol", "li",
+		"em", "strong", "del", "code",
+		"table", "thead", "tbody", "tr", "th", "td",
+	)
+	p.AllowAttrs("start").Matching(bluemonday.Integer).OnElements("ol")
+	p.AllowAttrs("align").Matching(regexp.MustCompile(`^(left|center|right)$`)).OnElements("th", "td")
+	p.AllowAttrs("class").Matching(regexp.MustCompile(`^language-[a-zA-Z0-9_+-]+$`)).OnElements("code")
+
+	// Task list items.
+	p.AllowAttrs("type").Matching(regexp.MustCompile(`^checkbox$`)).OnElements("input")
+	p.AllowAttrs("checked", "disabled").OnElements("input")
+
+	p.AllowAttrs("href").OnElements("a")
+	p.AllowURLSchemes("http", "https", "mailto")
+	p.AllowRelativeURLs(true)
+	p.RequireNoFollowOnLinks(true)
+	p.AddTargetBlankToFullyQualifiedLinks(true)
+
+	return p
+}
+
+// Render converts src from Markdown to sanitized HTML.
+func Render(src string) (template.HTML, error) {
+	var buf bytes.Buffer
+	err := converter.Convert([]byte(src), &buf)
+	if err != nil {
+		return "", err
+	}
+	return template.HTML(policy.SanitizeBytes(buf.Bytes())), nil
+}
@@ -0,0 +1,81 @@
+package markdown
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRender(t *testing.T) {
+	tests := []struct {
+		name    string
+		src     string
+		want    []string
+		notWant []string
+	}{
+		{
+			name: "Emphasis",
+			src:  "*a* **b** ~~c~~",
+			want: []string{"<em>a</em>", "<strong>b</strong>", "<del>c</del>"},
+		},
+		{
+			name: "Code block",
+			src:  "```go\nfmt.Println()\n```",
+			want: []string{`<pre><code class="language-go">fmt.Println()`},
+		},
+		{
+			name: "Table alignment",
+			src:  "| a |\n|--:|\n| 1 |",
+			want: []string{`<th align="right">a</th>`},
+			notWant: []string{
+				"style=",
+			},
+		},
+		{
+			name: "Task list",
+			src:  "- [x] done",
+			want: []string{`<input checked="" disabled="" type="checkbox"> done`},
+		},
+		{
+			name: "Links",
+			src:  "[home](/) [go](https://go.dev)",
+			want: []string{
+				`<a href="/" rel="nofollow">home</a>`,
+				`<a href="https://go.dev" rel="nofollow noopener" target="_blank">go</a>`,
+			},
+		},
+		{
+			name:    "Raw HTML",
+			src:     "<script>alert(1)</script>\n\n<b onclick='x' style='color:red'>bold</b>",
+			notWant: []string{"<script", "alert", "onclick", "style="},
+		},
+		{
+			name:    "JavaScript link",
+			src:     "[x](javascript:alert(1))",
+			notWant: []string{"javascript:", "<a"},
+		},
+		{
+			name:    "Image",
+			src:     "![logo](https://example.com/logo.png)",
+			notWant: []string{"<img"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Render(tt.src)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(string(got), want) {
+					t.Errorf("got %q; want it to contain %q", got, want)
+				}
+			}
+			for _, notWant := range tt.notWant {
+				if strings.Contains(string(got), notWant) {
+					t.Errorf("got %q; want it not to contain %q", got, notWant)
+				}
+			}
+		})
+	}
+}
@@ -2,6 +2,7 @@ package models
 
 import (
 	"flag"
+	"os"
 	"sync"
 )
 
@@ -17,8 +18,11 @@ var (
 
 func parseFlags() *config {
 	configOnce.Do(func() {
-		dbDialect := flag.String("db-dialect", "mysql", "Database Dialect (eg: mysql, postgres, etc.)")
-		testDSN := flag.String("test-dsn", "noter_test_web:test_pass@/noter_test?parseTime=true", "MySQL test data source name")
+		// The flags are only registered once a test needs a database, after
+		// the testing package has parsed the command line, so they are
+		// usually set through the environment instead.
+		dbDialect := flag.String("db-dialect", envOr("TEST_DB_DIALECT", "mysql"), "Database dialect (mysql, postgres or sqlite)")
+		testDSN := flag.String("test-dsn", envOr("TEST_DB_DSN", "noter_test_web:test_pass@/noter_test?parseTime=true"), "Test database data source name")
 		flag.Parse()
 
 		configInstance = &config{
@@ -28,3 +32,10 @@ func parseFlags() *config {
 	})
 	return configInstance
 }
+
+func envOr(key, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return fallback
+}
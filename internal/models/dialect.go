@@ -0,0 +1,215 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/jackc/pgx/v5/pgconn"
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+// A Dialect names the database engine behind the models. Queries are written
+// once, with ? placeholders and portable SQL, and the Dialect adapts the few
+// places where the engines disagree. The zero value behaves like MySQL.
+type Dialect string
+
+const (
+	MySQL    Dialect = "mysql"
+	Postgres Dialect = "postgres"
+	SQLite   Dialect = "sqlite"
+)
+
+// ParseDialect validates the name of a dialect, as given on the command line.
+func ParseDialect(name string) (Dialect, error) {
+	switch d := Dialect(name); d {
+	case MySQL, Postgres, SQLite:
+		return d, nil
+	default:
+		return "", fmt.Errorf("models: unsupported database dialect %q", name)
+	}
+}
+
+// DriverName returns the database/sql driver registered for the dialect.
+func (d Dialect) DriverName() string {
+	switch d {
+	case Postgres:
+		return "pgx"
+	case SQLite:
+		return "sqlite"
+	default:
+		return "mysql"
+	}
+}
+
+// GooseDialect returns the name goose uses for the dialect.
+func (d Dialect) GooseDialect() string {
+	switch d {
+	case SQLite:
+		return "sqlite3"
+	case Postgres:
+		return "postgres"
+	default:
+		return "mysql"
+	}
+}
+
+// execQueryer is satisfied by both *sql.DB and *sql.Tx.
+type execQueryer interface {
+	Exec(query string, args ...any) (sql.Result, error)
+	QueryRow(query string, args ...any) *sql.Row
+}
+
+// rebind rewrites the ? placeholders of stmt into the dialect's own syntax.
+func (d Dialect) rebind(stmt string) string {
+	if d != Postgres {
+		return stmt
+	}
+
+	var b strings.Builder
+	n := 0
+	for _, r := range stmt {
+		if r == '?' {
+			n++
+			b.WriteByte('$')
+			b.WriteString(strconv.Itoa(n))
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// isDuplicate reports whether err is a violation of the named unique
+// constraint.
+func (d Dialect) isDuplicate(err error, constraint string) bool {
+	switch d {
+	case Postgres:
+		var pgErr *pgconn.PgError
+		return errors.As(err, &pgErr) && pgErr.Code == "23505" && pgErr.ConstraintName == constraint
+	case SQLite:
+		// SQLite names the offending columns rather than the constraint,
+		// so any unique violation matches.
+		var sqliteErr *sqlite.Error
+		return errors.As(err, &sqliteErr) && sqliteErr.Code() == sqlite3.SQLITE_CONSTRAINT_UNIQUE
+	default:
+		var mysqlErr *mysql.MySQLError
+		return errors.As(err, &mysqlErr) && mysqlErr.Number == 1062 && strings.Contains(mysqlErr.Message, constraint)
+	}
+}
+
+// insertID runs an INSERT into a table with an integer id column and returns
+// the id of the row. PostgreSQL drivers don't implement LastInsertId, and
+// SQLite's doesn't see rows touched by an upsert, so the id is read back with
+// RETURNING there instead.
+func (d Dialect) insertID(q execQueryer, stmt string, args ...any) (int64, error) {
+	if d == Postgres || d == SQLite {
+		var id int64
+		err := q.QueryRow(d.rebind(stmt+` RETURNING id`), args...).Scan(&id)
+		return id, err
+	}
+
+	result, err := q.Exec(d.rebind(stmt), args...)
+	if err != nil {
+		return 0, err
+	}
+	return result.LastInsertId()
+}
+
+// upsertTag inserts a tag by name, or touches the existing one, so that
+// insertID returns its id either way.
+func (d Dialect) upsertTag() string {
+	if d == Postgres || d == SQLite {
+		return `INSERT INTO tags (name) VALUES (?) ON CONFLICT (name) DO UPDATE SET name = EXCLUDED.name`
+	}
+	// LAST_INSERT_ID(id) makes LastInsertId() return the existing row's id
+	// when the tag is already known.
+	return `INSERT INTO tags (name) VALUES (?) ON DUPLICATE KEY UPDATE id = LAST_INSERT_ID(id)`
+}
+
+// insertFavorite stars a note for a user, leaving an existing star alone.
+func (d Dialect) insertFavorite() string {
+	if d == Postgres || d == SQLite {
+		return `INSERT INTO favorites (user_id, note_id, created) VALUES (?, ?, ?) ON CONFLICT (user_id, note_id) DO NOTHING`
+	}
+	return `INSERT INTO favorites (user_id, note_id, created) VALUES (?, ?, ?) ON DUPLICATE KEY UPDATE created = created`
+}
+
+// upsertNoteShare shares a note with a user, or changes the permission of an
+// existing share. An upsert, because MySQL reports no affected rows when an
+// UPDATE leaves the permission as it was.
+func (d Dialect) upsertNoteShare() string {
+	if d == Postgres || d == SQLite {
+		return `INSERT INTO note_shares (note_id, user_id, permission, created) VALUES (?, ?, ?, ?)
+		ON CONFLICT (note_id, user_id) DO UPDATE SET permission = EXCLUDED.permission`
+	}
+	return `INSERT INTO note_shares (note_id, user_id, permission, created) VALUES (?, ?, ?, ?)
+	ON DUPLICATE KEY UPDATE permission = VALUES(permission)`
+}
+
+// searchMatch is a condition matching notes against a full-text query bound
+// to a single ? placeholder, and searchRank scores how well they match.
+// SQLite has no full-text index on notes and settles for a case-insensitive
+// substring match that ranks title matches first.
+func (d Dialect) searchMatch() string {
+	switch d {
+	case Postgres:
+		return `to_tsvector('english', notes.title || ' ' || notes.content) @@ plainto_tsquery('english', ?)`
+	case SQLite:
+		return `instr(lower(notes.title || ' ' || notes.content), lower(?)) > 0`
+	default:
+		return `MATCH(notes.title, notes.content) AGAINST (? IN NATURAL LANGUAGE MODE)`
+	}
+}
+
+func (d Dialect) searchRank() string {
+	switch d {
+	case Postgres:
+		return `ts_rank(to_tsvector('english', notes.title || ' ' || notes.content), plainto_tsquery('english', ?))`
+	case SQLite:
+		return `instr(lower(notes.title), lower(?)) > 0`
+	default:
+		return `MATCH(notes.title, notes.content) AGAINST (? IN NATURAL LANGUAGE MODE)`
+	}
+}
+
+// forUpdate is the locking clause for a SELECT that precedes an UPDATE in the
+// same transaction. SQLite has none: its write transactions are serialised,
+// and the DSN built for it begins them IMMEDIATE.
+func (d Dialect) forUpdate() string {
+	if d == SQLite {
+		return ""
+	}
+	return ` FOR UPDATE`
+}
+
+// sessionExpired is the condition matching expired rows of the sessions
+// table, compared against a time bound to a single ? placeholder. The scs
+// SQLite store keeps expiry as a Julian day number.
+func (d Dialect) sessionExpired() string {
+	if d == SQLite {
+		return `expiry < julianday(?)`
+	}
+	return `expiry < ?`
+}
+
+// now returns the current time as stored by the models: UTC, to the second.
+// Timestamps are computed here rather than with the database's own date
+// functions, which differ between dialects.
+func now() time.Time {
+	return time.Now().UTC().Truncate(time.Second)
+}
+
+// nullTime converts an optional timestamp to a query argument: NULL for the
+// zero time, otherwise the time as now would have stored it.
+func nullTime(t time.Time) any {
+	if t.IsZero() {
+		return nil
+	}
+	return t.UTC().Truncate(time.Second)
+}
@@ -0,0 +1,50 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/Abdelrahman-habib/noter/internal/assert"
+)
+
+func TestDialectRebind(t *testing.T) {
+	stmt := `SELECT id FROM notes WHERE created_by = ? AND public = ? LIMIT ? OFFSET ?`
+
+	tests := []struct {
+		name    string
+		dialect Dialect
+		want    string
+	}{
+		{
+			name:    "MySQL",
+			dialect: MySQL,
+			want:    stmt,
+		},
+		{
+			name:    "Zero value",
+			dialect: "",
+			want:    stmt,
+		},
+		{
+			name:    "Postgres",
+			dialect: Postgres,
+			want:    `SELECT id FROM notes WHERE created_by = $1 AND public = $2 LIMIT $3 OFFSET $4`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.dialect.rebind(stmt), tt.want)
+		})
+	}
+}
+
+func TestParseDialect(t *testing.T) {
+	dialect, err := ParseDialect("postgres")
+	assert.NilError(t, err)
+	assert.Equal(t, dialect, Postgres)
+	assert.Equal(t, dialect.DriverName(), "pgx")
+
+	_, err = ParseDialect("oracle")
+	if err == nil {
+		t.Error("got nil error for an unsupported dialect")
+	}
+}
@@ -0,0 +1,69 @@
+package models
+
+import (
+	"database/sql"
+	"strings"
+)
+
+// FavoriteModel records the notes users have starred. Anyone who can see a
+// note can star it; the stars of notes they lose access to stay hidden until
+// access is given back.
+type FavoriteModel struct {
+	DB      *sql.DB
+	Dialect Dialect
+}
+
+type FavoriteModelInterface interface {
+	Add(userID int, noteID string) error
+	Remove(userID int, noteID string) error
+	GetForNotes(userID int, noteIDs ...string) (map[string]bool, error)
+}
+
+// Add stars a note for a user. Starring it again does nothing.
+func (m *FavoriteModel) Add(userID int, noteID string) error {
+	_, err := m.DB.Exec(m.Dialect.rebind(m.Dialect.insertFavorite()), userID, noteID, now())
+	return err
+}
+
+// Remove unstars a note for a user, if they had starred it.
+func (m *FavoriteModel) Remove(userID int, noteID string) error {
+	stmt := `DELETE FROM favorites WHERE user_id = ? AND note_id = ?`
+	_, err := m.DB.Exec(m.Dialect.rebind(stmt), userID, noteID)
+	return err
+}
+
+// GetForNotes reports which of the given notes a user has starred. Notes
+// they haven't starred are absent from the map.
+func (m *FavoriteModel) GetForNotes(userID int, noteIDs ...string) (map[string]bool, error) {
+	favorites := make(map[string]bool)
+	if len(noteIDs) == 0 {
+		return favorites, nil
+	}
+
+	stmt := `SELECT note_id FROM favorites
+	WHERE user_id = ? AND note_id IN (?` + strings.Repeat(", ?", len(noteIDs)-1) + `)`
+
+	args := []any{userID}
+	for _, id := range noteIDs {
+		args = append(args, id)
+	}
+
+	rows, err := m.DB.Query(m.Dialect.rebind(stmt), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var noteID string
+		err := rows.Scan(&noteID)
+		if err != nil {
+			return nil, err
+		}
+		favorites[noteID] = true
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return favorites, nil
+}
@@ -0,0 +1,61 @@
+package models
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Abdelrahman-habib/noter/internal/assert"
+)
+
+func TestPinsAndFavorites(t *testing.T) {
+	if testing.Short() {
+		t.Skip("models: skipping integration test")
+	}
+
+	db := newTestDB(t)
+	notes := NoteModel{DB: db, Dialect: testDialect(t)}
+	users := UserModel{DB: db, Dialect: testDialect(t)}
+	m := FavoriteModel{DB: db, Dialect: testDialect(t)}
+	owner := 1
+	bob, err := users.Insert("Bob", "bob@example.com", "pa$$word")
+	assert.NilError(t, err)
+
+	older, err := notes.Insert("Older", "First", FormatPlain, "", time.Now().Add(time.Hour), true, false, "", owner)
+	assert.NilError(t, err)
+	private, err := notes.Insert("Private", "Second", FormatPlain, "", time.Now().Add(time.Hour), false, false, "", owner)
+	assert.NilError(t, err)
+
+	// Pinned notes come first when asked, newest pin first.
+	err = notes.SetPinned(older, true, bob)
+	assert.Equal(t, errors.Is(err, ErrNoRecord), true)
+	assert.NilError(t, notes.SetPinned(older, true, owner))
+	assert.NilError(t, notes.SetPinned(older, true, owner))
+	mine, _, err := notes.GetByPage(1, 10, &owner, NotesFilters{PinnedFirst: true})
+	assert.NilError(t, err)
+	assert.Equal(t, mine[0].ID, older)
+	assert.Equal(t, mine[0].Pinned, true)
+	assert.NilError(t, notes.SetPinned(older, false, owner))
+	note, err := notes.Get(older, &owner)
+	assert.NilError(t, err)
+	assert.Equal(t, note.Pinned, false)
+
+	// Starring a note twice is harmless.
+	assert.NilError(t, m.Add(bob, older))
+	assert.NilError(t, m.Add(bob, older))
+	assert.NilError(t, m.Add(bob, private))
+	favorites, err := m.GetForNotes(bob, older, private, "00000000-0000-0000-0000-000000000000")
+	assert.NilError(t, err)
+	assert.Equal(t, len(favorites), 2)
+
+	// Favorites the user can no longer see are left out of the listing.
+	starred, _, err := notes.GetByPage(1, 10, nil, NotesFilters{FavoritedBy: bob})
+	assert.NilError(t, err)
+	assert.Equal(t, len(starred), 1)
+	assert.Equal(t, starred[0].ID, older)
+
+	assert.NilError(t, m.Remove(bob, older))
+	starred, _, err = notes.GetByPage(1, 10, nil, NotesFilters{FavoritedBy: bob})
+	assert.NilError(t, err)
+	assert.Equal(t, len(starred), 0)
+}
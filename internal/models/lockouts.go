@@ -0,0 +1,209 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// A Lockout records an account or a client IP being locked out after too
+// many failed logins, so that an admin can see it and unlock it early.
+type Lockout struct {
+	ID         int
+	UserID     int // zero when a client IP was locked out
+	UserName   string
+	UserEmail  string
+	IP         string
+	Failures   int
+	Created    time.Time
+	Expires    time.Time
+	Unlocked   time.Time // zero unless an admin unlocked it
+	UnlockedBy string
+}
+
+// Active reports whether the lockout still stands.
+func (l Lockout) Active() bool {
+	return l.Unlocked.IsZero() && l.Expires.After(time.Now())
+}
+
+// LockoutModel counts the failed logins of each account, and records the
+// lockouts that follow from them. Failures per client IP are counted by the
+// caller.
+type LockoutModel struct {
+	DB      *sql.DB
+	Dialect Dialect
+}
+
+type LockoutModelInterface interface {
+	LockedUntil(email string) (time.Time, error)
+	Fail(email string, forget time.Duration) (int, int, error)
+	Lock(userID int, until time.Time) error
+	Reset(userID int) error
+	Record(userID int, ip string, failures int, expires time.Time) (int, error)
+	GetRecent(limit int) ([]Lockout, error)
+	Unlock(id, adminID int) (Lockout, error)
+}
+
+// LockedUntil returns until when the account with the given email may not
+// log in, or the zero time if it may. Unknown emails are never locked.
+func (m *LockoutModel) LockedUntil(email string) (time.Time, error) {
+	var until sql.NullTime
+
+	stmt := `SELECT locked_until FROM users WHERE email = ?`
+	err := m.DB.QueryRow(m.Dialect.rebind(stmt), email).Scan(&until)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return time.Time{}, nil
+		}
+		return time.Time{}, err
+	}
+	if !until.Valid || !until.Time.After(time.Now()) {
+		return time.Time{}, nil
+	}
+	return until.Time, nil
+}
+
+// Fail counts a failed login for the account with the given email, and
+// returns its ID and how many logins have failed in a row. Failures older
+// than forget are no longer counted. It returns ErrNoRecord for unknown
+// emails.
+func (m *LockoutModel) Fail(email string, forget time.Duration) (int, int, error) {
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return 0, 0, err
+	}
+	defer tx.Rollback()
+
+	var userID, failures int
+	var last sql.NullTime
+	stmt := `SELECT id, failed_logins, last_failed_login FROM users WHERE email = ?` + m.Dialect.forUpdate()
+	err = tx.QueryRow(m.Dialect.rebind(stmt), email).Scan(&userID, &failures, &last)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, 0, ErrNoRecord
+		}
+		return 0, 0, err
+	}
+
+	current := now()
+	if !last.Valid || current.Sub(last.Time) >= forget {
+		failures = 0
+	}
+	failures++
+
+	stmt = `UPDATE users SET failed_logins = ?, last_failed_login = ? WHERE id = ?`
+	_, err = tx.Exec(m.Dialect.rebind(stmt), failures, current, userID)
+	if err != nil {
+		return 0, 0, err
+	}
+	return userID, failures, tx.Commit()
+}
+
+// Lock keeps a user from logging in until the given time.
+func (m *LockoutModel) Lock(userID int, until time.Time) error {
+	stmt := `UPDATE users SET locked_until = ? WHERE id = ?`
+	_, err := m.DB.Exec(m.Dialect.rebind(stmt), nullTime(until), userID)
+	return err
+}
+
+// Reset clears a user's failed logins and lock, as after a successful login.
+func (m *LockoutModel) Reset(userID int) error {
+	stmt := `UPDATE users SET failed_logins = 0, last_failed_login = NULL, locked_until = NULL WHERE id = ?`
+	_, err := m.DB.Exec(m.Dialect.rebind(stmt), userID)
+	return err
+}
+
+// Record stores a lockout event for a user, or for a client IP when userID
+// is zero, and returns its ID.
+func (m *LockoutModel) Record(userID int, ip string, failures int, expires time.Time) (int, error) {
+	var userIDArg any
+	if userID != 0 {
+		userIDArg = userID
+	}
+
+	stmt := `INSERT INTO lockouts (user_id, ip, failures, created, expires) VALUES (?, ?, ?, ?, ?)`
+	id, err := m.Dialect.insertID(m.DB, stmt, userIDArg, ip, failures, now(), nullTime(expires))
+	if err != nil {
+		return 0, err
+	}
+	return int(id), nil
+}
+
+// GetRecent returns the latest limit lockouts, newest first, including the
+// ones that have expired or been unlocked.
+func (m *LockoutModel) GetRecent(limit int) ([]Lockout, error) {
+	stmt := `SELECT lockouts.id, lockouts.user_id, COALESCE(users.name, ''), COALESCE(users.email, ''),
+	lockouts.ip, lockouts.failures, lockouts.created, lockouts.expires, lockouts.unlocked, COALESCE(admins.name, '')
+	FROM lockouts
+	LEFT JOIN users ON lockouts.user_id = users.id
+	LEFT JOIN users AS admins ON lockouts.unlocked_by = admins.id
+	ORDER BY lockouts.id DESC LIMIT ?`
+
+	rows, err := m.DB.Query(m.Dialect.rebind(stmt), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var lockouts []Lockout
+	for rows.Next() {
+		var l Lockout
+		var userID sql.NullInt64
+		var unlocked sql.NullTime
+		err := rows.Scan(&l.ID, &userID, &l.UserName, &l.UserEmail, &l.IP, &l.Failures, &l.Created, &l.Expires, &unlocked, &l.UnlockedBy)
+		if err != nil {
+			return nil, err
+		}
+		l.UserID = int(userID.Int64)
+		l.Unlocked = unlocked.Time
+		lockouts = append(lockouts, l)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return lockouts, nil
+}
+
+// Unlock lifts an active lockout on behalf of an admin and returns it. For
+// an account, every lockout of it is lifted and its failed logins are
+// cleared; unlocking a client IP is up to the caller, who counts its
+// failures. It returns ErrNoRecord for unknown and inactive lockouts.
+func (m *LockoutModel) Unlock(id, adminID int) (Lockout, error) {
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return Lockout{}, err
+	}
+	defer tx.Rollback()
+
+	var l Lockout
+	var userID sql.NullInt64
+	current := now()
+	stmt := `SELECT id, user_id, ip, failures, created, expires FROM lockouts
+	WHERE id = ? AND unlocked IS NULL AND expires > ?` + m.Dialect.forUpdate()
+	err = tx.QueryRow(m.Dialect.rebind(stmt), id, current).Scan(&l.ID, &userID, &l.IP, &l.Failures, &l.Created, &l.Expires)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return Lockout{}, ErrNoRecord
+		}
+		return Lockout{}, err
+	}
+	l.UserID = int(userID.Int64)
+	l.Unlocked = current
+
+	if l.UserID == 0 {
+		stmt = `UPDATE lockouts SET unlocked = ?, unlocked_by = ? WHERE id = ?`
+		_, err = tx.Exec(m.Dialect.rebind(stmt), current, adminID, l.ID)
+	} else {
+		stmt = `UPDATE lockouts SET unlocked = ?, unlocked_by = ? WHERE user_id = ? AND unlocked IS NULL`
+		_, err = tx.Exec(m.Dialect.rebind(stmt), current, adminID, l.UserID)
+		if err != nil {
+			return Lockout{}, err
+		}
+		stmt = `UPDATE users SET failed_logins = 0, last_failed_login = NULL, locked_until = NULL WHERE id = ?`
+		_, err = tx.Exec(m.Dialect.rebind(stmt), l.UserID)
+	}
+	if err != nil {
+		return Lockout{}, err
+	}
+	return l, tx.Commit()
+}
@@ -0,0 +1,86 @@
+package models
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Abdelrahman-habib/noter/internal/assert"
+)
+
+func TestLockoutModel(t *testing.T) {
+	if testing.Short() {
+		t.Skip("models: skipping integration test")
+	}
+
+	db := newTestDB(t)
+	m := LockoutModel{DB: db, Dialect: testDialect(t)}
+
+	_, _, err := m.Fail("nobody@example.com", time.Hour)
+	assert.Equal(t, errors.Is(err, ErrNoRecord), true)
+
+	for i := 1; i <= 3; i++ {
+		userID, failures, err := m.Fail("alice@example.com", time.Hour)
+		assert.NilError(t, err)
+		assert.Equal(t, userID, 1)
+		assert.Equal(t, failures, i)
+	}
+
+	// Failures older than forget start the count over.
+	_, failures, err := m.Fail("alice@example.com", -time.Second)
+	assert.NilError(t, err)
+	assert.Equal(t, failures, 1)
+
+	until, err := m.LockedUntil("alice@example.com")
+	assert.NilError(t, err)
+	assert.Equal(t, until.IsZero(), true)
+
+	expires := time.Now().Add(time.Hour)
+	assert.NilError(t, m.Lock(1, expires))
+	until, err = m.LockedUntil("alice@example.com")
+	assert.NilError(t, err)
+	assert.Equal(t, until.IsZero(), false)
+
+	id, err := m.Record(1, "192.0.2.1", 10, expires)
+	assert.NilError(t, err)
+	ipID, err := m.Record(0, "192.0.2.2", 30, expires)
+	assert.NilError(t, err)
+	expiredID, err := m.Record(1, "192.0.2.1", 10, time.Now().Add(-time.Minute))
+	assert.NilError(t, err)
+
+	lockouts, err := m.GetRecent(10)
+	assert.NilError(t, err)
+	assert.Equal(t, len(lockouts), 3)
+	assert.Equal(t, lockouts[0].ID, expiredID)
+	assert.Equal(t, lockouts[0].Active(), false)
+	assert.Equal(t, lockouts[1].UserID, 0)
+	assert.Equal(t, lockouts[1].IP, "192.0.2.2")
+	assert.Equal(t, lockouts[2].UserEmail, "alice@example.com")
+	assert.Equal(t, lockouts[2].Active(), true)
+
+	_, err = m.Unlock(expiredID, 1)
+	assert.Equal(t, errors.Is(err, ErrNoRecord), true)
+
+	lockout, err := m.Unlock(id, 1)
+	assert.NilError(t, err)
+	assert.Equal(t, lockout.UserID, 1)
+	until, err = m.LockedUntil("alice@example.com")
+	assert.NilError(t, err)
+	assert.Equal(t, until.IsZero(), true)
+	_, err = m.Unlock(id, 1)
+	assert.Equal(t, errors.Is(err, ErrNoRecord), true)
+
+	lockout, err = m.Unlock(ipID, 1)
+	assert.NilError(t, err)
+	assert.Equal(t, lockout.IP, "192.0.2.2")
+
+	lockouts, err = m.GetRecent(10)
+	assert.NilError(t, err)
+	assert.Equal(t, lockouts[2].UnlockedBy, "Alice Jones")
+	assert.Equal(t, lockouts[2].Active(), false)
+
+	_, failures, err = m.Fail("alice@example.com", time.Hour)
+	assert.NilError(t, err)
+	assert.Equal(t, failures, 1)
+	assert.NilError(t, m.Reset(1))
+}
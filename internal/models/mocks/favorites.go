@@ -0,0 +1,21 @@
+package mocks
+
+type FavoriteModel struct{}
+
+func (m *FavoriteModel) Add(userID int, noteID string) error {
+	return nil
+}
+
+func (m *FavoriteModel) Remove(userID int, noteID string) error {
+	return nil
+}
+
+func (m *FavoriteModel) GetForNotes(userID int, noteIDs ...string) (map[string]bool, error) {
+	favorites := make(map[string]bool)
+	for _, id := range noteIDs {
+		if userID == 1 && id == mockMarkdownNote.ID {
+			favorites[id] = true
+		}
+	}
+	return favorites, nil
+}
@@ -0,0 +1,76 @@
+package mocks
+
+import (
+	"time"
+
+	"github.com/Abdelrahman-habib/noter/internal/models"
+)
+
+var mockLockouts = []models.Lockout{
+	{
+		ID:       2,
+		IP:       "192.0.2.2",
+		Failures: 30,
+		Created:  time.Date(2024, 5, 5, 15, 0, 0, 0, time.UTC),
+		Expires:  time.Date(2024, 5, 5, 16, 0, 0, 0, time.UTC),
+	},
+	{
+		ID:        1,
+		UserID:    2,
+		UserName:  "bob",
+		UserEmail: "bob@example.com",
+		IP:        "192.0.2.1",
+		Failures:  10,
+		Created:   time.Now().Add(-time.Minute),
+		Expires:   time.Now().Add(time.Hour),
+	},
+}
+
+type LockoutModel struct{}
+
+func (m *LockoutModel) LockedUntil(email string) (time.Time, error) {
+	switch email {
+	case "locked@example.com":
+		return time.Now().Add(time.Minute), nil
+	default:
+		return time.Time{}, nil
+	}
+}
+
+func (m *LockoutModel) Fail(email string, forget time.Duration) (int, int, error) {
+	switch email {
+	case "alice@example.com":
+		return 1, 1, nil
+	case "bob@example.com":
+		return 2, 1, nil
+	case "dana@example.com":
+		return 3, 1, nil
+	default:
+		return 0, 0, models.ErrNoRecord
+	}
+}
+
+func (m *LockoutModel) Lock(userID int, until time.Time) error {
+	return nil
+}
+
+func (m *LockoutModel) Reset(userID int) error {
+	return nil
+}
+
+func (m *LockoutModel) Record(userID int, ip string, failures int, expires time.Time) (int, error) {
+	return 3, nil
+}
+
+func (m *LockoutModel) GetRecent(limit int) ([]models.Lockout, error) {
+	return mockLockouts, nil
+}
+
+func (m *LockoutModel) Unlock(id, adminID int) (models.Lockout, error) {
+	switch id {
+	case 1:
+		return mockLockouts[1], nil
+	default:
+		return models.Lockout{}, models.ErrNoRecord
+	}
+}
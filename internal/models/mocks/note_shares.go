@@ -0,0 +1,46 @@
+package mocks
+
+import (
+	"time"
+
+	"github.com/Abdelrahman-habib/noter/internal/models"
+)
+
+type NoteShareModel struct{}
+
+func (m *NoteShareModel) Grant(noteID string, userID int, permission string) error {
+	return nil
+}
+
+func (m *NoteShareModel) Revoke(noteID string, userID int) error {
+	switch userID {
+	case 2:
+		return nil
+	default:
+		return models.ErrNoRecord
+	}
+}
+
+func (m *NoteShareModel) Permission(noteID string, userID int) (string, error) {
+	switch {
+	case noteID == mockNote.ID && userID == 2:
+		return models.PermissionEdit, nil
+	case noteID == mockMarkdownNote.ID && userID == 2:
+		return models.PermissionView, nil
+	default:
+		return "", nil
+	}
+}
+
+func (m *NoteShareModel) GetAllForNote(noteID string) ([]models.NoteShare, error) {
+	return []models.NoteShare{
+		{
+			NoteID:     noteID,
+			UserID:     2,
+			UserName:   "bob",
+			UserEmail:  "bob@example.com",
+			Permission: models.PermissionEdit,
+			Created:    time.Date(2025, 9, 13, 10, 15, 0, 0, time.UTC),
+		},
+	}, nil
+}
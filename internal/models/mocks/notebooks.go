@@ -0,0 +1,50 @@
+package mocks
+
+import (
+	"slices"
+	"time"
+
+	"github.com/Abdelrahman-habib/noter/internal/models"
+)
+
+var mockNotebooks = []models.Notebook{
+	{ID: 1, Name: "Poems", Created: time.Date(2025, 9, 13, 10, 15, 0, 0, time.UTC), Notes: 2},
+	{ID: 2, ParentID: 1, Name: "Haiku", Created: time.Date(2025, 9, 13, 10, 16, 0, 0, time.UTC), Depth: 1, Notes: 1},
+	{ID: 3, Name: "Snippets", Created: time.Date(2025, 9, 13, 10, 17, 0, 0, time.UTC)},
+}
+
+type NotebookModel struct{}
+
+func (m *NotebookModel) Insert(userID int, name string, parentID int) (int, error) {
+	if parentID != 0 && !m.owns(parentID, userID) {
+		return 0, models.ErrNoRecord
+	}
+	return 4, nil
+}
+
+func (m *NotebookModel) GetAllForUser(userID int) ([]models.Notebook, error) {
+	if userID != 1 {
+		return nil, nil
+	}
+	return mockNotebooks, nil
+}
+
+func (m *NotebookModel) Delete(id int, userID int) error {
+	if !m.owns(id, userID) {
+		return models.ErrNoRecord
+	}
+	return nil
+}
+
+func (m *NotebookModel) MoveNotes(noteIDs []string, notebookID int, userID int) (int64, error) {
+	if notebookID != 0 && !m.owns(notebookID, userID) {
+		return 0, models.ErrNoRecord
+	}
+	return int64(len(noteIDs)), nil
+}
+
+func (m *NotebookModel) owns(id int, userID int) bool {
+	return userID == 1 && slices.ContainsFunc(mockNotebooks, func(n models.Notebook) bool {
+		return n.ID == id
+	})
+}
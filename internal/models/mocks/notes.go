@@ -1,6 +1,7 @@
 package mocks
 
 import (
+	"strings"
 	"time"
 
 	"github.com/Abdelrahman-habib/noter/internal/models"
@@ -10,10 +11,12 @@ var mockNote = models.Note{
 	ID:        "550e8400-e29b-41d4-a716-446655440000",
 	Title:     "An old silent pond",
 	Content:   "An old silent pond...",
+	Format:    models.FormatPlain,
 	Created:   time.Now(),
 	Expires:   time.Now(),
 	Public:    true,
 	CreatedBy: 1,
+	Version:   2,
 }
 
 var mockNoteWithUsername = models.NoteWithUsername{
@@ -21,36 +24,197 @@ var mockNoteWithUsername = models.NoteWithUsername{
 	Username: "John Doe",
 }
 
+var mockMarkdownNote = models.NoteWithUsername{
+	Note: models.Note{
+		ID:        "550e8400-e29b-41d4-a716-446655440003",
+		Title:     "Frog haiku",
+		Content:   "# A frog jumps\n\nInto the pond, *splash!* <script>alert(1)</script>",
+		Format:    models.FormatMarkdown,
+		Created:   time.Now(),
+		Expires:   time.Now(),
+		Public:    true,
+		CreatedBy: 1,
+	},
+	Username: "John Doe",
+}
+
+var mockCodeNote = models.NoteWithUsername{
+	Note: models.Note{
+		ID:        "550e8400-e29b-41d4-a716-446655440004",
+		Title:     "Hello, world",
+		Content:   "package main\n\nfunc main() {}",
+		Format:    models.FormatPlain,
+		Language:  "go",
+		Created:   time.Now(),
+		Expires:   time.Now(),
+		Public:    true,
+		CreatedBy: 1,
+	},
+	Username: "John Doe",
+}
+
+var mockBurnNote = models.NoteWithUsername{
+	Note: models.Note{
+		ID:               "550e8400-e29b-41d4-a716-446655440005",
+		Title:            "Self-destructing",
+		Content:          "This message will self-destruct.",
+		Format:           models.FormatPlain,
+		Created:          time.Now(),
+		Expires:          time.Now(),
+		Public:           true,
+		CreatedBy:        1,
+		BurnAfterReading: true,
+	},
+	Username: "John Doe",
+}
+
+var mockProtectedNote = models.NoteWithUsername{
+	Note: models.Note{
+		ID:        "550e8400-e29b-41d4-a716-446655440006",
+		Title:     "Locked away",
+		Content:   "Only for those who know the password.",
+		Format:    models.FormatPlain,
+		Created:   time.Now(),
+		Expires:   time.Now(),
+		Public:    false,
+		CreatedBy: 1,
+		Protected: true,
+	},
+	Username: "John Doe",
+}
+
 type NoteModel struct{}
 
-func (m *NoteModel) Insert(title string, content string, expires int, public bool, createdBy int) (string, error) {
-	return "550e8400-e29b-41d4-a716-446655440001", nil
+func (m *NoteModel) Insert(title string, content string, format string, language string, expires time.Time, public bool, burnAfterReading bool, password string, createdBy int) (string, error) {
+	return mockNote.ID, nil
 }
-func (m *NoteModel) Update(id string, title string, content string, expires int, public bool, createdBy int) (string, error) {
+func (m *NoteModel) Update(id string, version int, title string, content string, format string, language string, expires time.Time, public bool, createdBy int) (string, error) {
+	if id == mockNote.ID && version != mockNote.Version {
+		return "", models.ErrEditConflict
+	}
 	return "550e8400-e29b-41d4-a716-446655440001", nil
 }
+func (m *NoteModel) SetPinned(id string, pinned bool, createdBy int) error {
+	if id != mockNote.ID || createdBy != 1 {
+		return models.ErrNoRecord
+	}
+	return nil
+}
+
 func (m *NoteModel) Get(id string, createdBy *int) (models.NoteWithUsername, error) {
 	switch id {
 	case "550e8400-e29b-41d4-a716-446655440000":
 		return mockNoteWithUsername, nil
+	case mockMarkdownNote.ID:
+		return mockMarkdownNote, nil
+	case mockCodeNote.ID:
+		return mockCodeNote, nil
+	case mockBurnNote.ID:
+		return mockBurnNote, nil
+	case mockProtectedNote.ID:
+		// Like the real model, Get only returns the private protected note
+		// to its owner; GetForUnlock returns it to everyone.
+		if createdBy != nil && *createdBy == mockProtectedNote.CreatedBy {
+			return mockProtectedNote, nil
+		}
+		return models.NoteWithUsername{}, models.ErrNoRecord
 	default:
 		return models.NoteWithUsername{}, models.ErrNoRecord
 	}
 }
-func (m *NoteModel) Latest() ([]models.NoteWithUsername, error) {
+
+func (m *NoteModel) GetForUnlock(id string, createdBy *int) (models.NoteWithUsername, error) {
+	if id == mockProtectedNote.ID {
+		return mockProtectedNote, nil
+	}
+	return m.Get(id, createdBy)
+}
+
+func (m *NoteModel) Burn(id string, userID *int, unlocked bool) (models.NoteWithUsername, error) {
+	if id == mockBurnNote.ID && (userID == nil || *userID != mockBurnNote.CreatedBy) {
+		return mockBurnNote, nil
+	}
+	return models.NoteWithUsername{}, models.ErrNoRecord
+}
+func (m *NoteModel) SetExpiry(id string, expires time.Time, createdBy int) error {
+	if createdBy != 1 {
+		return models.ErrNoRecord
+	}
+	return nil
+}
+
+func (m *NoteModel) SetPassword(id string, password string, createdBy int) error {
+	if createdBy != 1 {
+		return models.ErrNoRecord
+	}
+	return nil
+}
+
+func (m *NoteModel) CheckPassword(id string, password string) error {
+	if id != mockProtectedNote.ID {
+		return models.ErrNoRecord
+	}
+	if password != "open sesame" {
+		return models.ErrInvalidCredentials
+	}
+	return nil
+}
+
+func (m *NoteModel) Latest(sort string) ([]models.NoteWithUsername, error) {
 	return []models.NoteWithUsername{mockNoteWithUsername}, nil
 }
 
-func (m *NoteModel) GetByPage(page int, limit int, public *bool, createdBy *int) ([]models.NoteWithUsername, models.PaginationMetaData, error) {
+func (m *NoteModel) GetByPage(page int, limit int, createdBy *int, filters models.NotesFilters) ([]models.NoteWithUsername, models.PaginationMetaData, error) {
+	if filters.FavoritedBy != 0 {
+		if filters.FavoritedBy != 1 {
+			return nil, models.PaginationMetaData{}, nil
+		}
+		return []models.NoteWithUsername{mockMarkdownNote}, models.PaginationMetaData{}, nil
+	}
 	return []models.NoteWithUsername{mockNoteWithUsername}, models.PaginationMetaData{
 		HasNext: false,
 	}, nil
 }
 
-func (m *NoteModel) GetTotalPages(public *bool, createdBy *int) (int, error) {
+func (m *NoteModel) GetTotalPages(createdBy *int, filters models.NotesFilters) (int, error) {
 	return 1, nil
 }
 
 func (m *NoteModel) Delete(id string, createdBy *int) error {
 	return nil
 }
+
+func (m *NoteModel) Search(query string, page int, limit int, userID *int) ([]models.NoteWithUsername, models.PaginationMetaData, error) {
+	if strings.Contains(strings.ToLower(mockNote.Content), strings.ToLower(query)) {
+		return []models.NoteWithUsername{mockNoteWithUsername}, models.PaginationMetaData{}, nil
+	}
+	return nil, models.PaginationMetaData{}, nil
+}
+
+func (m *NoteModel) GetTrash(page int, limit int, createdBy int) ([]models.NoteWithUsername, models.PaginationMetaData, error) {
+	trashed := mockNoteWithUsername
+	trashed.ID = "550e8400-e29b-41d4-a716-446655440002"
+	trashed.DeletedAt = time.Now()
+	return []models.NoteWithUsername{trashed}, models.PaginationMetaData{}, nil
+}
+
+func (m *NoteModel) Restore(id string, createdBy int) error {
+	switch id {
+	case "550e8400-e29b-41d4-a716-446655440002":
+		return nil
+	default:
+		return models.ErrNoRecord
+	}
+}
+
+func (m *NoteModel) DeletePermanently(id string, createdBy int) error {
+	return m.Restore(id, createdBy)
+}
+
+func (m *NoteModel) PurgeTrash(retention time.Duration, limit int) (int64, error) {
+	return 0, nil
+}
+
+func (m *NoteModel) DeleteExpired(limit int) (int64, error) {
+	return 0, nil
+}
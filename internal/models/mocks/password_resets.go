@@ -0,0 +1,30 @@
+package mocks
+
+import (
+	"time"
+
+	"github.com/Abdelrahman-habib/noter/internal/models"
+)
+
+type PasswordResetModel struct{}
+
+func (m *PasswordResetModel) Insert(userID int, ttl time.Duration) (string, error) {
+	return "MOCKRESETTOKENMOCKRESETTOKENMOCK", nil
+}
+
+func (m *PasswordResetModel) Exists(plaintext string) (bool, error) {
+	return plaintext == "validresettoken", nil
+}
+
+func (m *PasswordResetModel) Reset(plaintext, password string) (int, error) {
+	switch plaintext {
+	case "validresettoken":
+		return 1, nil
+	default:
+		return 0, models.ErrNoRecord
+	}
+}
+
+func (m *PasswordResetModel) DeleteExpired(limit int) (int64, error) {
+	return 0, nil
+}
@@ -0,0 +1,53 @@
+package mocks
+
+import (
+	"time"
+
+	"github.com/Abdelrahman-habib/noter/internal/models"
+)
+
+var mockRevisions = []models.Revision{
+	{
+		ID:         2,
+		NoteID:     mockNote.ID,
+		Number:     2,
+		Title:      mockNote.Title,
+		Content:    "An old silent pond...\nA frog jumps into the pond,\nsplash! Silence again.",
+		AuthorID:   1,
+		AuthorName: "John Doe",
+		Created:    time.Date(2025, 9, 14, 10, 15, 0, 0, time.UTC),
+	},
+	{
+		ID:         1,
+		NoteID:     mockNote.ID,
+		Number:     1,
+		Title:      mockNote.Title,
+		Content:    "An old silent pond...\nA frog jumps in,\nsplash! Silence again.",
+		AuthorID:   1,
+		AuthorName: "John Doe",
+		Created:    time.Date(2025, 9, 13, 10, 15, 0, 0, time.UTC),
+	},
+}
+
+type RevisionModel struct{}
+
+func (m *RevisionModel) GetAllForNote(noteID string) ([]models.Revision, error) {
+	if noteID != mockNote.ID {
+		return nil, nil
+	}
+	return mockRevisions, nil
+}
+
+func (m *RevisionModel) Get(noteID string, id int) (models.Revision, error) {
+	for _, r := range mockRevisions {
+		if r.NoteID == noteID && r.ID == id {
+			return r, nil
+		}
+	}
+	return models.Revision{}, models.ErrNoRecord
+}
+
+func (m *RevisionModel) Restore(noteID string, id int, userID int) error {
+	_, err := m.Get(noteID, id)
+	return err
+}
@@ -0,0 +1,49 @@
+package mocks
+
+import (
+	"time"
+
+	"github.com/Abdelrahman-habib/noter/internal/models"
+)
+
+type ShareLinkModel struct{}
+
+func (m *ShareLinkModel) Insert(noteID string, expires time.Time, maxViews int) (string, error) {
+	return "MOCKSHARELINKMOCKSHARELINKMOCKSH", nil
+}
+
+func (m *ShareLinkModel) Open(plaintext string) (models.NoteWithUsername, error) {
+	switch plaintext {
+	case "validsharelink":
+		shared := mockNoteWithUsername
+		shared.Public = false
+		return shared, nil
+	default:
+		return models.NoteWithUsername{}, models.ErrNoRecord
+	}
+}
+
+func (m *ShareLinkModel) GetAllForNote(noteID string) ([]models.ShareLink, error) {
+	return []models.ShareLink{
+		{
+			ID:       1,
+			NoteID:   noteID,
+			Created:  time.Date(2025, 9, 13, 10, 15, 0, 0, time.UTC),
+			MaxViews: 5,
+			Views:    2,
+		},
+	}, nil
+}
+
+func (m *ShareLinkModel) Delete(id int, noteID string) error {
+	switch id {
+	case 1:
+		return nil
+	default:
+		return models.ErrNoRecord
+	}
+}
+
+func (m *ShareLinkModel) DeleteExpired(limit int) (int64, error) {
+	return 0, nil
+}
@@ -0,0 +1,17 @@
+package mocks
+
+type TagModel struct{}
+
+func (m *TagModel) SetForNote(noteID string, names []string) error {
+	return nil
+}
+
+func (m *TagModel) GetForNotes(noteIDs ...string) (map[string][]string, error) {
+	tags := make(map[string][]string)
+	for _, id := range noteIDs {
+		if id == mockNote.ID {
+			tags[id] = []string{"haiku", "poetry"}
+		}
+	}
+	return tags, nil
+}
@@ -0,0 +1,45 @@
+package mocks
+
+import (
+	"time"
+
+	"github.com/Abdelrahman-habib/noter/internal/models"
+)
+
+type TokenModel struct{}
+
+func (m *TokenModel) Insert(userID int, name, scope string) (string, error) {
+	return "noter_MOCKTOKENMOCKTOKENMOCKTOKENMOCK", nil
+}
+
+func (m *TokenModel) Authenticate(plaintext string) (int, string, error) {
+	switch plaintext {
+	case "noter_validwritetoken":
+		return 1, models.ScopeWrite, nil
+	case "noter_validreadtoken":
+		return 1, models.ScopeRead, nil
+	default:
+		return 0, "", models.ErrInvalidCredentials
+	}
+}
+
+func (m *TokenModel) GetAllForUser(userID int) ([]models.Token, error) {
+	return []models.Token{
+		{
+			ID:      1,
+			UserID:  userID,
+			Name:    "backup script",
+			Scope:   models.ScopeRead,
+			Created: time.Date(2025, 9, 13, 10, 15, 0, 0, time.UTC),
+		},
+	}, nil
+}
+
+func (m *TokenModel) Delete(id int, userID int) error {
+	switch id {
+	case 1:
+		return nil
+	default:
+		return models.ErrNoRecord
+	}
+}
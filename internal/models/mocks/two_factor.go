@@ -0,0 +1,46 @@
+package mocks
+
+import (
+	"github.com/Abdelrahman-habib/noter/internal/models"
+)
+
+var mockRecoveryCodes = []string{
+	"abcde-fghjk", "bcdef-ghjkm", "cdefg-hjkmn", "defgh-jkmnp", "efghj-kmnpq",
+	"fghjk-mnpqr", "ghjkm-npqrs", "hjkmn-pqrst", "jkmnp-qrstv", "kmnpq-rstvw",
+}
+
+type TwoFactorModel struct{}
+
+func (m *TwoFactorModel) Enable(userID int, secret string) ([]string, error) {
+	return mockRecoveryCodes, nil
+}
+
+func (m *TwoFactorModel) Disable(userID int) error {
+	return nil
+}
+
+func (m *TwoFactorModel) Verify(userID int, code string) error {
+	switch {
+	case userID == 3 && code == "123456":
+		return nil
+	default:
+		return models.ErrInvalidCredentials
+	}
+}
+
+func (m *TwoFactorModel) UseRecoveryCode(userID int, code string) error {
+	switch {
+	case userID == 3 && code == mockRecoveryCodes[0]:
+		return nil
+	default:
+		return models.ErrInvalidCredentials
+	}
+}
+
+func (m *TwoFactorModel) RegenerateRecoveryCodes(userID int) ([]string, error) {
+	return mockRecoveryCodes, nil
+}
+
+func (m *TwoFactorModel) RecoveryCodesLeft(userID int) (int, error) {
+	return len(mockRecoveryCodes), nil
+}
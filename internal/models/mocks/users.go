@@ -17,35 +17,81 @@ func (m *UserModel) Insert(name, email, password string) (int, error) {
 	}
 }
 func (m *UserModel) Authenticate(email, password string) (int, error) {
-	if email == "alice@example.com" && password == "pa$$word" {
+	switch {
+	case email == "alice@example.com" && password == "pa$$word":
 		return 1, nil
+	case email == "bob@example.com" && password == "pa$$word":
+		return 2, nil
+	case email == "dana@example.com" && password == "pa$$word":
+		return 3, nil
+	default:
+		return 0, models.ErrInvalidCredentials
 	}
-	return 0, models.ErrInvalidCredentials
 }
 
 func (m *UserModel) Exists(id int) (bool, error) {
 	switch id {
-	case 1:
+	case 1, 2, 3:
 		return true, nil
 	default:
 		return false, nil
 	}
 }
 
+func (m *UserModel) SessionGeneration(id int) (int, error) {
+	switch id {
+	case 1, 2, 3:
+		return 0, nil
+	default:
+		return 0, models.ErrNoRecord
+	}
+}
+
 func (m *UserModel) GetByID(id int) (models.User, error) {
 	switch id {
 	case 1:
 		return models.User{
-			Email:   "alice@example.com",
-			ID:      1,
-			Name:    "alice",
-			Created: time.Date(2012, 2, 2, 12, 10, 0, 0, time.Local),
+			Email:         "alice@example.com",
+			ID:            1,
+			Name:          "alice",
+			Created:       time.Date(2012, 2, 2, 12, 10, 0, 0, time.Local),
+			EmailVerified: true,
+			Admin:         true,
+		}, nil
+	case 2:
+		return models.User{
+			Email:   "bob@example.com",
+			ID:      2,
+			Name:    "bob",
+			Created: time.Date(2013, 3, 3, 13, 10, 0, 0, time.Local),
+		}, nil
+	case 3:
+		return models.User{
+			Email:            "dana@example.com",
+			ID:               3,
+			Name:             "dana",
+			Created:          time.Date(2014, 4, 4, 14, 10, 0, 0, time.Local),
+			EmailVerified:    true,
+			TwoFactorEnabled: true,
 		}, nil
 	default:
 		return models.User{}, nil
 	}
 }
 
+func (m *UserModel) GetByEmail(email string) (models.User, error) {
+	switch email {
+	case "alice@example.com":
+		return m.GetByID(1)
+	case "bob@example.com":
+		return m.GetByID(2)
+	case "dana@example.com":
+		return m.GetByID(3)
+	default:
+		return models.User{}, models.ErrNoRecord
+	}
+}
+
 func (m *UserModel) ChangePassword(id int, current, new string) error {
 	switch id {
 	case 1:
@@ -57,3 +103,12 @@ func (m *UserModel) ChangePassword(id int, current, new string) error {
 		return models.ErrNoRecord
 	}
 }
+
+func (m *UserModel) VerifyEmail(id int, email string) error {
+	switch {
+	case id == 1 && email == "alice@example.com", id == 2 && email == "bob@example.com":
+		return nil
+	default:
+		return models.ErrNoRecord
+	}
+}
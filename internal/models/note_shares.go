@@ -0,0 +1,97 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// The permissions a note can be shared with. Edit implies view.
+const (
+	PermissionView = "view"
+	PermissionEdit = "edit"
+)
+
+// A NoteShare grants a named user access to somebody else's note.
+type NoteShare struct {
+	NoteID     string
+	UserID     int
+	UserName   string
+	UserEmail  string
+	Permission string
+	Created    time.Time
+}
+
+type NoteShareModel struct {
+	DB      *sql.DB
+	Dialect Dialect
+}
+
+type NoteShareModelInterface interface {
+	Grant(noteID string, userID int, permission string) error
+	Revoke(noteID string, userID int) error
+	Permission(noteID string, userID int) (string, error)
+	GetAllForNote(noteID string) ([]NoteShare, error)
+}
+
+// Grant shares a note with a user, or changes the permission they already
+// have.
+func (m *NoteShareModel) Grant(noteID string, userID int, permission string) error {
+	_, err := m.DB.Exec(m.Dialect.rebind(m.Dialect.upsertNoteShare()), noteID, userID, permission, now())
+	return err
+}
+
+// Revoke stops sharing a note with a user.
+func (m *NoteShareModel) Revoke(noteID string, userID int) error {
+	stmt := `DELETE FROM note_shares WHERE note_id = ? AND user_id = ?`
+	result, err := m.DB.Exec(m.Dialect.rebind(stmt), noteID, userID)
+	if err != nil {
+		return err
+	}
+	return expectAffected(result)
+}
+
+// Permission returns the permission a note has been shared with a user, or
+// "" when it hasn't been shared with them.
+func (m *NoteShareModel) Permission(noteID string, userID int) (string, error) {
+	var permission string
+
+	stmt := `SELECT permission FROM note_shares WHERE note_id = ? AND user_id = ?`
+	err := m.DB.QueryRow(m.Dialect.rebind(stmt), noteID, userID).Scan(&permission)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", nil
+		}
+		return "", err
+	}
+	return permission, nil
+}
+
+// GetAllForNote returns the users a note is shared with, by name.
+func (m *NoteShareModel) GetAllForNote(noteID string) ([]NoteShare, error) {
+	stmt := `SELECT note_shares.note_id, note_shares.user_id, users.name, users.email, note_shares.permission, note_shares.created
+	FROM note_shares
+	JOIN users ON note_shares.user_id = users.id
+	WHERE note_shares.note_id = ?
+	ORDER BY users.name, users.id`
+
+	rows, err := m.DB.Query(m.Dialect.rebind(stmt), noteID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var shares []NoteShare
+	for rows.Next() {
+		var s NoteShare
+		err := rows.Scan(&s.NoteID, &s.UserID, &s.UserName, &s.UserEmail, &s.Permission, &s.Created)
+		if err != nil {
+			return nil, err
+		}
+		shares = append(shares, s)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return shares, nil
+}
@@ -0,0 +1,82 @@
+package models
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Abdelrahman-habib/noter/internal/assert"
+)
+
+func TestNoteShareModel(t *testing.T) {
+	if testing.Short() {
+		t.Skip("models: skipping integration test")
+	}
+
+	db := newTestDB(t)
+	dialect := testDialect(t)
+	users := UserModel{DB: db, Dialect: dialect}
+	notes := NoteModel{DB: db, Dialect: dialect}
+	m := NoteShareModel{DB: db, Dialect: dialect}
+
+	// The seeded private note belongs to Alice.
+	noteID := "550e8400-e29b-41d4-a716-446655440002"
+	bobID, err := users.Insert("Bob", "bob@example.com", "pa$$word")
+	assert.NilError(t, err)
+	bob, err := users.GetByEmail("bob@example.com")
+	assert.NilError(t, err)
+	assert.Equal(t, bob.ID, bobID)
+
+	_, err = notes.Get(noteID, &bob.ID)
+	assert.Equal(t, errors.Is(err, ErrNoRecord), true)
+
+	err = m.Grant(noteID, bob.ID, PermissionView)
+	assert.NilError(t, err)
+	permission, err := m.Permission(noteID, bob.ID)
+	assert.NilError(t, err)
+	assert.Equal(t, permission, PermissionView)
+
+	note, err := notes.Get(noteID, &bob.ID)
+	assert.NilError(t, err)
+	assert.Equal(t, note.Public, false)
+	_, err = notes.Update(noteID, note.Version, "Edited", "Edited", FormatPlain, "", time.Now().AddDate(0, 0, 7), true, bob.ID)
+	assert.Equal(t, errors.Is(err, ErrNoRecord), true)
+
+	// Granting again changes the permission rather than failing, even when
+	// it stays the same.
+	err = m.Grant(noteID, bob.ID, PermissionView)
+	assert.NilError(t, err)
+	err = m.Grant(noteID, bob.ID, PermissionEdit)
+	assert.NilError(t, err)
+	err = m.Grant(noteID, bob.ID, PermissionEdit)
+	assert.NilError(t, err)
+	permission, err = m.Permission(noteID, bob.ID)
+	assert.NilError(t, err)
+	assert.Equal(t, permission, PermissionEdit)
+	_, err = notes.Update(noteID, note.Version, "Edited", "Edited", FormatPlain, "", time.Now().AddDate(0, 0, 7), true, bob.ID)
+	assert.NilError(t, err)
+	note, err = notes.Get(noteID, &bob.ID)
+	assert.NilError(t, err)
+	assert.Equal(t, note.Title, "Edited")
+	assert.Equal(t, note.Public, false)
+	assert.Equal(t, note.CreatedBy, 1)
+
+	err = notes.Delete(noteID, &bob.ID)
+	assert.Equal(t, errors.Is(err, ErrNoRecord), true)
+
+	shared, _, err := notes.GetByPage(1, 10, nil, NotesFilters{SharedWith: bob.ID})
+	assert.NilError(t, err)
+	assert.Equal(t, len(shared), 1)
+
+	grants, err := m.GetAllForNote(noteID)
+	assert.NilError(t, err)
+	assert.Equal(t, len(grants), 1)
+	assert.Equal(t, grants[0].UserEmail, "bob@example.com")
+
+	err = m.Revoke(noteID, bob.ID)
+	assert.NilError(t, err)
+	err = m.Revoke(noteID, bob.ID)
+	assert.Equal(t, errors.Is(err, ErrNoRecord), true)
+	_, err = notes.Get(noteID, &bob.ID)
+	assert.Equal(t, errors.Is(err, ErrNoRecord), true)
+}
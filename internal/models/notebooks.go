@@ -0,0 +1,192 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+)
+
+// A Notebook groups some of a user's notes. Notebooks can be nested in one
+// another; notes belong to at most one notebook.
+type Notebook struct {
+	ID       int
+	ParentID int // zero for top-level notebooks
+	Name     string
+	Created  time.Time
+	// Depth is the number of notebooks this one is nested in, and Notes the
+	// number of live notes filed directly in it.
+	Depth int
+	Notes int
+}
+
+type NotebookModel struct {
+	DB      *sql.DB
+	Dialect Dialect
+}
+
+type NotebookModelInterface interface {
+	Insert(userID int, name string, parentID int) (int, error)
+	GetAllForUser(userID int) ([]Notebook, error)
+	Delete(id int, userID int) error
+	MoveNotes(noteIDs []string, notebookID int, userID int) (int64, error)
+}
+
+// Insert creates a notebook for a user, nested in parentID unless it is zero.
+// It returns ErrNoRecord when the parent isn't one of the user's notebooks.
+func (m *NotebookModel) Insert(userID int, name string, parentID int) (int, error) {
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var parent any
+	if parentID != 0 {
+		err = m.checkOwner(tx, parentID, userID)
+		if err != nil {
+			return 0, err
+		}
+		parent = parentID
+	}
+
+	stmt := `INSERT INTO notebooks (user_id, parent_id, name, created) VALUES (?, ?, ?, ?)`
+	id, err := m.Dialect.insertID(tx, stmt, userID, parent, name, now())
+	if err != nil {
+		return 0, err
+	}
+	return int(id), tx.Commit()
+}
+
+// GetAllForUser returns the notebooks of a user in outline order: each
+// notebook is followed by the notebooks nested in it, and siblings are sorted
+// by name.
+func (m *NotebookModel) GetAllForUser(userID int) ([]Notebook, error) {
+	stmt := `SELECT notebooks.id, notebooks.parent_id, notebooks.name, notebooks.created,
+	(SELECT COUNT(*) FROM notes WHERE notes.notebook_id = notebooks.id AND notes.deleted_at IS NULL AND ` + notExpired + `)
+	FROM notebooks
+	WHERE notebooks.user_id = ?
+	ORDER BY notebooks.name, notebooks.id`
+
+	rows, err := m.DB.Query(m.Dialect.rebind(stmt), now(), userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	children := make(map[int][]Notebook)
+	for rows.Next() {
+		var n Notebook
+		var parentID sql.NullInt64
+		err := rows.Scan(&n.ID, &parentID, &n.Name, &n.Created, &n.Notes)
+		if err != nil {
+			return nil, err
+		}
+		n.ParentID = int(parentID.Int64)
+		children[n.ParentID] = append(children[n.ParentID], n)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	var notebooks []Notebook
+	var walk func(parentID, depth int)
+	walk = func(parentID, depth int) {
+		for _, n := range children[parentID] {
+			n.Depth = depth
+			notebooks = append(notebooks, n)
+			walk(n.ID, depth+1)
+		}
+	}
+	walk(0, 0)
+	return notebooks, nil
+}
+
+// Delete removes one of a user's notebooks. Its notes and the notebooks
+// nested in it move up to its parent, or out of any notebook for a top-level
+// one.
+func (m *NotebookModel) Delete(id int, userID int) error {
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var parentID sql.NullInt64
+	stmt := `SELECT parent_id FROM notebooks WHERE id = ? AND user_id = ?` + m.Dialect.forUpdate()
+	err = tx.QueryRow(m.Dialect.rebind(stmt), id, userID).Scan(&parentID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrNoRecord
+		}
+		return err
+	}
+
+	_, err = tx.Exec(m.Dialect.rebind(`UPDATE notes SET notebook_id = ? WHERE notebook_id = ?`), parentID, id)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(m.Dialect.rebind(`UPDATE notebooks SET parent_id = ? WHERE parent_id = ?`), parentID, id)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(m.Dialect.rebind(`DELETE FROM notebooks WHERE id = ?`), id)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// MoveNotes files the given notes of a user in one of their notebooks, or
+// takes them out of any notebook when notebookID is zero, and returns how many
+// were moved. Notes the user doesn't own are left alone. It returns
+// ErrNoRecord when the notebook isn't one of the user's.
+func (m *NotebookModel) MoveNotes(noteIDs []string, notebookID int, userID int) (int64, error) {
+	if len(noteIDs) == 0 {
+		return 0, nil
+	}
+
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var notebook any
+	if notebookID != 0 {
+		err = m.checkOwner(tx, notebookID, userID)
+		if err != nil {
+			return 0, err
+		}
+		notebook = notebookID
+	}
+
+	stmt := `UPDATE notes SET notebook_id = ?
+	WHERE created_by = ? AND deleted_at IS NULL AND id IN (?` + strings.Repeat(", ?", len(noteIDs)-1) + `)`
+	args := []any{notebook, userID}
+	for _, id := range noteIDs {
+		args = append(args, id)
+	}
+
+	result, err := tx.Exec(m.Dialect.rebind(stmt), args...)
+	if err != nil {
+		return 0, err
+	}
+	moved, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	return moved, tx.Commit()
+}
+
+// checkOwner returns ErrNoRecord unless the notebook belongs to the user, and
+// locks it so that it can't be deleted before tx commits.
+func (m *NotebookModel) checkOwner(tx *sql.Tx, id int, userID int) error {
+	var exists int
+	stmt := `SELECT 1 FROM notebooks WHERE id = ? AND user_id = ?` + m.Dialect.forUpdate()
+	err := tx.QueryRow(m.Dialect.rebind(stmt), id, userID).Scan(&exists)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrNoRecord
+	}
+	return err
+}
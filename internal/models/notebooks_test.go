@@ -0,0 +1,67 @@
+package models
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Abdelrahman-habib/noter/internal/assert"
+)
+
+func TestNotebookModel(t *testing.T) {
+	if testing.Short() {
+		t.Skip("models: skipping integration test")
+	}
+
+	db := newTestDB(t)
+	m := NotebookModel{DB: db, Dialect: testDialect(t)}
+	notes := NoteModel{DB: db, Dialect: testDialect(t)}
+	owner := 1
+
+	work, err := m.Insert(owner, "Work", 0)
+	assert.NilError(t, err)
+	projects, err := m.Insert(owner, "Projects", work)
+	assert.NilError(t, err)
+	archive, err := m.Insert(owner, "Archive", 0)
+	assert.NilError(t, err)
+
+	// Other users can't nest notebooks in, or move notes to, this one.
+	_, err = m.Insert(2, "Mine", work)
+	assert.Equal(t, errors.Is(err, ErrNoRecord), true)
+
+	noteID, err := notes.Insert("Plan", "Ship it", FormatPlain, "", time.Now().Add(time.Hour), false, false, "", owner)
+	assert.NilError(t, err)
+	_, err = m.MoveNotes([]string{noteID}, projects, 2)
+	assert.Equal(t, errors.Is(err, ErrNoRecord), true)
+	moved, err := m.MoveNotes([]string{noteID}, projects, owner)
+	assert.NilError(t, err)
+	assert.Equal(t, moved, int64(1))
+
+	notebooks, err := m.GetAllForUser(owner)
+	assert.NilError(t, err)
+	assert.Equal(t, len(notebooks), 3)
+	assert.Equal(t, notebooks[0].ID, archive)
+	assert.Equal(t, notebooks[1].ID, work)
+	assert.Equal(t, notebooks[2].ID, projects)
+	assert.Equal(t, notebooks[2].Depth, 1)
+	assert.Equal(t, notebooks[2].Notes, 1)
+
+	filed, _, err := notes.GetByPage(1, 10, &owner, NotesFilters{NotebookID: projects})
+	assert.NilError(t, err)
+	assert.Equal(t, len(filed), 1)
+	assert.Equal(t, filed[0].NotebookID, projects)
+
+	// Deleting a notebook moves its note up to the parent.
+	err = m.Delete(projects, 2)
+	assert.Equal(t, errors.Is(err, ErrNoRecord), true)
+	assert.NilError(t, m.Delete(projects, owner))
+	note, err := notes.Get(noteID, &owner)
+	assert.NilError(t, err)
+	assert.Equal(t, note.NotebookID, work)
+
+	// And a top-level notebook's notes out of any notebook.
+	assert.NilError(t, m.Delete(work, owner))
+	note, err = notes.Get(noteID, &owner)
+	assert.NilError(t, err)
+	assert.Equal(t, note.NotebookID, 0)
+}
@@ -6,96 +6,332 @@ import (
 	"time"
 
 	"github.com/google/uuid"
+	"golang.org/x/crypto/bcrypt"
 )
 
 // Define a Note type to hold the data for an individual note. Notice how
-// the fields of the struct correspond to the fields in our MySQL notes
-// table?
+// the fields of the struct correspond to the fields in our notes table?
 type Note struct {
-	ID        string
-	Title     string
-	Content   string
-	Created   time.Time
-	Public    bool
-	CreatedBy int
-	Expires   time.Time
+	ID        string    `json:"id"`
+	Title     string    `json:"title"`
+	Content   string    `json:"content"`
+	Format    string    `json:"format"`
+	Language  string    `json:"language"`
+	Created   time.Time `json:"created"`
+	Updated   time.Time `json:"updated"`
+	Public    bool      `json:"public"`
+	CreatedBy int       `json:"created_by"`
+	// Expires is zero, and left out of the JSON, when the note never expires.
+	Expires   time.Time `json:"expires,omitzero"`
+	Tags      []string  `json:"tags"`
+	DeletedAt time.Time `json:"-"`
+	// BurnAfterReading notes are deleted the first time someone other than
+	// their owner reads them.
+	BurnAfterReading bool `json:"burn_after_reading"`
+	// Protected notes have an access password, which anyone but their owner
+	// and the users they are shared with must enter to read them.
+	Protected bool `json:"protected"`
+	// Version goes up by one every time the note's content is changed, so
+	// an edit based on an older version can be told apart.
+	Version int `json:"version"`
+	// NotebookID is the owner's notebook the note is filed in, zero for
+	// none.
+	NotebookID int `json:"notebook_id,omitempty"`
+	// Pinned notes are listed first on their owner's notes page.
+	Pinned bool `json:"pinned"`
 }
 
+// The formats a note's content can be written in. Plain text is shown as is,
+// Markdown is rendered to HTML when the note is displayed.
+const (
+	FormatPlain    = "plain"
+	FormatMarkdown = "markdown"
+)
+
 type NoteWithUsername struct {
 	Note
-	Username string
+	Username string `json:"username"`
 }
 
+// The orders GetByPage and Latest can list notes in. Newest notes, and
+// most recently updated ones, come first; notes expiring soonest come first,
+// with the ones that never expire last; titles are sorted case-insensitively.
+const (
+	SortCreated = "created"
+	SortUpdated = "updated"
+	SortExpires = "expires"
+	SortTitle   = "title"
+)
+
+// NoteSorts lists the sort orders, the default one first.
+var NoteSorts = []string{SortCreated, SortUpdated, SortExpires, SortTitle}
+
+// sortOrders holds the ORDER BY clause of each sort order. Ids are random,
+// so they only serve as a tiebreaker keeping pagination stable.
+var sortOrders = map[string]string{
+	SortCreated: `notes.created DESC, notes.id DESC`,
+	SortUpdated: `notes.updated DESC, notes.id DESC`,
+	SortExpires: `notes.expires IS NULL, notes.expires, notes.id`,
+	SortTitle:   `LOWER(notes.title), notes.id`,
+}
+
+// orderBy returns the ORDER BY clause of sort, falling back to SortCreated
+// for an empty or unknown sort order.
+func orderBy(sort string) string {
+	if order, ok := sortOrders[sort]; ok {
+		return order
+	}
+	return sortOrders[SortCreated]
+}
+
+// NotesFilters narrows the notes returned by GetByPage. A nil ShowPublic
+// returns public and private notes alike; an empty Tag disables tag filtering.
+// A non-zero SharedWith only returns the notes shared with that user.
 type NotesFilters struct {
 	ShowPublic *bool
+	Tag        string
+	SharedWith int
+	// NotebookID only keeps the notes filed directly in that notebook.
+	NotebookID int
+	// FavoritedBy only keeps the notes that user starred and can still see.
+	FavoritedBy int
+	// PinnedFirst lists pinned notes, most recently pinned first, before
+	// the others.
+	PinnedFirst bool
+	// Sort is one of NoteSorts, SortCreated when empty.
+	Sort string
+	// HideRestricted leaves out burn-after-reading and password-protected
+	// notes, whose previews would give their content away, from listings
+	// shown to anyone but their owner.
+	HideRestricted bool
 }
 
 // Define a NoteModel type which wraps a sql.DB connection pool.
 type NoteModel struct {
-	DB *sql.DB
+	DB      *sql.DB
+	Dialect Dialect
 }
 
 type PaginationMetaData struct {
-	HasNext bool
+	HasNext bool `json:"has_next"`
 }
 
 type NoteModelInterface interface {
-	Insert(title string, content string, expires int, public bool, createdBy int) (string, error)
-	Update(id string, title string, content string, expires int, public bool, createdBy int) (string, error)
+	Insert(title string, content string, format string, language string, expires time.Time, public bool, burnAfterReading bool, password string, createdBy int) (string, error)
+	Update(id string, version int, title string, content string, format string, language string, expires time.Time, public bool, createdBy int) (string, error)
+	SetExpiry(id string, expires time.Time, createdBy int) error
+	SetPinned(id string, pinned bool, createdBy int) error
 	Get(id string, createdBy *int) (NoteWithUsername, error)
-	Latest() ([]NoteWithUsername, error)
-	GetByPage(page int, limit int, public *bool, createdBy *int) ([]NoteWithUsername, PaginationMetaData, error)
-	GetTotalPages(public *bool, createdBy *int) (int, error)
+	GetForUnlock(id string, createdBy *int) (NoteWithUsername, error)
+	Burn(id string, userID *int, unlocked bool) (NoteWithUsername, error)
+	SetPassword(id string, password string, createdBy int) error
+	CheckPassword(id string, password string) error
+	Latest(sort string) ([]NoteWithUsername, error)
+	GetByPage(page int, limit int, createdBy *int, filters NotesFilters) ([]NoteWithUsername, PaginationMetaData, error)
+	GetTotalPages(createdBy *int, filters NotesFilters) (int, error)
 	Delete(id string, createdBy *int) error
+	GetTrash(page int, limit int, createdBy int) ([]NoteWithUsername, PaginationMetaData, error)
+	Restore(id string, createdBy int) error
+	DeletePermanently(id string, createdBy int) error
+	PurgeTrash(retention time.Duration, limit int) (int64, error)
+	DeleteExpired(limit int) (int64, error)
+	Search(query string, page int, limit int, userID *int) ([]NoteWithUsername, PaginationMetaData, error)
 }
 
-// This will insert a new notes into the database.
+// noteColumns lists the columns selected for a NoteWithUsername, in the order
+// scanNote reads them. Queries using it must join users.
+const noteColumns = `notes.id, notes.title, notes.content, notes.format, notes.language, notes.created, notes.updated, notes.expires, notes.public, notes.created_by, notes.deleted_at, notes.burn_after_reading, notes.hashed_password IS NOT NULL, notes.version, notes.notebook_id, notes.pinned_at IS NOT NULL, users.name`
+
+// sharedWith is a condition matching the notes shared with the user bound to
+// its ? placeholder, and sharedWithPermission additionally binds the
+// permission they must have been granted.
+const (
+	sharedWith           = `EXISTS (SELECT 1 FROM note_shares WHERE note_shares.note_id = notes.id AND note_shares.user_id = ?)`
+	sharedWithPermission = `EXISTS (SELECT 1 FROM note_shares WHERE note_shares.note_id = notes.id AND note_shares.user_id = ? AND note_shares.permission = ?)`
+)
+
+// notExpired matches the notes that haven't expired at the time bound to its
+// ? placeholder. Notes with a NULL expiry never expire, so they always match.
+const notExpired = `(notes.expires IS NULL OR notes.expires > ?)`
 
-func (m *NoteModel) Insert(title string, content string, expires int, public bool, createdBy int) (string, error) {
-	stmt := `INSERT INTO notes (id, title, content, created, expires, public, created_by) VALUES (?, ?, ?, UTC_TIMESTAMP(), DATE_ADD(UTC_TIMESTAMP(), INTERVAL ? DAY), ?, ?)`
+// unrestricted matches the notes that can be listed with their content, as
+// opposed to burn-after-reading and password-protected ones.
+const unrestricted = `notes.burn_after_reading = FALSE AND notes.hashed_password IS NULL`
+
+// rowScanner is satisfied by both *sql.Row and *sql.Rows.
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+// scanNote reads a note selected with noteColumns.
+func scanNote(row rowScanner) (NoteWithUsername, error) {
+	var s NoteWithUsername
+	var expires, deletedAt sql.NullTime
+	var notebookID sql.NullInt64
+	err := row.Scan(&s.ID, &s.Title, &s.Content, &s.Format, &s.Language, &s.Created, &s.Updated, &expires, &s.Public, &s.CreatedBy, &deletedAt, &s.BurnAfterReading, &s.Protected, &s.Version, &notebookID, &s.Pinned, &s.Username)
+	s.Expires = expires.Time
+	s.DeletedAt = deletedAt.Time
+	s.NotebookID = int(notebookID.Int64)
+	return s, err
+}
+
+// This will insert a new notes into the database, along with its first
+// revision. A zero expires never expires and a non-empty password protects
+// the note.
+func (m *NoteModel) Insert(title string, content string, format string, language string, expires time.Time, public bool, burnAfterReading bool, password string, createdBy int) (string, error) {
+	hashedPassword, err := hashNotePassword(password)
+	if err != nil {
+		return "", err
+	}
+
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback()
+
+	stmt := `INSERT INTO notes (id, title, content, format, language, created, updated, expires, public, burn_after_reading, hashed_password, created_by) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
 	id := uuid.New().String()
+	created := now()
+
+	_, err = tx.Exec(m.Dialect.rebind(stmt), id, title, content, format, language, created, created, nullTime(expires), public, burnAfterReading, hashedPassword, createdBy)
+	if err != nil {
+		return "", err
+	}
 
-	_, err := m.DB.Exec(stmt, id, title, content, expires, public, createdBy)
+	err = insertRevision(tx, m.Dialect, id, title, content, createdBy)
 	if err != nil {
 		return "", err
 	}
-	return id, nil
+	return id, tx.Commit()
 }
 
-func (m *NoteModel) Update(id string, title string, content string, expires int, public bool, createdBy int) (string, error) {
-	stmt := `UPDATE notes SET title = ?, content = ?, expires = DATE_ADD(UTC_TIMESTAMP(), INTERVAL ? DAY), public = ?, created_by = ? WHERE id = ? AND created_by = ?`
-	_, err := m.DB.Exec(stmt, title, content, expires, public, createdBy, id, createdBy)
+// Update overwrites a note and records a new revision, authored by userID,
+// when its title or content changed. The owner may change everything; users
+// the note is shared with for editing may change its content but not its
+// expiry or visibility. It returns ErrNoRecord when userID may not edit the
+// note, and ErrEditConflict when the note has changed since the version the
+// edit is based on.
+func (m *NoteModel) Update(id string, version int, title string, content string, format string, language string, expires time.Time, public bool, userID int) (string, error) {
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback()
+
+	var oldTitle, oldContent string
+	var createdBy, currentVersion int
+	stmt := `SELECT title, content, created_by, version FROM notes
+	WHERE id = ? AND deleted_at IS NULL AND (created_by = ? OR ` + sharedWithPermission + `)` + m.Dialect.forUpdate()
+	err = tx.QueryRow(m.Dialect.rebind(stmt), id, userID, userID, PermissionEdit).Scan(&oldTitle, &oldContent, &createdBy, &currentVersion)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return "", ErrNoRecord
 		}
 		return "", err
 	}
-	return id, nil
+	if currentVersion != version {
+		return "", ErrEditConflict
+	}
+
+	// The version check is repeated in the UPDATE for the dialects without
+	// row locks, where another edit may have slipped in since the SELECT.
+	var result sql.Result
+	if createdBy == userID {
+		stmt = `UPDATE notes SET title = ?, content = ?, format = ?, language = ?, expires = ?, public = ?, updated = ?, version = version + 1 WHERE id = ? AND version = ?`
+		result, err = tx.Exec(m.Dialect.rebind(stmt), title, content, format, language, nullTime(expires), public, now(), id, version)
+	} else {
+		stmt = `UPDATE notes SET title = ?, content = ?, format = ?, language = ?, updated = ?, version = version + 1 WHERE id = ? AND version = ?`
+		result, err = tx.Exec(m.Dialect.rebind(stmt), title, content, format, language, now(), id, version)
+	}
+	if err != nil {
+		return "", err
+	}
+	err = expectAffected(result)
+	if errors.Is(err, ErrNoRecord) {
+		return "", ErrEditConflict
+	} else if err != nil {
+		return "", err
+	}
+
+	if title != oldTitle || content != oldContent {
+		err = insertRevision(tx, m.Dialect, id, title, content, userID)
+		if err != nil {
+			return "", err
+		}
+	}
+	return id, tx.Commit()
+}
+
+// SetPinned pins one of a user's notes to the top of their notes page, or
+// unpins it. Pinning a pinned note keeps its original pin time.
+func (m *NoteModel) SetPinned(id string, pinned bool, createdBy int) error {
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var exists int
+	stmt := `SELECT 1 FROM notes WHERE id = ? AND created_by = ? AND deleted_at IS NULL` + m.Dialect.forUpdate()
+	err = tx.QueryRow(m.Dialect.rebind(stmt), id, createdBy).Scan(&exists)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrNoRecord
+		}
+		return err
+	}
+
+	// The row may be left as it was, which MySQL reports as no rows
+	// affected, hence the SELECT above rather than expectAffected.
+	if pinned {
+		_, err = tx.Exec(m.Dialect.rebind(`UPDATE notes SET pinned_at = COALESCE(pinned_at, ?) WHERE id = ?`), now(), id)
+	} else {
+		_, err = tx.Exec(m.Dialect.rebind(`UPDATE notes SET pinned_at = NULL WHERE id = ?`), id)
+	}
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
 }
 
 // This will return a specific note based on its id.
 func (m *NoteModel) Get(id string, createdBy *int) (NoteWithUsername, error) {
-	stmt := `SELECT notes.id, notes.title, notes.content, notes.created, notes.expires, notes.public, notes.created_by, users.name as username 
+	return m.get(id, createdBy, false)
+}
+
+// GetForUnlock is like Get, but also returns password-protected notes that
+// createdBy can't otherwise see, so that their password can be asked for.
+// Only the pages asking for the password may use it, and they must not show
+// the note before the right password has been entered.
+func (m *NoteModel) GetForUnlock(id string, createdBy *int) (NoteWithUsername, error) {
+	return m.get(id, createdBy, true)
+}
+
+func (m *NoteModel) get(id string, createdBy *int, protected bool) (NoteWithUsername, error) {
+	stmt := `SELECT ` + noteColumns + `
 	FROM notes 
 	JOIN users ON notes.created_by = users.id 
-	WHERE notes.expires > UTC_TIMESTAMP() AND notes.id = ?`
+	WHERE ` + notExpired + ` AND notes.deleted_at IS NULL AND notes.id = ?`
 
 	var args []interface{}
-	args = append(args, id)
+	args = append(args, now(), id)
 
 	// Access control: if no user ID provided, only show public notes
-	// if user ID provided, show public notes OR private notes created by that user
+	// if user ID provided, show public notes OR private notes created by or
+	// shared with that user.
+	visible := `notes.public = TRUE`
+	if protected {
+		visible += ` OR notes.hashed_password IS NOT NULL`
+	}
 	if createdBy != nil {
-		stmt += ` AND (notes.public = TRUE OR notes.created_by = ?)`
-		args = append(args, *createdBy)
+		stmt += ` AND (` + visible + ` OR notes.created_by = ? OR ` + sharedWith + `)`
+		args = append(args, *createdBy, *createdBy)
 	} else {
-		stmt += ` AND notes.public = TRUE`
+		stmt += ` AND (` + visible + `)`
 	}
 
-	var s NoteWithUsername
-
-	err := m.DB.QueryRow(stmt, args...).Scan(&s.ID, &s.Title, &s.Content, &s.Created, &s.Expires, &s.Public, &s.CreatedBy, &s.Username)
+	s, err := scanNote(m.DB.QueryRow(m.Dialect.rebind(stmt), args...))
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return NoteWithUsername{}, ErrNoRecord
@@ -105,22 +341,137 @@ func (m *NoteModel) Get(id string, createdBy *int) (NoteWithUsername, error) {
 	return s, nil
 }
 
-// This will return the 10 most recently created public notes.
-func (m *NoteModel) Latest() ([]NoteWithUsername, error) {
-	stmt := `SELECT notes.id, notes.title, notes.content, notes.created, notes.expires, notes.public, notes.created_by, users.name as username 
+// Burn returns a burn-after-reading note to a user other than its owner and
+// deletes it in the same transaction, with the same access rules as Get.
+// Password-protected notes the user can't otherwise see are only burnt when
+// unlocked says the caller has checked the password. The row is locked while
+// it is read, and only the viewer whose DELETE removes it gets the note back:
+// anyone reading it concurrently gets ErrNoRecord.
+func (m *NoteModel) Burn(id string, userID *int, unlocked bool) (NoteWithUsername, error) {
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return NoteWithUsername{}, err
+	}
+	defer tx.Rollback()
+
+	stmt := `SELECT ` + noteColumns + `
+	FROM notes
+	JOIN users ON notes.created_by = users.id
+	WHERE ` + notExpired + ` AND notes.deleted_at IS NULL AND notes.id = ? AND notes.burn_after_reading = TRUE`
+	args := []any{now(), id}
+
+	visible := `notes.public = TRUE`
+	if unlocked {
+		visible += ` OR notes.hashed_password IS NOT NULL`
+	}
+	if userID != nil {
+		stmt += ` AND notes.created_by <> ? AND (` + visible + ` OR ` + sharedWith + `)`
+		args = append(args, *userID, *userID)
+	} else {
+		stmt += ` AND (` + visible + `)`
+	}
+
+	s, err := scanNote(tx.QueryRow(m.Dialect.rebind(stmt+m.Dialect.forUpdate()), args...))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return NoteWithUsername{}, ErrNoRecord
+		}
+		return NoteWithUsername{}, err
+	}
+
+	// Tags, revisions and shares go with the note through ON DELETE CASCADE.
+	stmt = `DELETE FROM notes WHERE id = ? AND burn_after_reading = TRUE`
+	result, err := tx.Exec(m.Dialect.rebind(stmt), id)
+	if err != nil {
+		return NoteWithUsername{}, err
+	}
+	err = expectAffected(result)
+	if err != nil {
+		return NoteWithUsername{}, err
+	}
+	return s, tx.Commit()
+}
+
+// SetExpiry changes when one of createdBy's notes expires, without touching
+// its content or recording a revision. A zero expires never expires.
+func (m *NoteModel) SetExpiry(id string, expires time.Time, createdBy int) error {
+	stmt := `UPDATE notes SET expires = ? WHERE id = ? AND created_by = ? AND deleted_at IS NULL AND ` + notExpired
+	result, err := m.DB.Exec(m.Dialect.rebind(stmt), nullTime(expires), id, createdBy, now())
+	if err != nil {
+		return err
+	}
+	return expectAffected(result)
+}
+
+// SetPassword protects one of createdBy's notes with password, replacing any
+// previous password, or removes the protection when password is empty.
+func (m *NoteModel) SetPassword(id string, password string, createdBy int) error {
+	hashedPassword, err := hashNotePassword(password)
+	if err != nil {
+		return err
+	}
+
+	stmt := `UPDATE notes SET hashed_password = ? WHERE id = ? AND created_by = ? AND deleted_at IS NULL`
+	result, err := m.DB.Exec(m.Dialect.rebind(stmt), hashedPassword, id, createdBy)
+	if err != nil {
+		return err
+	}
+	return expectAffected(result)
+}
+
+// CheckPassword returns ErrInvalidCredentials unless password is the access
+// password of the note, and ErrNoRecord when the note isn't protected.
+func (m *NoteModel) CheckPassword(id string, password string) error {
+	var hashedPassword []byte
+
+	stmt := `SELECT hashed_password FROM notes WHERE id = ? AND deleted_at IS NULL AND hashed_password IS NOT NULL`
+	err := m.DB.QueryRow(m.Dialect.rebind(stmt), id).Scan(&hashedPassword)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrNoRecord
+		}
+		return err
+	}
+
+	err = bcrypt.CompareHashAndPassword(hashedPassword, []byte(password))
+	if err != nil {
+		if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+			return ErrInvalidCredentials
+		}
+		return err
+	}
+	return nil
+}
+
+// hashNotePassword hashes a note's access password the same way UserModel
+// hashes account passwords. An empty password hashes to NULL.
+func hashNotePassword(password string) (sql.NullString, error) {
+	if password == "" {
+		return sql.NullString{}, nil
+	}
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), 12)
+	if err != nil {
+		return sql.NullString{}, err
+	}
+	return sql.NullString{String: string(hashedPassword), Valid: true}, nil
+}
+
+// This will return the first 10 public notes in the given sort order, the
+// most recently created ones by default.
+func (m *NoteModel) Latest(sort string) ([]NoteWithUsername, error) {
+	stmt := `SELECT ` + noteColumns + `
 	FROM notes
 	JOIN users ON notes.created_by = users.id
-	WHERE notes.expires > UTC_TIMESTAMP() AND notes.public = TRUE ORDER BY notes.id DESC LIMIT 10`
+	WHERE ` + notExpired + ` AND notes.deleted_at IS NULL AND notes.public = TRUE AND ` + unrestricted + ` ORDER BY ` + orderBy(sort) + ` LIMIT 10`
 
-	rows, err := m.DB.Query(stmt)
+	rows, err := m.DB.Query(m.Dialect.rebind(stmt), now())
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 	var notes []NoteWithUsername
 	for rows.Next() {
-		var s NoteWithUsername
-		err := rows.Scan(&s.ID, &s.Title, &s.Content, &s.Created, &s.Expires, &s.Public, &s.CreatedBy, &s.Username)
+		s, err := scanNote(rows)
 		if err != nil {
 			return nil, err
 		}
@@ -133,11 +484,26 @@ func (m *NoteModel) Latest() ([]NoteWithUsername, error) {
 	return notes, nil
 }
 
-func (m *NoteModel) GetTotalPages(public *bool, createdBy *int) (int, error) {
-	stmt := `SELECT COUNT(*) FROM notes WHERE expires > UTC_TIMESTAMP()`
+func (m *NoteModel) GetTotalPages(createdBy *int, filters NotesFilters) (int, error) {
+	stmt := `SELECT COUNT(*) FROM notes WHERE ` + notExpired + ` AND notes.deleted_at IS NULL`
 
-	// Build dynamic query parameters
-	var args []interface{}
+	where, args := filtersClause(createdBy, filters)
+	stmt += where
+	args = append([]any{now()}, args...)
+
+	var total int
+	err := m.DB.QueryRow(m.Dialect.rebind(stmt), args...).Scan(&total)
+	if err != nil {
+		return 0, err
+	}
+	return total, nil
+}
+
+// filtersClause builds the " AND ..." conditions and their arguments shared by
+// the paginated note queries.
+func filtersClause(createdBy *int, filters NotesFilters) (string, []any) {
+	var stmt string
+	var args []any
 
 	// Filter by created_by if specified (shows only notes by that user)
 	if createdBy != nil {
@@ -146,59 +512,77 @@ func (m *NoteModel) GetTotalPages(public *bool, createdBy *int) (int, error) {
 	}
 
 	// Filter by public/private if specified
-	if public != nil {
+	if filters.ShowPublic != nil {
 		stmt += ` AND notes.public = ?`
-		args = append(args, *public)
+		args = append(args, *filters.ShowPublic)
 	}
 
-	var total int
-	err := m.DB.QueryRow(stmt, args...).Scan(&total)
-	if err != nil {
-		return 0, err
+	// Filter by the user notes are shared with if specified
+	if filters.SharedWith != 0 {
+		stmt += ` AND ` + sharedWith
+		args = append(args, filters.SharedWith)
 	}
-	return total, nil
+
+	// Filter by notebook if specified
+	if filters.NotebookID != 0 {
+		stmt += ` AND notes.notebook_id = ?`
+		args = append(args, filters.NotebookID)
+	}
+
+	// Filter by the user who starred the notes if specified. Stars outlive
+	// access, so this also applies Get's visibility rules, and keeps other
+	// users' restricted notes out like HideRestricted would.
+	if filters.FavoritedBy != 0 {
+		stmt += ` AND EXISTS (SELECT 1 FROM favorites WHERE favorites.note_id = notes.id AND favorites.user_id = ?)
+		AND (notes.created_by = ? OR ((notes.public = TRUE OR ` + sharedWith + `) AND ` + unrestricted + `))`
+		args = append(args, filters.FavoritedBy, filters.FavoritedBy, filters.FavoritedBy)
+	}
+
+	if filters.HideRestricted {
+		stmt += ` AND ` + unrestricted
+	}
+
+	// Filter by tag if specified
+	if filters.Tag != "" {
+		stmt += ` AND EXISTS (SELECT 1 FROM note_tags JOIN tags ON note_tags.tag_id = tags.id WHERE note_tags.note_id = notes.id AND tags.name = ?)`
+		args = append(args, filters.Tag)
+	}
+
+	return stmt, args
 }
 
-func (m *NoteModel) GetByPage(page int, limit int, public *bool, createdBy *int) ([]NoteWithUsername, PaginationMetaData, error) {
+func (m *NoteModel) GetByPage(page int, limit int, createdBy *int, filters NotesFilters) ([]NoteWithUsername, PaginationMetaData, error) {
 	originalLimit := limit
 	limit = limit + 1 // to check if there is a next page
 	offset := (page - 1) * originalLimit
-	stmt := `SELECT notes.id, notes.title, notes.content, notes.created, notes.expires, notes.public, notes.created_by, users.name as username 
+	stmt := `SELECT ` + noteColumns + `
 	FROM notes
 	JOIN users ON notes.created_by = users.id
-	WHERE notes.expires > UTC_TIMESTAMP()`
-
-	// Build dynamic query parameters
-	var args []interface{}
+	WHERE ` + notExpired + ` AND notes.deleted_at IS NULL`
 
-	// Filter by created_by if specified (shows only notes by that user)
-	if createdBy != nil {
-		stmt += ` AND notes.created_by = ?`
-		args = append(args, *createdBy)
-	}
+	where, args := filtersClause(createdBy, filters)
+	stmt += where
+	args = append([]any{now()}, args...)
 
-	// Filter by public/private if specified
-	if public != nil {
-		stmt += ` AND notes.public = ?`
-		args = append(args, *public)
+	stmt += ` ORDER BY `
+	if filters.PinnedFirst {
+		stmt += `notes.pinned_at IS NULL, notes.pinned_at DESC, `
 	}
-
-	stmt += ` ORDER BY notes.id DESC LIMIT ? OFFSET ?`
+	stmt += orderBy(filters.Sort) + ` LIMIT ? OFFSET ?`
 	args = append(args, limit, offset)
 
 	meta := PaginationMetaData{
 		HasNext: false,
 	}
 
-	rows, err := m.DB.Query(stmt, args...)
+	rows, err := m.DB.Query(m.Dialect.rebind(stmt), args...)
 	if err != nil {
 		return nil, meta, err
 	}
 	defer rows.Close()
 	var notes []NoteWithUsername
 	for rows.Next() {
-		var s NoteWithUsername
-		err := rows.Scan(&s.ID, &s.Title, &s.Content, &s.Created, &s.Expires, &s.Public, &s.CreatedBy, &s.Username)
+		s, err := scanNote(rows)
 		if err != nil {
 			return nil, meta, err
 		}
@@ -213,14 +597,170 @@ func (m *NoteModel) GetByPage(page int, limit int, public *bool, createdBy *int)
 	return notes, meta, nil
 }
 
+// Delete moves a note to its owner's trash. Trashed notes are hidden from
+// every other query until they are restored or purged.
 func (m *NoteModel) Delete(id string, createdBy *int) error {
-	stmt := `DELETE FROM notes WHERE id = ? AND created_by = ?`
-	_, err := m.DB.Exec(stmt, id, *createdBy)
+	stmt := `UPDATE notes SET deleted_at = ? WHERE id = ? AND created_by = ? AND deleted_at IS NULL`
+	result, err := m.DB.Exec(m.Dialect.rebind(stmt), now(), id, *createdBy)
 	if err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			return ErrNoRecord
+		return err
+	}
+	return expectAffected(result)
+}
+
+// GetTrash returns a page of the notes in the user's trash, most recently
+// deleted first.
+func (m *NoteModel) GetTrash(page int, limit int, createdBy int) ([]NoteWithUsername, PaginationMetaData, error) {
+	originalLimit := limit
+	limit = limit + 1 // to check if there is a next page
+	offset := (page - 1) * originalLimit
+	stmt := `SELECT ` + noteColumns + `
+	FROM notes
+	JOIN users ON notes.created_by = users.id
+	WHERE notes.deleted_at IS NOT NULL AND notes.created_by = ?
+	ORDER BY notes.deleted_at DESC, notes.id DESC LIMIT ? OFFSET ?`
+
+	meta := PaginationMetaData{
+		HasNext: false,
+	}
+
+	rows, err := m.DB.Query(m.Dialect.rebind(stmt), createdBy, limit, offset)
+	if err != nil {
+		return nil, meta, err
+	}
+	defer rows.Close()
+	var notes []NoteWithUsername
+	for rows.Next() {
+		s, err := scanNote(rows)
+		if err != nil {
+			return nil, meta, err
 		}
+		notes = append(notes, s)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, meta, err
+	}
+
+	if len(notes) > originalLimit {
+		meta.HasNext = true
+		notes = notes[:originalLimit]
+	}
+
+	return notes, meta, nil
+}
+
+// Restore takes a note back out of its owner's trash.
+func (m *NoteModel) Restore(id string, createdBy int) error {
+	stmt := `UPDATE notes SET deleted_at = NULL WHERE id = ? AND created_by = ? AND deleted_at IS NOT NULL`
+	result, err := m.DB.Exec(m.Dialect.rebind(stmt), id, createdBy)
+	if err != nil {
 		return err
 	}
+	return expectAffected(result)
+}
+
+// DeletePermanently removes a trashed note for good. Notes have to be in the
+// trash before they can be permanently deleted.
+func (m *NoteModel) DeletePermanently(id string, createdBy int) error {
+	stmt := `DELETE FROM notes WHERE id = ? AND created_by = ? AND deleted_at IS NOT NULL`
+	result, err := m.DB.Exec(m.Dialect.rebind(stmt), id, createdBy)
+	if err != nil {
+		return err
+	}
+	return expectAffected(result)
+}
+
+// PurgeTrash permanently deletes up to limit notes that have been in the
+// trash for longer than retention, and returns how many were removed.
+func (m *NoteModel) PurgeTrash(retention time.Duration, limit int) (int64, error) {
+	stmt := `DELETE FROM notes WHERE id IN (
+		SELECT id FROM (SELECT id FROM notes WHERE deleted_at IS NOT NULL AND deleted_at < ? LIMIT ?) AS batch
+	)`
+	result, err := m.DB.Exec(m.Dialect.rebind(stmt), now().Add(-retention), limit)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// DeleteExpired permanently deletes up to limit notes whose expiry date has
+// passed, and returns how many were removed. Their tags and revisions go with
+// them through the ON DELETE CASCADE foreign keys.
+func (m *NoteModel) DeleteExpired(limit int) (int64, error) {
+	stmt := `DELETE FROM notes WHERE id IN (
+		SELECT id FROM (SELECT id FROM notes WHERE expires <= ? LIMIT ?) AS batch
+	)`
+	result, err := m.DB.Exec(m.Dialect.rebind(stmt), now(), limit)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// expectAffected returns ErrNoRecord when a statement didn't touch any row.
+func expectAffected(result sql.Result) error {
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrNoRecord
+	}
 	return nil
 }
+
+// Search returns the notes matching query in their title or content, most
+// relevant first. It applies the same visibility rules as Get: public notes,
+// plus the private notes of, or shared with, userID when it is not nil.
+func (m *NoteModel) Search(query string, page int, limit int, userID *int) ([]NoteWithUsername, PaginationMetaData, error) {
+	originalLimit := limit
+	limit = limit + 1 // to check if there is a next page
+	offset := (page - 1) * originalLimit
+	stmt := `SELECT ` + noteColumns + `
+	FROM notes
+	JOIN users ON notes.created_by = users.id
+	WHERE ` + notExpired + ` AND notes.deleted_at IS NULL AND ` + m.Dialect.searchMatch()
+
+	args := []any{now(), query}
+
+	// Burn-after-reading and password-protected notes only turn up in their
+	// owner's results, as the result previews would give their content away.
+	if userID != nil {
+		stmt += ` AND (notes.public = TRUE OR notes.created_by = ? OR ` + sharedWith + `)`
+		stmt += ` AND (` + unrestricted + ` OR notes.created_by = ?)`
+		args = append(args, *userID, *userID, *userID)
+	} else {
+		stmt += ` AND notes.public = TRUE AND ` + unrestricted
+	}
+
+	stmt += ` ORDER BY ` + m.Dialect.searchRank() + ` DESC, notes.created DESC LIMIT ? OFFSET ?`
+	args = append(args, query, limit, offset)
+
+	meta := PaginationMetaData{
+		HasNext: false,
+	}
+
+	rows, err := m.DB.Query(m.Dialect.rebind(stmt), args...)
+	if err != nil {
+		return nil, meta, err
+	}
+	defer rows.Close()
+	var notes []NoteWithUsername
+	for rows.Next() {
+		s, err := scanNote(rows)
+		if err != nil {
+			return nil, meta, err
+		}
+		notes = append(notes, s)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, meta, err
+	}
+
+	if len(notes) > originalLimit {
+		meta.HasNext = true
+		notes = notes[:originalLimit]
+	}
+
+	return notes, meta, nil
+}
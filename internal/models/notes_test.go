@@ -0,0 +1,433 @@
+package models
+
+import (
+	"errors"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Abdelrahman-habib/noter/internal/assert"
+)
+
+func TestNoteModelBurn(t *testing.T) {
+	if testing.Short() {
+		t.Skip("models: skipping integration test")
+	}
+
+	db := newTestDB(t)
+	m := NoteModel{DB: db, Dialect: testDialect(t)}
+	owner, stranger := 1, 2
+
+	id, err := m.Insert("Secret", "Burn me", FormatPlain, "", time.Now().Add(time.Hour), true, true, "", owner)
+	assert.NilError(t, err)
+
+	// Owners can read their burn-after-reading notes as often as they like.
+	_, err = m.Burn(id, &owner, false)
+	assert.Equal(t, errors.Is(err, ErrNoRecord), true)
+	_, err = m.Get(id, &owner)
+	assert.NilError(t, err)
+
+	// Ordinary notes can't be burnt.
+	_, err = m.Burn("550e8400-e29b-41d4-a716-446655440000", &stranger, false)
+	assert.Equal(t, errors.Is(err, ErrNoRecord), true)
+
+	// Of several concurrent readers exactly one gets the note.
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	reads := 0
+	for range 5 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			note, err := m.Burn(id, &stranger, false)
+			if err == nil {
+				mu.Lock()
+				reads++
+				mu.Unlock()
+				assert.Equal(t, note.Content, "Burn me")
+			}
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, reads, 1)
+
+	_, err = m.Get(id, &owner)
+	assert.Equal(t, errors.Is(err, ErrNoRecord), true)
+}
+
+func TestNoteModelPassword(t *testing.T) {
+	if testing.Short() {
+		t.Skip("models: skipping integration test")
+	}
+
+	db := newTestDB(t)
+	m := NoteModel{DB: db, Dialect: testDialect(t)}
+	owner := 1
+
+	id, err := m.Insert("Locked", "Behind a password", FormatPlain, "", time.Now().Add(time.Hour), false, false, "open sesame", owner)
+	assert.NilError(t, err)
+
+	// Get keeps private protected notes to their owner; only GetForUnlock
+	// hands them out, for the password to be asked for.
+	stranger := 2
+	_, err = m.Get(id, nil)
+	assert.Equal(t, errors.Is(err, ErrNoRecord), true)
+	_, err = m.Get(id, &stranger)
+	assert.Equal(t, errors.Is(err, ErrNoRecord), true)
+	note, err := m.GetForUnlock(id, nil)
+	assert.NilError(t, err)
+	assert.Equal(t, note.Protected, true)
+
+	assert.NilError(t, m.CheckPassword(id, "open sesame"))
+	err = m.CheckPassword(id, "wrong")
+	assert.Equal(t, errors.Is(err, ErrInvalidCredentials), true)
+
+	err = m.SetPassword(id, "", 2)
+	assert.Equal(t, errors.Is(err, ErrNoRecord), true)
+	assert.NilError(t, m.SetPassword(id, "", owner))
+
+	err = m.CheckPassword(id, "open sesame")
+	assert.Equal(t, errors.Is(err, ErrNoRecord), true)
+	_, err = m.GetForUnlock(id, nil)
+	assert.Equal(t, errors.Is(err, ErrNoRecord), true)
+
+	// A protected burn note is only burnt once the caller has checked the
+	// password.
+	id, err = m.Insert("Locked fuse", "Burn me", FormatPlain, "", time.Now().Add(time.Hour), false, true, "open sesame", owner)
+	assert.NilError(t, err)
+	_, err = m.Burn(id, &stranger, false)
+	assert.Equal(t, errors.Is(err, ErrNoRecord), true)
+	note, err = m.Burn(id, &stranger, true)
+	assert.NilError(t, err)
+	assert.Equal(t, note.Content, "Burn me")
+}
+
+func TestNoteModelExpiry(t *testing.T) {
+	if testing.Short() {
+		t.Skip("models: skipping integration test")
+	}
+
+	db := newTestDB(t)
+	m := NoteModel{DB: db, Dialect: testDialect(t)}
+	owner := 1
+
+	// The seeded notes keep their expiry through the migration making it
+	// nullable.
+	seeded, err := m.Get("550e8400-e29b-41d4-a716-446655440000", nil)
+	assert.NilError(t, err)
+	assert.Equal(t, seeded.Expires.IsZero(), false)
+
+	id, err := m.Insert("Forever", "Never expires", FormatPlain, "", time.Time{}, true, false, "", owner)
+	assert.NilError(t, err)
+	note, err := m.Get(id, nil)
+	assert.NilError(t, err)
+	assert.Equal(t, note.Expires.IsZero(), true)
+
+	expires := time.Now().Add(90 * time.Minute).UTC().Truncate(time.Second)
+	err = m.SetExpiry(id, expires, 2)
+	assert.Equal(t, errors.Is(err, ErrNoRecord), true)
+	assert.NilError(t, m.SetExpiry(id, expires, owner))
+	note, err = m.Get(id, nil)
+	assert.NilError(t, err)
+	assert.Equal(t, note.Expires.Equal(expires), true)
+
+	assert.NilError(t, m.SetExpiry(id, time.Now().Add(-time.Minute), owner))
+	_, err = m.Get(id, nil)
+	assert.Equal(t, errors.Is(err, ErrNoRecord), true)
+
+	// Expired notes can't be brought back.
+	err = m.SetExpiry(id, time.Time{}, owner)
+	assert.Equal(t, errors.Is(err, ErrNoRecord), true)
+}
+
+func TestNoteModelUpdateConflict(t *testing.T) {
+	if testing.Short() {
+		t.Skip("models: skipping integration test")
+	}
+
+	db := newTestDB(t)
+	m := NoteModel{DB: db, Dialect: testDialect(t)}
+	owner := 1
+	expires := time.Now().Add(time.Hour)
+
+	id, err := m.Insert("Draft", "First", FormatPlain, "", expires, true, false, "", owner)
+	assert.NilError(t, err)
+	note, err := m.Get(id, nil)
+	assert.NilError(t, err)
+	assert.Equal(t, note.Version, 1)
+
+	_, err = m.Update(id, 1, "Draft", "Second", FormatPlain, "", expires, true, owner)
+	assert.NilError(t, err)
+
+	// A second edit of version 1 would overwrite the first one.
+	_, err = m.Update(id, 1, "Draft", "Third", FormatPlain, "", expires, true, owner)
+	assert.Equal(t, errors.Is(err, ErrEditConflict), true)
+
+	note, err = m.Get(id, nil)
+	assert.NilError(t, err)
+	assert.Equal(t, note.Content, "Second")
+	assert.Equal(t, note.Version, 2)
+
+	_, err = m.Update(id, 2, "Draft", "Third", FormatPlain, "", expires, true, owner)
+	assert.NilError(t, err)
+}
+
+func TestNoteModelSort(t *testing.T) {
+	if testing.Short() {
+		t.Skip("models: skipping integration test")
+	}
+
+	db := newTestDB(t)
+	dialect := testDialect(t)
+	m := NoteModel{DB: db, Dialect: dialect}
+	users := UserModel{DB: db, Dialect: dialect}
+	owner, err := users.Insert("Sorter", "sorter@example.com", "pa$$word")
+	assert.NilError(t, err)
+
+	// Timestamps only have a precision of one second, so the notes are
+	// backdated to tell them apart.
+	inserts := []struct {
+		title   string
+		expires time.Time
+		age     time.Duration
+	}{
+		{"banana", time.Now().Add(2 * time.Hour), 2 * time.Hour},
+		{"Apple", time.Time{}, 3 * time.Hour},
+		{"cherry", time.Now().Add(time.Hour), time.Hour},
+	}
+	ids := make(map[string]string)
+	for _, n := range inserts {
+		id, err := m.Insert(n.title, "Fruit", FormatPlain, "", n.expires, false, false, "", owner)
+		assert.NilError(t, err)
+		created := now().Add(-n.age)
+		_, err = db.Exec(dialect.rebind(`UPDATE notes SET created = ?, updated = ? WHERE id = ?`), created, created, id)
+		assert.NilError(t, err)
+		ids[n.title] = id
+	}
+	_, err = m.Update(ids["banana"], 1, "banana", "Ripe", FormatPlain, "", inserts[0].expires, false, owner)
+	assert.NilError(t, err)
+
+	tests := []struct {
+		sort string
+		want []string
+	}{
+		{"", []string{"cherry", "banana", "Apple"}},
+		{SortCreated, []string{"cherry", "banana", "Apple"}},
+		{SortUpdated, []string{"banana", "cherry", "Apple"}},
+		{SortExpires, []string{"cherry", "banana", "Apple"}},
+		{SortTitle, []string{"Apple", "banana", "cherry"}},
+	}
+	for _, tt := range tests {
+		t.Run("Sort "+tt.sort, func(t *testing.T) {
+			notes, _, err := m.GetByPage(1, 10, &owner, NotesFilters{Sort: tt.sort})
+			assert.NilError(t, err)
+			assert.Equal(t, len(notes), len(tt.want))
+			for i, title := range tt.want {
+				assert.Equal(t, notes[i].Title, title)
+			}
+		})
+	}
+
+	note, err := m.Get(ids["banana"], &owner)
+	assert.NilError(t, err)
+	assert.Equal(t, note.Updated.After(note.Created), true)
+}
+
+func TestNoteModelTrash(t *testing.T) {
+	if testing.Short() {
+		t.Skip("models: skipping integration test")
+	}
+
+	db := newTestDB(t)
+	dialect := testDialect(t)
+	m := NoteModel{DB: db, Dialect: dialect}
+	users := UserModel{DB: db, Dialect: dialect}
+	owner := 1
+	bob, err := users.Insert("Bob", "bob@example.com", "pa$$word")
+	assert.NilError(t, err)
+
+	ids := make(map[string]string)
+	for _, title := range []string{"Old", "Recent", "Kept"} {
+		id, err := m.Insert(title, "Rubbish", FormatPlain, "", time.Now().Add(time.Hour), true, false, "", owner)
+		assert.NilError(t, err)
+		ids[title] = id
+	}
+	// trash deletes a note and backdates its deletion.
+	trash := func(title string, age time.Duration) {
+		t.Helper()
+		assert.NilError(t, m.Delete(ids[title], &owner))
+		_, err := db.Exec(dialect.rebind(`UPDATE notes SET deleted_at = ? WHERE id = ?`), now().Add(-age), ids[title])
+		assert.NilError(t, err)
+	}
+
+	// Only the owner can delete a note, and only once.
+	err = m.Delete(ids["Old"], &bob)
+	assert.Equal(t, errors.Is(err, ErrNoRecord), true)
+	trash("Old", 10*24*time.Hour)
+	trash("Recent", time.Hour)
+	err = m.Delete(ids["Old"], &owner)
+	assert.Equal(t, errors.Is(err, ErrNoRecord), true)
+	_, err = m.Get(ids["Old"], &owner)
+	assert.Equal(t, errors.Is(err, ErrNoRecord), true)
+
+	// The trash lists the most recently deleted notes first, a page at a
+	// time, and only to their owner.
+	notes, meta, err := m.GetTrash(1, 1, owner)
+	assert.NilError(t, err)
+	assert.Equal(t, len(notes), 1)
+	assert.Equal(t, notes[0].ID, ids["Recent"])
+	assert.Equal(t, meta.HasNext, true)
+	notes, meta, err = m.GetTrash(2, 1, owner)
+	assert.NilError(t, err)
+	assert.Equal(t, len(notes), 1)
+	assert.Equal(t, notes[0].ID, ids["Old"])
+	assert.Equal(t, meta.HasNext, false)
+	notes, _, err = m.GetTrash(1, 10, bob)
+	assert.NilError(t, err)
+	assert.Equal(t, len(notes), 0)
+
+	// Only trashed notes can be restored, by their owner.
+	err = m.Restore(ids["Recent"], bob)
+	assert.Equal(t, errors.Is(err, ErrNoRecord), true)
+	err = m.Restore(ids["Kept"], owner)
+	assert.Equal(t, errors.Is(err, ErrNoRecord), true)
+	assert.NilError(t, m.Restore(ids["Recent"], owner))
+	_, err = m.Get(ids["Recent"], &owner)
+	assert.NilError(t, err)
+
+	// Notes are purged once they have been in the trash for longer than the
+	// retention, a batch at a time.
+	trash("Recent", time.Hour)
+	trash("Kept", 8*24*time.Hour)
+	purged, err := m.PurgeTrash(7*24*time.Hour, 1)
+	assert.NilError(t, err)
+	assert.Equal(t, purged, int64(1))
+	purged, err = m.PurgeTrash(7*24*time.Hour, 10)
+	assert.NilError(t, err)
+	assert.Equal(t, purged, int64(1))
+	purged, err = m.PurgeTrash(7*24*time.Hour, 10)
+	assert.NilError(t, err)
+	assert.Equal(t, purged, int64(0))
+
+	notes, _, err = m.GetTrash(1, 10, owner)
+	assert.NilError(t, err)
+	assert.Equal(t, len(notes), 1)
+	assert.Equal(t, notes[0].ID, ids["Recent"])
+	err = m.Restore(ids["Old"], owner)
+	assert.Equal(t, errors.Is(err, ErrNoRecord), true)
+}
+
+func TestNoteModelDeleteExpired(t *testing.T) {
+	if testing.Short() {
+		t.Skip("models: skipping integration test")
+	}
+
+	db := newTestDB(t)
+	m := NoteModel{DB: db, Dialect: testDialect(t)}
+	revisions := RevisionModel{DB: db, Dialect: testDialect(t)}
+	owner := 1
+
+	forever, err := m.Insert("Forever", "Never expires", FormatPlain, "", time.Time{}, true, false, "", owner)
+	assert.NilError(t, err)
+	later, err := m.Insert("Later", "Expires later", FormatPlain, "", time.Now().Add(time.Hour), true, false, "", owner)
+	assert.NilError(t, err)
+	var expired []string
+	for range 3 {
+		id, err := m.Insert("Expired", "Gone", FormatPlain, "", time.Now().Add(-time.Minute), true, false, "", owner)
+		assert.NilError(t, err)
+		expired = append(expired, id)
+	}
+
+	// Expired notes are deleted a batch at a time.
+	deleted, err := m.DeleteExpired(2)
+	assert.NilError(t, err)
+	assert.Equal(t, deleted, int64(2))
+	deleted, err = m.DeleteExpired(10)
+	assert.NilError(t, err)
+	assert.Equal(t, deleted, int64(1))
+	deleted, err = m.DeleteExpired(10)
+	assert.NilError(t, err)
+	assert.Equal(t, deleted, int64(0))
+
+	// Their revisions go with them.
+	for _, id := range expired {
+		history, err := revisions.GetAllForNote(id)
+		assert.NilError(t, err)
+		assert.Equal(t, len(history), 0)
+	}
+
+	// Notes that never expire, or have yet to, are kept.
+	for _, id := range []string{forever, later, "550e8400-e29b-41d4-a716-446655440000"} {
+		_, err = m.Get(id, &owner)
+		assert.NilError(t, err)
+	}
+}
+
+func TestNoteModelSearch(t *testing.T) {
+	if testing.Short() {
+		t.Skip("models: skipping integration test")
+	}
+
+	db := newTestDB(t)
+	dialect := testDialect(t)
+	m := NoteModel{DB: db, Dialect: dialect}
+	users := UserModel{DB: db, Dialect: dialect}
+	shares := NoteShareModel{DB: db, Dialect: dialect}
+	owner := 1
+	bob, err := users.Insert("Bob", "bob@example.com", "pa$$word")
+	assert.NilError(t, err)
+	expires := time.Now().Add(time.Hour)
+
+	inserts := []struct {
+		title            string
+		content          string
+		public           bool
+		burnAfterReading bool
+		password         string
+	}{
+		{"Public", "Roast the aubergine whole", true, false, ""},
+		{"Private", "An aubergine for dinner", false, false, ""},
+		{"Shared", "Aubergine and lentils", false, false, ""},
+		{"Burn", "The aubergine is a lie", true, true, ""},
+		{"Protected", "Aubergine secrets", true, false, "open sesame"},
+		{"Trashed", "Rotten aubergine", true, false, ""},
+		{"Other", "Courgette fritters", true, false, ""},
+	}
+	ids := make(map[string]string)
+	for _, n := range inserts {
+		id, err := m.Insert(n.title, n.content, FormatPlain, "", expires, n.public, n.burnAfterReading, n.password, owner)
+		assert.NilError(t, err)
+		ids[n.title] = id
+	}
+	assert.NilError(t, shares.Grant(ids["Shared"], bob, PermissionView))
+	assert.NilError(t, m.Delete(ids["Trashed"], &owner))
+
+	// search returns the titles of the notes userID finds, in no particular
+	// order.
+	search := func(query string, userID *int) string {
+		t.Helper()
+		notes, _, err := m.Search(query, 1, 10, userID)
+		assert.NilError(t, err)
+		var titles []string
+		for _, note := range notes {
+			titles = append(titles, note.Title)
+		}
+		slices.Sort(titles)
+		return strings.Join(titles, ",")
+	}
+
+	// Burn-after-reading and protected notes only turn up for their owner,
+	// private ones for whoever they are shared with.
+	assert.Equal(t, search("aubergine", nil), "Public")
+	assert.Equal(t, search("aubergine", &bob), "Public,Shared")
+	assert.Equal(t, search("aubergine", &owner), "Burn,Private,Protected,Public,Shared")
+	assert.Equal(t, search("courgette", &owner), "Other")
+	assert.Equal(t, search("parsnip", &owner), "")
+
+	notes, meta, err := m.Search("aubergine", 1, 2, &owner)
+	assert.NilError(t, err)
+	assert.Equal(t, len(notes), 2)
+	assert.Equal(t, meta.HasNext, true)
+}
@@ -0,0 +1,106 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// PasswordResetModel manages the single-use tokens emailed to users who have
+// forgotten their password. As with access tokens, only the SHA-256 hash of a
+// token is stored.
+type PasswordResetModel struct {
+	DB      *sql.DB
+	Dialect Dialect
+}
+
+type PasswordResetModelInterface interface {
+	Insert(userID int, ttl time.Duration) (string, error)
+	Exists(plaintext string) (bool, error)
+	Reset(plaintext, password string) (int, error)
+	DeleteExpired(limit int) (int64, error)
+}
+
+// Insert creates a reset token for the user, valid for ttl, and returns its
+// plaintext.
+func (m *PasswordResetModel) Insert(userID int, ttl time.Duration) (string, error) {
+	plaintext, err := randomToken()
+	if err != nil {
+		return "", err
+	}
+
+	current := now()
+	stmt := `INSERT INTO password_resets (user_id, hash, created, expires) VALUES (?, ?, ?, ?)`
+	_, err = m.DB.Exec(m.Dialect.rebind(stmt), userID, hashToken(plaintext), current, current.Add(ttl))
+	if err != nil {
+		return "", err
+	}
+	return plaintext, nil
+}
+
+// Exists reports whether a token can still be used to reset a password.
+func (m *PasswordResetModel) Exists(plaintext string) (bool, error) {
+	var exists bool
+
+	stmt := `SELECT EXISTS(SELECT true FROM password_resets WHERE hash = ? AND expires > ?)`
+	err := m.DB.QueryRow(m.Dialect.rebind(stmt), hashToken(plaintext), now()).Scan(&exists)
+	return exists, err
+}
+
+// Reset sets a new password for the owner of a token and returns their ID.
+// Every reset token of that user is used up with it, so an older email can't
+// undo the reset, a lockout after failed logins is lifted and the user is
+// logged out everywhere, see UserModel.SessionGeneration. It returns
+// ErrNoRecord for unknown and expired tokens.
+func (m *PasswordResetModel) Reset(plaintext, password string) (int, error) {
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), 12)
+	if err != nil {
+		return 0, err
+	}
+
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	// Locking the token means two concurrent requests can't both use it.
+	var userID int
+	stmt := `SELECT user_id FROM password_resets WHERE hash = ? AND expires > ?` + m.Dialect.forUpdate()
+	err = tx.QueryRow(m.Dialect.rebind(stmt), hashToken(plaintext), now()).Scan(&userID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, ErrNoRecord
+		}
+		return 0, err
+	}
+
+	stmt = `UPDATE users SET hashed_password = ?, session_generation = session_generation + 1,
+	failed_logins = 0, last_failed_login = NULL, locked_until = NULL WHERE id = ?`
+	_, err = tx.Exec(m.Dialect.rebind(stmt), string(hashedPassword), userID)
+	if err != nil {
+		return 0, err
+	}
+
+	stmt = `DELETE FROM password_resets WHERE user_id = ?`
+	_, err = tx.Exec(m.Dialect.rebind(stmt), userID)
+	if err != nil {
+		return 0, err
+	}
+	return userID, tx.Commit()
+}
+
+// DeleteExpired deletes up to limit expired reset tokens, and returns how
+// many were removed.
+func (m *PasswordResetModel) DeleteExpired(limit int) (int64, error) {
+	stmt := `DELETE FROM password_resets WHERE id IN (
+		SELECT id FROM (SELECT id FROM password_resets WHERE expires <= ? LIMIT ?) AS batch
+	)`
+	result, err := m.DB.Exec(m.Dialect.rebind(stmt), now(), limit)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
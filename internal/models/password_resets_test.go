@@ -0,0 +1,61 @@
+package models
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Abdelrahman-habib/noter/internal/assert"
+)
+
+func TestPasswordResetModel(t *testing.T) {
+	if testing.Short() {
+		t.Skip("models: skipping integration test")
+	}
+
+	db := newTestDB(t)
+	dialect := testDialect(t)
+	m := PasswordResetModel{DB: db, Dialect: dialect}
+	users := UserModel{DB: db, Dialect: dialect}
+
+	older, err := m.Insert(1, time.Hour)
+	assert.NilError(t, err)
+	token, err := m.Insert(1, time.Hour)
+	assert.NilError(t, err)
+	expired, err := m.Insert(1, -time.Minute)
+	assert.NilError(t, err)
+
+	exists, err := m.Exists(token)
+	assert.NilError(t, err)
+	assert.Equal(t, exists, true)
+	exists, err = m.Exists(expired)
+	assert.NilError(t, err)
+	assert.Equal(t, exists, false)
+
+	_, err = m.Reset(expired, "new password")
+	assert.Equal(t, errors.Is(err, ErrNoRecord), true)
+	removed, err := m.DeleteExpired(100)
+	assert.NilError(t, err)
+	assert.Equal(t, removed, 1)
+
+	generation, err := users.SessionGeneration(1)
+	assert.NilError(t, err)
+	userID, err := m.Reset(token, "new password")
+	assert.NilError(t, err)
+	assert.Equal(t, userID, 1)
+	_, err = users.Authenticate("alice@example.com", "new password")
+	assert.NilError(t, err)
+
+	// The reset logs the user out everywhere.
+	bumped, err := users.SessionGeneration(1)
+	assert.NilError(t, err)
+	assert.Equal(t, bumped, generation+1)
+	_, err = users.SessionGeneration(99)
+	assert.Equal(t, errors.Is(err, ErrNoRecord), true)
+
+	// Tokens are single-use, and a reset uses up the user's other tokens.
+	_, err = m.Reset(token, "another password")
+	assert.Equal(t, errors.Is(err, ErrNoRecord), true)
+	_, err = m.Reset(older, "another password")
+	assert.Equal(t, errors.Is(err, ErrNoRecord), true)
+}
@@ -0,0 +1,122 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// A Revision is a snapshot of a note's title and content, recorded every time
+// the note is created, edited or restored.
+type Revision struct {
+	ID         int       `json:"id"`
+	NoteID     string    `json:"note_id"`
+	Number     int       `json:"number"`
+	Title      string    `json:"title"`
+	Content    string    `json:"content"`
+	AuthorID   int       `json:"author_id"`
+	AuthorName string    `json:"author_name"`
+	Created    time.Time `json:"created"`
+}
+
+type RevisionModel struct {
+	DB      *sql.DB
+	Dialect Dialect
+}
+
+type RevisionModelInterface interface {
+	GetAllForNote(noteID string) ([]Revision, error)
+	Get(noteID string, id int) (Revision, error)
+	Restore(noteID string, id int, userID int) error
+}
+
+func insertRevision(tx *sql.Tx, dialect Dialect, noteID, title, content string, authorID int) error {
+	stmt := `INSERT INTO note_revisions (note_id, title, content, author_id, created) VALUES (?, ?, ?, ?, ?)`
+	_, err := tx.Exec(dialect.rebind(stmt), noteID, title, content, authorID, now())
+	return err
+}
+
+// revisionsSelect numbers the revisions of a note from 1, oldest first.
+const revisionsSelect = `SELECT note_revisions.id, note_revisions.note_id,
+	ROW_NUMBER() OVER (PARTITION BY note_revisions.note_id ORDER BY note_revisions.id) AS number,
+	note_revisions.title, note_revisions.content, note_revisions.author_id, users.name, note_revisions.created
+	FROM note_revisions
+	JOIN users ON note_revisions.author_id = users.id
+	WHERE note_revisions.note_id = ?`
+
+// GetAllForNote returns every revision of a note, newest first.
+func (m *RevisionModel) GetAllForNote(noteID string) ([]Revision, error) {
+	stmt := revisionsSelect + ` ORDER BY note_revisions.id DESC`
+
+	rows, err := m.DB.Query(m.Dialect.rebind(stmt), noteID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var revisions []Revision
+	for rows.Next() {
+		var r Revision
+		err := rows.Scan(&r.ID, &r.NoteID, &r.Number, &r.Title, &r.Content, &r.AuthorID, &r.AuthorName, &r.Created)
+		if err != nil {
+			return nil, err
+		}
+		revisions = append(revisions, r)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return revisions, nil
+}
+
+func (m *RevisionModel) Get(noteID string, id int) (Revision, error) {
+	// The window function has to see every revision of the note to number
+	// them, so the id filter is applied outside of it.
+	stmt := `SELECT * FROM (` + revisionsSelect + `) AS revisions WHERE revisions.id = ?`
+
+	var r Revision
+	err := m.DB.QueryRow(m.Dialect.rebind(stmt), noteID, id).Scan(&r.ID, &r.NoteID, &r.Number, &r.Title, &r.Content, &r.AuthorID, &r.AuthorName, &r.Created)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return Revision{}, ErrNoRecord
+		}
+		return Revision{}, err
+	}
+	return r, nil
+}
+
+// Restore copies the title and content of a revision back onto a note owned
+// by userID. History is never rewritten: the restore is recorded as a new
+// revision.
+func (m *RevisionModel) Restore(noteID string, id int, userID int) error {
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var title, content string
+	stmt := `SELECT note_revisions.title, note_revisions.content
+	FROM note_revisions
+	JOIN notes ON note_revisions.note_id = notes.id
+	WHERE note_revisions.note_id = ? AND note_revisions.id = ? AND notes.created_by = ? AND notes.deleted_at IS NULL` + m.Dialect.forUpdate()
+	err = tx.QueryRow(m.Dialect.rebind(stmt), noteID, id, userID).Scan(&title, &content)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrNoRecord
+		}
+		return err
+	}
+
+	stmt = `UPDATE notes SET title = ?, content = ?, updated = ?, version = version + 1 WHERE id = ?`
+	_, err = tx.Exec(m.Dialect.rebind(stmt), title, content, now(), noteID)
+	if err != nil {
+		return err
+	}
+
+	err = insertRevision(tx, m.Dialect, noteID, title, content, userID)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,89 @@
+package models
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Abdelrahman-habib/noter/internal/assert"
+)
+
+func TestRevisionModel(t *testing.T) {
+	if testing.Short() {
+		t.Skip("models: skipping integration test")
+	}
+
+	db := newTestDB(t)
+	notes := NoteModel{DB: db, Dialect: testDialect(t)}
+	users := UserModel{DB: db, Dialect: testDialect(t)}
+	m := RevisionModel{DB: db, Dialect: testDialect(t)}
+	owner := 1
+	bob, err := users.Insert("Bob", "bob@example.com", "pa$$word")
+	assert.NilError(t, err)
+	expires := time.Now().Add(time.Hour)
+
+	// Creating a note records its first revision.
+	id, err := notes.Insert("Draft", "First", FormatPlain, "", expires, true, false, "", owner)
+	assert.NilError(t, err)
+	revisions, err := m.GetAllForNote(id)
+	assert.NilError(t, err)
+	assert.Equal(t, len(revisions), 1)
+	assert.Equal(t, revisions[0].Number, 1)
+	assert.Equal(t, revisions[0].Content, "First")
+	assert.Equal(t, revisions[0].AuthorID, owner)
+
+	// Every edit of the title or content adds one, other changes don't.
+	_, err = notes.Update(id, 1, "Draft", "Second", FormatPlain, "", expires, true, owner)
+	assert.NilError(t, err)
+	_, err = notes.Update(id, 2, "Draft", "Second", FormatPlain, "", expires, false, owner)
+	assert.NilError(t, err)
+	revisions, err = m.GetAllForNote(id)
+	assert.NilError(t, err)
+	assert.Equal(t, len(revisions), 2)
+	assert.Equal(t, revisions[0].Number, 2)
+	assert.Equal(t, revisions[0].Content, "Second")
+	assert.Equal(t, revisions[1].Number, 1)
+	first := revisions[1]
+
+	// Revisions are numbered within their own note.
+	other, err := notes.Insert("Other", "Elsewhere", FormatPlain, "", expires, true, false, "", owner)
+	assert.NilError(t, err)
+	revisions, err = m.GetAllForNote(other)
+	assert.NilError(t, err)
+	assert.Equal(t, len(revisions), 1)
+	assert.Equal(t, revisions[0].Number, 1)
+
+	revision, err := m.Get(id, first.ID)
+	assert.NilError(t, err)
+	assert.Equal(t, revision.Number, 1)
+	assert.Equal(t, revision.Content, "First")
+	_, err = m.Get(other, first.ID)
+	assert.Equal(t, errors.Is(err, ErrNoRecord), true)
+
+	// Only the owner can restore a revision.
+	err = m.Restore(id, first.ID, bob)
+	assert.Equal(t, errors.Is(err, ErrNoRecord), true)
+	err = m.Restore(other, first.ID, owner)
+	assert.Equal(t, errors.Is(err, ErrNoRecord), true)
+
+	// Restoring adds a revision and leaves the older ones as they were.
+	assert.NilError(t, m.Restore(id, first.ID, owner))
+	note, err := notes.Get(id, &owner)
+	assert.NilError(t, err)
+	assert.Equal(t, note.Content, "First")
+	assert.Equal(t, note.Version, 4)
+	revisions, err = m.GetAllForNote(id)
+	assert.NilError(t, err)
+	assert.Equal(t, len(revisions), 3)
+	assert.Equal(t, revisions[0].Number, 3)
+	assert.Equal(t, revisions[0].Content, "First")
+	assert.Equal(t, revisions[1].Content, "Second")
+	assert.Equal(t, revisions[2].ID, first.ID)
+	assert.Equal(t, revisions[2].Content, "First")
+
+	// A restored note can be edited from its new version.
+	_, err = notes.Update(id, 3, "Draft", "Third", FormatPlain, "", expires, false, owner)
+	assert.Equal(t, errors.Is(err, ErrEditConflict), true)
+	_, err = notes.Update(id, 4, "Draft", "Third", FormatPlain, "", expires, false, owner)
+	assert.NilError(t, err)
+}
@@ -0,0 +1,31 @@
+package models
+
+import (
+	"database/sql"
+	"time"
+)
+
+// SessionModel gives the janitor access to the sessions table that the scs
+// session store reads and writes. Session data itself is only ever touched
+// through the session manager.
+type SessionModel struct {
+	DB      *sql.DB
+	Dialect Dialect
+}
+
+type SessionModelInterface interface {
+	DeleteExpired(limit int) (int64, error)
+}
+
+// DeleteExpired removes up to limit sessions whose expiry has passed, and
+// returns how many were removed.
+func (m *SessionModel) DeleteExpired(limit int) (int64, error) {
+	stmt := `DELETE FROM sessions WHERE token IN (
+		SELECT token FROM (SELECT token FROM sessions WHERE ` + m.Dialect.sessionExpired() + ` LIMIT ?) AS batch
+	)`
+	result, err := m.DB.Exec(m.Dialect.rebind(stmt), time.Now().UTC(), limit)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
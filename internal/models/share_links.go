@@ -0,0 +1,159 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// A ShareLink lets anyone holding its token view a note without logging in,
+// even a private one, until the link expires, runs out of views or is
+// revoked. As with access tokens, only the SHA-256 hash of the token is
+// stored.
+type ShareLink struct {
+	ID       int
+	NoteID   string
+	Created  time.Time
+	Expires  time.Time // zero when the link never expires
+	MaxViews int       // zero when the number of views is unlimited
+	Views    int
+}
+
+// Active reports whether the link can still be opened.
+func (l ShareLink) Active() bool {
+	if !l.Expires.IsZero() && !l.Expires.After(time.Now()) {
+		return false
+	}
+	return l.MaxViews == 0 || l.Views < l.MaxViews
+}
+
+type ShareLinkModel struct {
+	DB      *sql.DB
+	Dialect Dialect
+}
+
+type ShareLinkModelInterface interface {
+	Insert(noteID string, expires time.Time, maxViews int) (string, error)
+	Open(plaintext string) (NoteWithUsername, error)
+	GetAllForNote(noteID string) ([]ShareLink, error)
+	Delete(id int, noteID string) error
+	DeleteExpired(limit int) (int64, error)
+}
+
+// Insert creates a share link for a note and returns its token. A zero
+// expires or maxViews leaves that limit off.
+func (m *ShareLinkModel) Insert(noteID string, expires time.Time, maxViews int) (string, error) {
+	plaintext, err := randomToken()
+	if err != nil {
+		return "", err
+	}
+
+	var maxViewsArg any
+	if maxViews > 0 {
+		maxViewsArg = maxViews
+	}
+
+	stmt := `INSERT INTO share_links (note_id, hash, created, expires, max_views) VALUES (?, ?, ?, ?, ?)`
+	_, err = m.DB.Exec(m.Dialect.rebind(stmt), noteID, hashToken(plaintext), now(), nullTime(expires), maxViewsArg)
+	if err != nil {
+		return "", err
+	}
+	return plaintext, nil
+}
+
+// Open returns the note behind an active share link and counts the view. It
+// returns ErrNoRecord for unknown, expired and used up links, and for links
+// to notes that have expired or been moved to the trash; those don't spend a
+// view.
+func (m *ShareLinkModel) Open(plaintext string) (NoteWithUsername, error) {
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return NoteWithUsername{}, err
+	}
+	defer tx.Rollback()
+
+	hash := hashToken(plaintext)
+	current := now()
+
+	// Counting the view in the same statement that checks the limits means
+	// concurrent requests can't open a link more often than allowed.
+	stmt := `UPDATE share_links SET views = views + 1
+	WHERE hash = ? AND (expires IS NULL OR expires > ?) AND (max_views IS NULL OR views < max_views)`
+	result, err := tx.Exec(m.Dialect.rebind(stmt), hash, current)
+	if err != nil {
+		return NoteWithUsername{}, err
+	}
+	err = expectAffected(result)
+	if err != nil {
+		return NoteWithUsername{}, err
+	}
+
+	stmt = `SELECT ` + noteColumns + `
+	FROM share_links
+	JOIN notes ON share_links.note_id = notes.id
+	JOIN users ON notes.created_by = users.id
+	WHERE share_links.hash = ? AND ` + notExpired + ` AND notes.deleted_at IS NULL`
+
+	note, err := scanNote(tx.QueryRow(m.Dialect.rebind(stmt), hash, current))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return NoteWithUsername{}, ErrNoRecord
+		}
+		return NoteWithUsername{}, err
+	}
+	return note, tx.Commit()
+}
+
+// GetAllForNote returns every share link of a note, newest first, including
+// the ones that can no longer be opened.
+func (m *ShareLinkModel) GetAllForNote(noteID string) ([]ShareLink, error) {
+	stmt := `SELECT id, note_id, created, expires, max_views, views FROM share_links WHERE note_id = ? ORDER BY created DESC, id DESC`
+
+	rows, err := m.DB.Query(m.Dialect.rebind(stmt), noteID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var links []ShareLink
+	for rows.Next() {
+		var l ShareLink
+		var expires sql.NullTime
+		var maxViews sql.NullInt64
+		err := rows.Scan(&l.ID, &l.NoteID, &l.Created, &expires, &maxViews, &l.Views)
+		if err != nil {
+			return nil, err
+		}
+		l.Expires = expires.Time
+		l.MaxViews = int(maxViews.Int64)
+		links = append(links, l)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return links, nil
+}
+
+// Delete revokes a share link of the given note.
+func (m *ShareLinkModel) Delete(id int, noteID string) error {
+	stmt := `DELETE FROM share_links WHERE id = ? AND note_id = ?`
+	result, err := m.DB.Exec(m.Dialect.rebind(stmt), id, noteID)
+	if err != nil {
+		return err
+	}
+	return expectAffected(result)
+}
+
+// DeleteExpired deletes up to limit share links that have expired or used up
+// their views, and returns how many were removed.
+func (m *ShareLinkModel) DeleteExpired(limit int) (int64, error) {
+	stmt := `DELETE FROM share_links WHERE id IN (
+		SELECT id FROM (SELECT id FROM share_links
+		WHERE (expires IS NOT NULL AND expires <= ?) OR (max_views IS NOT NULL AND views >= max_views) LIMIT ?) AS batch
+	)`
+	result, err := m.DB.Exec(m.Dialect.rebind(stmt), now(), limit)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
@@ -0,0 +1,45 @@
+package models
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Abdelrahman-habib/noter/internal/assert"
+)
+
+func TestShareLinkModelOpen(t *testing.T) {
+	if testing.Short() {
+		t.Skip("models: skipping integration test")
+	}
+
+	db := newTestDB(t)
+	m := ShareLinkModel{DB: db, Dialect: testDialect(t)}
+	noteID := "550e8400-e29b-41d4-a716-446655440000"
+
+	limited, err := m.Insert(noteID, time.Time{}, 2)
+	assert.NilError(t, err)
+	for range 2 {
+		note, err := m.Open(limited)
+		assert.NilError(t, err)
+		assert.Equal(t, note.ID, noteID)
+	}
+	_, err = m.Open(limited)
+	assert.Equal(t, errors.Is(err, ErrNoRecord), true)
+
+	expired, err := m.Insert(noteID, time.Now().Add(-time.Minute), 0)
+	assert.NilError(t, err)
+	_, err = m.Open(expired)
+	assert.Equal(t, errors.Is(err, ErrNoRecord), true)
+
+	_, err = m.Open("unknown")
+	assert.Equal(t, errors.Is(err, ErrNoRecord), true)
+
+	links, err := m.GetAllForNote(noteID)
+	assert.NilError(t, err)
+	assert.Equal(t, len(links), 2)
+
+	removed, err := m.DeleteExpired(100)
+	assert.NilError(t, err)
+	assert.Equal(t, removed, 2)
+}
@@ -0,0 +1,101 @@
+package models
+
+import (
+	"database/sql"
+	"slices"
+	"strings"
+)
+
+type TagModel struct {
+	DB      *sql.DB
+	Dialect Dialect
+}
+
+type TagModelInterface interface {
+	SetForNote(noteID string, names []string) error
+	GetForNotes(noteIDs ...string) (map[string][]string, error)
+}
+
+// NormalizeTags lower-cases and trims tag names, splitting any comma separated
+// entries, and drops blanks and duplicates. The result is sorted.
+func NormalizeTags(raw []string) []string {
+	var tags []string
+	for _, entry := range raw {
+		for name := range strings.SplitSeq(entry, ",") {
+			name = strings.ToLower(strings.TrimSpace(name))
+			if name != "" && !slices.Contains(tags, name) {
+				tags = append(tags, name)
+			}
+		}
+	}
+	slices.Sort(tags)
+	return tags
+}
+
+// SetForNote replaces the tags of a note with names, creating any tag that
+// doesn't exist yet.
+func (m *TagModel) SetForNote(noteID string, names []string) error {
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(m.Dialect.rebind(`DELETE FROM note_tags WHERE note_id = ?`), noteID)
+	if err != nil {
+		return err
+	}
+
+	for _, name := range names {
+		tagID, err := m.Dialect.insertID(tx, m.Dialect.upsertTag(), name)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.Exec(m.Dialect.rebind(`INSERT INTO note_tags (note_id, tag_id) VALUES (?, ?)`), noteID, tagID)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// GetForNotes returns the sorted tag names of each of the given notes, keyed
+// by note id. Notes without tags are absent from the map.
+func (m *TagModel) GetForNotes(noteIDs ...string) (map[string][]string, error) {
+	tags := make(map[string][]string)
+	if len(noteIDs) == 0 {
+		return tags, nil
+	}
+
+	stmt := `SELECT note_tags.note_id, tags.name
+	FROM note_tags
+	JOIN tags ON note_tags.tag_id = tags.id
+	WHERE note_tags.note_id IN (?` + strings.Repeat(", ?", len(noteIDs)-1) + `)
+	ORDER BY tags.name`
+
+	args := make([]any, len(noteIDs))
+	for i, id := range noteIDs {
+		args[i] = id
+	}
+
+	rows, err := m.DB.Query(m.Dialect.rebind(stmt), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var noteID, name string
+		err := rows.Scan(&noteID, &name)
+		if err != nil {
+			return nil, err
+		}
+		tags[noteID] = append(tags[noteID], name)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return tags, nil
+}
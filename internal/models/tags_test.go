@@ -0,0 +1,37 @@
+package models
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/Abdelrahman-habib/noter/internal/assert"
+)
+
+func TestNormalizeTags(t *testing.T) {
+	tests := []struct {
+		name string
+		raw  []string
+		want []string
+	}{
+		{
+			name: "Comma separated",
+			raw:  []string{"go, SQL ,snippets"},
+			want: []string{"go", "snippets", "sql"},
+		},
+		{
+			name: "Duplicates and blanks",
+			raw:  []string{"go", " Go", "", ",,"},
+			want: []string{"go"},
+		},
+		{
+			name: "Empty",
+			raw:  nil,
+			want: nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, slices.Equal(NormalizeTags(tt.raw), tt.want), true)
+		})
+	}
+}
@@ -5,13 +5,27 @@ import (
 	"testing"
 
 	schema "github.com/Abdelrahman-habib/noter/db/schema"
+	_ "github.com/jackc/pgx/v5/stdlib"
 	"github.com/pressly/goose/v3"
+	_ "modernc.org/sqlite"
 )
 
+// testDialect returns the dialect selected with the -db-dialect test flag.
+func testDialect(t *testing.T) Dialect {
+	dialect, err := ParseDialect(parseFlags().dbDialect)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dialect
+}
+
 func newTestDB(t *testing.T) *sql.DB {
 	config := parseFlags()
+	dialect := testDialect(t)
+	migrationsDir, seedDir := schema.Dirs(config.dbDialect)
+
 	// Establish a sql.DB connection pool for our test database
-	db, err := sql.Open(config.dbDialect, config.testDSN)
+	db, err := sql.Open(dialect.DriverName(), config.testDSN)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -19,19 +33,19 @@ func newTestDB(t *testing.T) *sql.DB {
 	goose.SetBaseFS(schema.EmbedMigrations)
 
 	// Set the dialect for goose
-	if err := goose.SetDialect(config.dbDialect); err != nil {
+	if err := goose.SetDialect(dialect.GooseDialect()); err != nil {
 		db.Close()
 		t.Fatalf("failed to set goose dialect: %v", err)
 	}
 
 	// Run migrations using goose library
-	if err := goose.Up(db, "migrations", goose.WithNoVersioning()); err != nil {
+	if err := goose.Up(db, migrationsDir, goose.WithNoVersioning()); err != nil {
 		db.Close()
 		t.Fatalf("failed to run migrations: %v", err)
 	}
 
 	// Run seed data using goose library (no versioning for seeds)
-	if err := goose.Up(db, "seed", goose.WithNoVersioning()); err != nil {
+	if err := goose.Up(db, seedDir, goose.WithNoVersioning()); err != nil {
 		db.Close()
 		t.Fatalf("failed to run seeds: %v", err)
 	}
@@ -43,12 +57,12 @@ func newTestDB(t *testing.T) *sql.DB {
 		defer db.Close()
 
 		// Reset seed data (no versioning for seeds)
-		if err := goose.Reset(db, "seed", goose.WithNoVersioning()); err != nil {
+		if err := goose.Reset(db, seedDir, goose.WithNoVersioning()); err != nil {
 			t.Logf("warning: failed to reset seeds: %v", err)
 		}
 
 		// Reset migrations
-		if err := goose.Reset(db, "migrations", goose.WithNoVersioning()); err != nil {
+		if err := goose.Reset(db, migrationsDir, goose.WithNoVersioning()); err != nil {
 			t.Logf("warning: failed to reset migrations: %v", err)
 		}
 	})
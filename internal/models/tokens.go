@@ -0,0 +1,136 @@
+package models
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base32"
+	"errors"
+	"time"
+)
+
+const (
+	ScopeRead  = "read"
+	ScopeWrite = "write"
+)
+
+// tokenPrefix marks personal access tokens so they are easy to recognise in
+// scripts and secret scanners.
+const tokenPrefix = "noter_"
+
+// A Token is a personal access token. Only the SHA-256 hash of the plaintext
+// is stored, so the plaintext is shown to the user exactly once, when minted.
+type Token struct {
+	ID       int
+	UserID   int
+	Name     string
+	Scope    string
+	Created  time.Time
+	LastUsed time.Time
+}
+
+type TokenModel struct {
+	DB      *sql.DB
+	Dialect Dialect
+}
+
+type TokenModelInterface interface {
+	Insert(userID int, name, scope string) (string, error)
+	Authenticate(plaintext string) (int, string, error)
+	GetAllForUser(userID int) ([]Token, error)
+	Delete(id int, userID int) error
+}
+
+func hashToken(plaintext string) []byte {
+	hash := sha256.Sum256([]byte(plaintext))
+	return hash[:]
+}
+
+// randomToken returns 160 random bits, base32 encoded so they are safe in
+// URLs and headers alike.
+func randomToken() (string, error) {
+	randomBytes := make([]byte, 20)
+	_, err := rand.Read(randomBytes)
+	if err != nil {
+		return "", err
+	}
+	return base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(randomBytes), nil
+}
+
+// Insert mints a new token for the user and returns its plaintext.
+func (m *TokenModel) Insert(userID int, name, scope string) (string, error) {
+	random, err := randomToken()
+	if err != nil {
+		return "", err
+	}
+	plaintext := tokenPrefix + random
+
+	stmt := `INSERT INTO tokens (user_id, name, hash, scope, created) VALUES (?, ?, ?, ?, ?)`
+	_, err = m.DB.Exec(m.Dialect.rebind(stmt), userID, name, hashToken(plaintext), scope, now())
+	if err != nil {
+		return "", err
+	}
+	return plaintext, nil
+}
+
+// Authenticate looks up the owner and scope of a plaintext token and records
+// the time it was used.
+func (m *TokenModel) Authenticate(plaintext string) (int, string, error) {
+	var id, userID int
+	var scope string
+
+	stmt := `SELECT tokens.id, tokens.user_id, tokens.scope FROM tokens
+	JOIN users ON tokens.user_id = users.id
+	WHERE tokens.hash = ?`
+
+	err := m.DB.QueryRow(m.Dialect.rebind(stmt), hashToken(plaintext)).Scan(&id, &userID, &scope)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, "", ErrInvalidCredentials
+		}
+		return 0, "", err
+	}
+
+	stmt = `UPDATE tokens SET last_used = ? WHERE id = ?`
+	_, err = m.DB.Exec(m.Dialect.rebind(stmt), now(), id)
+	if err != nil {
+		return 0, "", err
+	}
+	return userID, scope, nil
+}
+
+func (m *TokenModel) GetAllForUser(userID int) ([]Token, error) {
+	stmt := `SELECT id, user_id, name, scope, created, last_used FROM tokens WHERE user_id = ? ORDER BY created DESC, id DESC`
+
+	rows, err := m.DB.Query(m.Dialect.rebind(stmt), userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tokens []Token
+	for rows.Next() {
+		var t Token
+		var lastUsed sql.NullTime
+		err := rows.Scan(&t.ID, &t.UserID, &t.Name, &t.Scope, &t.Created, &lastUsed)
+		if err != nil {
+			return nil, err
+		}
+		t.LastUsed = lastUsed.Time
+		tokens = append(tokens, t)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return tokens, nil
+}
+
+// Delete revokes a token. Only the token's owner may revoke it.
+func (m *TokenModel) Delete(id int, userID int) error {
+	stmt := `DELETE FROM tokens WHERE id = ? AND user_id = ?`
+	result, err := m.DB.Exec(m.Dialect.rebind(stmt), id, userID)
+	if err != nil {
+		return err
+	}
+	return expectAffected(result)
+}
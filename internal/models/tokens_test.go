@@ -0,0 +1,67 @@
+package models
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/Abdelrahman-habib/noter/internal/assert"
+)
+
+func TestTokenModelAuthenticate(t *testing.T) {
+	if testing.Short() {
+		t.Skip("models: skipping integration test")
+	}
+
+	db := newTestDB(t)
+	dialect := testDialect(t)
+	m := TokenModel{DB: db, Dialect: dialect}
+	users := UserModel{DB: db, Dialect: dialect}
+	owner := 1
+	bob, err := users.Insert("Bob", "bob@example.com", "pa$$word")
+	assert.NilError(t, err)
+
+	reader, err := m.Insert(owner, "Backups", ScopeRead)
+	assert.NilError(t, err)
+	writer, err := m.Insert(bob, "Sync", ScopeWrite)
+	assert.NilError(t, err)
+	assert.Equal(t, strings.HasPrefix(reader, tokenPrefix), true)
+
+	// Only the hash of a token is stored.
+	var stored int
+	err = db.QueryRow(dialect.rebind(`SELECT COUNT(*) FROM tokens WHERE hash = ? OR hash = ?`), []byte(reader), []byte(writer)).Scan(&stored)
+	assert.NilError(t, err)
+	assert.Equal(t, stored, 0)
+
+	tokens, err := m.GetAllForUser(owner)
+	assert.NilError(t, err)
+	assert.Equal(t, len(tokens), 1)
+	assert.Equal(t, tokens[0].LastUsed.IsZero(), true)
+
+	// A token authenticates its owner with its scope, and records its use.
+	userID, scope, err := m.Authenticate(reader)
+	assert.NilError(t, err)
+	assert.Equal(t, userID, owner)
+	assert.Equal(t, scope, ScopeRead)
+	userID, scope, err = m.Authenticate(writer)
+	assert.NilError(t, err)
+	assert.Equal(t, userID, bob)
+	assert.Equal(t, scope, ScopeWrite)
+
+	tokens, err = m.GetAllForUser(owner)
+	assert.NilError(t, err)
+	assert.Equal(t, tokens[0].LastUsed.IsZero(), false)
+
+	for _, plaintext := range []string{"", tokenPrefix, strings.ToLower(reader), reader + "A"} {
+		_, _, err = m.Authenticate(plaintext)
+		assert.Equal(t, errors.Is(err, ErrInvalidCredentials), true)
+	}
+
+	// Revoked tokens no longer authenticate. Only their owner can revoke
+	// them.
+	err = m.Delete(tokens[0].ID, bob)
+	assert.Equal(t, errors.Is(err, ErrNoRecord), true)
+	assert.NilError(t, m.Delete(tokens[0].ID, owner))
+	_, _, err = m.Authenticate(reader)
+	assert.Equal(t, errors.Is(err, ErrInvalidCredentials), true)
+}
@@ -0,0 +1,203 @@
+package models
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"errors"
+	"strings"
+
+	"github.com/Abdelrahman-habib/noter/internal/totp"
+)
+
+// recoveryCodeCount is how many recovery codes a user gets at a time. Each
+// one can stand in for an authenticator code once.
+const recoveryCodeCount = 10
+
+// recoveryAlphabet is Crockford's base32, which leaves out the letters that
+// are easily confused with digits on paper.
+const recoveryAlphabet = "0123456789abcdefghjkmnpqrstvwxyz"
+
+// TwoFactorModel manages the TOTP secrets of users who have turned on
+// two-factor authentication, and their recovery codes. Like access tokens,
+// recovery codes are only stored as SHA-256 hashes.
+type TwoFactorModel struct {
+	DB      *sql.DB
+	Dialect Dialect
+}
+
+type TwoFactorModelInterface interface {
+	Enable(userID int, secret string) ([]string, error)
+	Disable(userID int) error
+	Verify(userID int, code string) error
+	UseRecoveryCode(userID int, code string) error
+	RegenerateRecoveryCodes(userID int) ([]string, error)
+	RecoveryCodesLeft(userID int) (int, error)
+}
+
+// newRecoveryCode returns a random code of the form xxxxx-xxxxx.
+func newRecoveryCode() (string, error) {
+	randomBytes := make([]byte, 10)
+	_, err := rand.Read(randomBytes)
+	if err != nil {
+		return "", err
+	}
+	var b strings.Builder
+	for i, c := range randomBytes {
+		if i == 5 {
+			b.WriteByte('-')
+		}
+		b.WriteByte(recoveryAlphabet[c&31])
+	}
+	return b.String(), nil
+}
+
+// normalizeRecoveryCode drops the formatting people may or may not copy
+// along with a code.
+func normalizeRecoveryCode(code string) string {
+	return strings.NewReplacer("-", "", " ", "").Replace(strings.ToLower(strings.TrimSpace(code)))
+}
+
+// replaceRecoveryCodes deletes the user's recovery codes and stores a new
+// set, whose plaintexts it returns.
+func (m *TwoFactorModel) replaceRecoveryCodes(tx *sql.Tx, userID int) ([]string, error) {
+	_, err := tx.Exec(m.Dialect.rebind(`DELETE FROM recovery_codes WHERE user_id = ?`), userID)
+	if err != nil {
+		return nil, err
+	}
+
+	codes := make([]string, recoveryCodeCount)
+	stmt := `INSERT INTO recovery_codes (user_id, hash, created) VALUES (?, ?, ?)`
+	for i := range codes {
+		codes[i], err = newRecoveryCode()
+		if err != nil {
+			return nil, err
+		}
+		_, err = tx.Exec(m.Dialect.rebind(stmt), userID, hashToken(normalizeRecoveryCode(codes[i])), now())
+		if err != nil {
+			return nil, err
+		}
+	}
+	return codes, nil
+}
+
+// Enable turns on two-factor authentication for a user with a secret they
+// have proven to have set up, and returns their first recovery codes.
+func (m *TwoFactorModel) Enable(userID int, secret string) ([]string, error) {
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	stmt := `UPDATE users SET totp_secret = ?, totp_last_step = NULL WHERE id = ?`
+	result, err := tx.Exec(m.Dialect.rebind(stmt), secret, userID)
+	if err != nil {
+		return nil, err
+	}
+	err = expectAffected(result)
+	if err != nil {
+		return nil, err
+	}
+
+	codes, err := m.replaceRecoveryCodes(tx, userID)
+	if err != nil {
+		return nil, err
+	}
+	return codes, tx.Commit()
+}
+
+// Disable turns off two-factor authentication for a user and deletes their
+// recovery codes.
+func (m *TwoFactorModel) Disable(userID int) error {
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	stmt := `UPDATE users SET totp_secret = NULL, totp_last_step = NULL WHERE id = ?`
+	_, err = tx.Exec(m.Dialect.rebind(stmt), userID)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(m.Dialect.rebind(`DELETE FROM recovery_codes WHERE user_id = ?`), userID)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// Verify checks a code from the user's authenticator app. Each code is only
+// accepted once: it returns ErrInvalidCredentials for wrong codes, codes that
+// have already been used and users without two-factor authentication.
+func (m *TwoFactorModel) Verify(userID int, code string) error {
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var secret sql.NullString
+	var lastStep sql.NullInt64
+	stmt := `SELECT totp_secret, totp_last_step FROM users WHERE id = ?` + m.Dialect.forUpdate()
+	err = tx.QueryRow(m.Dialect.rebind(stmt), userID).Scan(&secret, &lastStep)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrInvalidCredentials
+		}
+		return err
+	}
+	if !secret.Valid {
+		return ErrInvalidCredentials
+	}
+
+	step, ok := totp.Validate(secret.String, strings.TrimSpace(code), now())
+	if !ok || (lastStep.Valid && step <= lastStep.Int64) {
+		return ErrInvalidCredentials
+	}
+
+	stmt = `UPDATE users SET totp_last_step = ? WHERE id = ?`
+	_, err = tx.Exec(m.Dialect.rebind(stmt), step, userID)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// UseRecoveryCode spends one of the user's recovery codes, or returns
+// ErrInvalidCredentials if they have no such code left.
+func (m *TwoFactorModel) UseRecoveryCode(userID int, code string) error {
+	stmt := `DELETE FROM recovery_codes WHERE user_id = ? AND hash = ?`
+	result, err := m.DB.Exec(m.Dialect.rebind(stmt), userID, hashToken(normalizeRecoveryCode(code)))
+	if err != nil {
+		return err
+	}
+	err = expectAffected(result)
+	if errors.Is(err, ErrNoRecord) {
+		return ErrInvalidCredentials
+	}
+	return err
+}
+
+// RegenerateRecoveryCodes replaces all of the user's recovery codes, used or
+// not, with a new set.
+func (m *TwoFactorModel) RegenerateRecoveryCodes(userID int) ([]string, error) {
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	codes, err := m.replaceRecoveryCodes(tx, userID)
+	if err != nil {
+		return nil, err
+	}
+	return codes, tx.Commit()
+}
+
+func (m *TwoFactorModel) RecoveryCodesLeft(userID int) (int, error) {
+	var count int
+	stmt := `SELECT COUNT(*) FROM recovery_codes WHERE user_id = ?`
+	err := m.DB.QueryRow(m.Dialect.rebind(stmt), userID).Scan(&count)
+	return count, err
+}
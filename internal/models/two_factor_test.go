@@ -0,0 +1,62 @@
+package models
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Abdelrahman-habib/noter/internal/assert"
+	"github.com/Abdelrahman-habib/noter/internal/totp"
+)
+
+func TestTwoFactorModel(t *testing.T) {
+	if testing.Short() {
+		t.Skip("models: skipping integration test")
+	}
+
+	db := newTestDB(t)
+	dialect := testDialect(t)
+	m := TwoFactorModel{DB: db, Dialect: dialect}
+	users := UserModel{DB: db, Dialect: dialect}
+
+	secret, err := totp.NewSecret()
+	assert.NilError(t, err)
+	codes, err := m.Enable(1, secret)
+	assert.NilError(t, err)
+	assert.Equal(t, len(codes), recoveryCodeCount)
+	user, err := users.GetByID(1)
+	assert.NilError(t, err)
+	assert.Equal(t, user.TwoFactorEnabled, true)
+
+	// A code is accepted once.
+	code, err := totp.Code(secret, time.Now())
+	assert.NilError(t, err)
+	assert.NilError(t, m.Verify(1, code))
+	err = m.Verify(1, code)
+	assert.Equal(t, errors.Is(err, ErrInvalidCredentials), true)
+
+	// So is a recovery code, however it is formatted.
+	assert.NilError(t, m.UseRecoveryCode(1, " "+strings.ToUpper(codes[0])+" "))
+	err = m.UseRecoveryCode(1, codes[0])
+	assert.Equal(t, errors.Is(err, ErrInvalidCredentials), true)
+	left, err := m.RecoveryCodesLeft(1)
+	assert.NilError(t, err)
+	assert.Equal(t, left, recoveryCodeCount-1)
+
+	fresh, err := m.RegenerateRecoveryCodes(1)
+	assert.NilError(t, err)
+	err = m.UseRecoveryCode(1, codes[1])
+	assert.Equal(t, errors.Is(err, ErrInvalidCredentials), true)
+	assert.NilError(t, m.UseRecoveryCode(1, strings.ReplaceAll(fresh[1], "-", "")))
+
+	assert.NilError(t, m.Disable(1))
+	user, err = users.GetByID(1)
+	assert.NilError(t, err)
+	assert.Equal(t, user.TwoFactorEnabled, false)
+	left, err = m.RecoveryCodesLeft(1)
+	assert.NilError(t, err)
+	assert.Equal(t, left, 0)
+	err = m.Verify(1, code)
+	assert.Equal(t, errors.Is(err, ErrInvalidCredentials), true)
+}
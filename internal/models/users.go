@@ -3,31 +3,42 @@ package models
 import (
 	"database/sql"
 	"errors"
-	"strings"
 	"time"
 
-	"github.com/go-sql-driver/mysql"
 	"golang.org/x/crypto/bcrypt"
 )
 
 type User struct {
-	ID             int
-	Name           string
-	Email          string
-	HashedPassword []byte
-	Created        time.Time
+	ID             int       `json:"id"`
+	Name           string    `json:"name"`
+	Email          string    `json:"email,omitempty"`
+	HashedPassword []byte    `json:"-"`
+	Created        time.Time `json:"created"`
+	// EmailVerified is set once the user has followed the link sent to
+	// their email address. Until then they can't publish public notes.
+	EmailVerified bool `json:"email_verified,omitempty"`
+	// TwoFactorEnabled is set when logging in also takes a code from an
+	// authenticator app.
+	TwoFactorEnabled bool `json:"-"`
+	// Admin is set for users who may look after other accounts, such as
+	// unlocking them after too many failed logins.
+	Admin bool `json:"-"`
 }
 
 type UserModel struct {
-	DB *sql.DB
+	DB      *sql.DB
+	Dialect Dialect
 }
 
 type UserModelInterface interface {
 	Insert(name, email, password string) (int, error)
 	Authenticate(email, password string) (int, error)
 	GetByID(id int) (User, error)
+	GetByEmail(email string) (User, error)
 	Exists(id int) (bool, error)
+	SessionGeneration(id int) (int, error)
 	ChangePassword(id int, currentPassword, newPassword string) error
+	VerifyEmail(id int, email string) error
 }
 
 func (m *UserModel) Insert(name, email, password string) (int, error) {
@@ -36,22 +47,14 @@ func (m *UserModel) Insert(name, email, password string) (int, error) {
 		return 0, err
 	}
 
-	stmt := `INSERT INTO users (name, email, hashed_password, created) VALUES (?, ?, ?, UTC_TIMESTAMP())`
-	result, err := m.DB.Exec(stmt, name, email, string(hashedPassword))
+	stmt := `INSERT INTO users (name, email, hashed_password, created) VALUES (?, ?, ?, ?)`
+	id, err := m.Dialect.insertID(m.DB, stmt, name, email, string(hashedPassword), now())
 	if err != nil {
-		var mysqlErr *mysql.MySQLError
-		if errors.As(err, &mysqlErr) {
-			if mysqlErr.Number == 1062 && strings.Contains(mysqlErr.Message, "users_uc_email") {
-				return 0, ErrDuplicateEmail
-			}
+		if m.Dialect.isDuplicate(err, "users_uc_email") {
+			return 0, ErrDuplicateEmail
 		}
 		return 0, err
 	}
-
-	id, err := result.LastInsertId()
-	if err != nil {
-		return 0, err
-	}
 	return int(id), nil
 }
 
@@ -61,7 +64,7 @@ func (m *UserModel) Authenticate(email, password string) (int, error) {
 
 	stmt := `SELECT id, hashed_password FROM users WHERE email = ?`
 
-	err := m.DB.QueryRow(stmt, email).Scan(&id, &hashed_password)
+	err := m.DB.QueryRow(m.Dialect.rebind(stmt), email).Scan(&id, &hashed_password)
 
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
@@ -85,14 +88,45 @@ func (m *UserModel) Exists(id int) (bool, error) {
 	var exists bool
 
 	stmt := `SELECT EXISTS(SELECT true FROM users WHERE id =?)`
-	err := m.DB.QueryRow(stmt, id).Scan(&exists)
+	err := m.DB.QueryRow(m.Dialect.rebind(stmt), id).Scan(&exists)
 	return exists, err
 }
 
+// SessionGeneration returns the generation of the user's sessions. Logging in
+// records it in the session, which stays logged in for as long as it matches,
+// so bumping it logs the user out everywhere. It returns ErrNoRecord for
+// unknown users.
+func (m *UserModel) SessionGeneration(id int) (int, error) {
+	var generation int
+
+	stmt := `SELECT session_generation FROM users WHERE id = ?`
+	err := m.DB.QueryRow(m.Dialect.rebind(stmt), id).Scan(&generation)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, ErrNoRecord
+		}
+		return 0, err
+	}
+	return generation, nil
+}
+
 func (m *UserModel) GetByID(id int) (User, error) {
-	stmt := `SELECT id, name, email, created FROM users WHERE id = ?`
+	stmt := `SELECT id, name, email, created, email_verified, totp_secret IS NOT NULL, admin FROM users WHERE id = ?`
 	var user User
-	err := m.DB.QueryRow(stmt, id).Scan(&user.ID, &user.Name, &user.Email, &user.Created)
+	err := m.DB.QueryRow(m.Dialect.rebind(stmt), id).Scan(&user.ID, &user.Name, &user.Email, &user.Created, &user.EmailVerified, &user.TwoFactorEnabled, &user.Admin)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return User{}, ErrNoRecord
+		}
+		return User{}, err
+	}
+	return user, nil
+}
+
+func (m *UserModel) GetByEmail(email string) (User, error) {
+	stmt := `SELECT id, name, email, created, email_verified, totp_secret IS NOT NULL, admin FROM users WHERE email = ?`
+	var user User
+	err := m.DB.QueryRow(m.Dialect.rebind(stmt), email).Scan(&user.ID, &user.Name, &user.Email, &user.Created, &user.EmailVerified, &user.TwoFactorEnabled, &user.Admin)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return User{}, ErrNoRecord
@@ -105,7 +139,7 @@ func (m *UserModel) GetByID(id int) (User, error) {
 func (m *UserModel) ChangePassword(id int, currentPassword, newPassword string) error {
 	var hashedPassword []byte
 	stmt := `SELECT hashed_password FROM users WHERE id = ?`
-	err := m.DB.QueryRow(stmt, id).Scan(&hashedPassword)
+	err := m.DB.QueryRow(m.Dialect.rebind(stmt), id).Scan(&hashedPassword)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return ErrInvalidCredentials
@@ -129,7 +163,36 @@ func (m *UserModel) ChangePassword(id int, currentPassword, newPassword string)
 
 	stmt = `UPDATE users SET hashed_password = ? WHERE id = ?`
 
-	_, err = m.DB.Exec(stmt, string(hashedPassword), id)
+	_, err = m.DB.Exec(m.Dialect.rebind(stmt), string(hashedPassword), id)
 
 	return err
 }
+
+// VerifyEmail marks a user's email address as verified. The address is the
+// one the verification link was sent to: it returns ErrNoRecord when the user
+// doesn't exist or no longer has that address. Verifying twice is harmless.
+func (m *UserModel) VerifyEmail(id int, email string) error {
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var exists int
+	stmt := `SELECT 1 FROM users WHERE id = ? AND email = ?` + m.Dialect.forUpdate()
+	err = tx.QueryRow(m.Dialect.rebind(stmt), id, email).Scan(&exists)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrNoRecord
+		}
+		return err
+	}
+
+	// Verifying a verified address leaves the row as it was, which MySQL
+	// reports as no rows affected, hence the SELECT above.
+	_, err = tx.Exec(m.Dialect.rebind(`UPDATE users SET email_verified = TRUE WHERE id = ?`), id)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
@@ -1,6 +1,7 @@
 package models
 
 import (
+	"errors"
 	"testing"
 
 	"github.com/Abdelrahman-habib/noter/internal/assert"
@@ -39,7 +40,7 @@ func TestUserModelExists(t *testing.T) {
 			// for each sub-test.
 			db := newTestDB(t)
 			// Create a new instance of the UserModel.
-			m := UserModel{db}
+			m := UserModel{DB: db, Dialect: testDialect(t)}
 			// Call the UserModel.Exists() method and check that the return
 			// value and error match the expected values for the sub-test.
 			exists, err := m.Exists(tt.userID)
@@ -48,3 +49,28 @@ func TestUserModelExists(t *testing.T) {
 		})
 	}
 }
+
+func TestUserModelVerifyEmail(t *testing.T) {
+	if testing.Short() {
+		t.Skip("models: skipping integration test")
+	}
+
+	db := newTestDB(t)
+	m := UserModel{DB: db, Dialect: testDialect(t)}
+
+	id, err := m.Insert("Bob", "bob@example.com", "pa$$word")
+	assert.NilError(t, err)
+	user, err := m.GetByID(id)
+	assert.NilError(t, err)
+	assert.Equal(t, user.EmailVerified, false)
+
+	// Links sent to another address don't verify this one.
+	err = m.VerifyEmail(id, "eve@example.com")
+	assert.Equal(t, errors.Is(err, ErrNoRecord), true)
+
+	assert.NilError(t, m.VerifyEmail(id, "bob@example.com"))
+	assert.NilError(t, m.VerifyEmail(id, "bob@example.com"))
+	user, err = m.GetByEmail("bob@example.com")
+	assert.NilError(t, err)
+	assert.Equal(t, user.EmailVerified, true)
+}
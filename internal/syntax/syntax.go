@@ -0,0 +1,160 @@
+// Package syntax colours source code for display. The output carries CSS
+// classes rather than inline styles, so it works under the site's
+// Content-Security-Policy; the classes are defined in
+// ui/static/css/syntax.css.
+package syntax
+
+import (
+	"bytes"
+	"encoding/json"
+	"html/template"
+	"regexp"
+	"strings"
+
+	"github.com/alecthomas/chroma/v2"
+	"github.com/alecthomas/chroma/v2/formatters/html"
+	"github.com/alecthomas/chroma/v2/lexers"
+	"github.com/alecthomas/chroma/v2/styles"
+)
+
+// A Language is one of the languages notes can be highlighted as. ID is what
+// gets stored with a note and is also the name of its chroma lexer.
+type Language struct {
+	ID   string
+	Name string
+}
+
+// Languages lists the supported languages, in the order they are offered in
+// the note form.
+var Languages = []Language{
+	{"bash", "Bash"},
+	{"c", "C"},
+	{"cpp", "C++"},
+	{"csharp", "C#"},
+	{"css", "CSS"},
+	{"docker", "Dockerfile"},
+	{"go", "Go"},
+	{"html", "HTML"},
+	{"java", "Java"},
+	{"javascript", "JavaScript"},
+	{"json", "JSON"},
+	{"kotlin", "Kotlin"},
+	{"markdown", "Markdown"},
+	{"php", "PHP"},
+	{"python", "Python"},
+	{"ruby", "Ruby"},
+	{"rust", "Rust"},
+	{"sql", "SQL"},
+	{"swift", "Swift"},
+	{"toml", "TOML"},
+	{"typescript", "TypeScript"},
+	{"yaml", "YAML"},
+}
+
+// Supported reports whether id is one of the supported languages.
+func Supported(id string) bool {
+	return Name(id) != ""
+}
+
+// Name returns the display name of the language id, or "" if it isn't
+// supported.
+func Name(id string) string {
+	for _, lang := range Languages {
+		if lang.ID == id {
+			return lang.Name
+		}
+	}
+	return ""
+}
+
+// A hint is a pattern suggesting a language, and how strongly it does so.
+type hint struct {
+	rx     *regexp.Regexp
+	weight int
+}
+
+func h(pattern string, weight int) hint {
+	return hint{regexp.MustCompile(`(?m)` + pattern), weight}
+}
+
+// hints are matched against a note's content to guess its language. They
+// are deliberately simple: a wrong guess only costs the wrong colours, and
+// the author can always pick the language themselves.
+var hints = map[string][]hint{
+	"bash":       {h(`^#!.*\b(ba|z)?sh\b`, 3), h(`^\s*(echo|export|sudo|apt-get|apt|fi|done|esac)\b`, 1), h(`\$\{\w+\}|\$\(`, 1)},
+	"c":          {h(`^#include <\w+\.h>`, 2), h(`\bint main\(`, 1), h(`\bprintf\(`, 1)},
+	"cpp":        {h(`^#include <\w+>\s*$`, 2), h(`\bstd::`, 2), h(`\bcout\s*<<`, 1)},
+	"csharp":     {h(`^using System`, 2), h(`Console\.WriteLine`, 2), h(`^\s*namespace \w+`, 1)},
+	"css":        {h(`^\s*[.#]?[\w-]+(\s*[,>+~]?\s*[.#]?[\w-]+)*\s*\{\s*$`, 1), h(`^\s*[\w-]+:\s*[^;{}]+;\s*$`, 1)},
+	"docker":     {h(`^FROM \S+`, 2), h(`^(RUN|COPY|CMD|ENTRYPOINT|WORKDIR|EXPOSE|ENV) `, 1)},
+	"go":         {h(`^package \w+\s*$`, 3), h(`^func (\(\w+ \*?\w+\) )?\w+\(`, 1), h(`:=`, 1), h(`^import \(`, 1), h(`\bfmt\.`, 1)},
+	"html":       {h(`(?i)<!DOCTYPE html`, 3), h(`</(html|head|body|div|span|p|a|ul|li)>`, 1)},
+	"java":       {h(`\bpublic (static )?(final )?(class|void|interface)\b`, 2), h(`System\.out\.print`, 2), h(`^import java\.`, 2)},
+	"javascript": {h(`\b(const|let|var) \w+ = `, 1), h(`\bfunction\b`, 1), h(`=>`, 1), h(`console\.log`, 2), h(`\brequire\(`, 1), h(`\bdocument\.`, 1)},
+	"kotlin":     {h(`^\s*fun \w+\(`, 2), h(`\bval \w+ = `, 1)},
+	"markdown":   {h(`^#{1,6} \S`, 1), h("^```", 1), h(`\[[^\]]+\]\([^)]+\)`, 1)},
+	"php":        {h(`<\?php`, 3), h(`\$\w+\s*=`, 1), h(`\becho\b`, 1)},
+	"python":     {h(`^#!.*python`, 3), h(`^\s*def \w+\(.*\)( -> [^:]+)?:\s*$`, 2), h(`^\s*(from \S+ )?import \w+`, 1), h(`^\s*class \w+.*:\s*$`, 1), h(`\bself\.`, 1), h(`\belif\b`, 1)},
+	"ruby":       {h(`^\s*def \w+[^:]*$`, 1), h(`^\s*end\s*$`, 1), h(`\bputs\b`, 1), h(`^require '`, 2)},
+	"rust":       {h(`\bfn \w+\(`, 2), h(`\blet mut\b`, 2), h(`\w+!\(`, 1), h(`^use \w+::`, 2), h(`^impl\b`, 1)},
+	"sql":        {h(`(?i)^\s*(SELECT|INSERT INTO|UPDATE|DELETE FROM|CREATE (TABLE|INDEX)|ALTER TABLE|DROP TABLE)\b`, 2), h(`(?i)\bFROM\s+\w+(\s+\w+)?\s+WHERE\b`, 1)},
+	"swift":      {h(`\bfunc \w+\(.*\) -> `, 2), h(`\bguard let\b`, 2), h(`^import (UIKit|Foundation|SwiftUI)`, 2)},
+	"toml":       {h(`^\[[\w.-]+\]\s*$`, 1), h(`^[\w-]+ = ("|'|\d|true|false|\[)`, 1)},
+	"typescript": {h(`:\s*(string|number|boolean|void)\b`, 1), h(`^\s*(export )?interface \w+`, 2), h(`^import .* from ['"]`, 1)},
+	"yaml":       {h(`^---\s*$`, 1), h(`^[\w-]+:(\s+\S.*)?$`, 1), h(`^\s+- \S`, 1)},
+}
+
+// minScore is the weight of evidence needed before Detect commits to a
+// language, so that ordinary prose stays plain text.
+const minScore = 2
+
+// Detect guesses the language of content, returning "" when it has no good
+// guess.
+func Detect(content string) string {
+	trimmed := strings.TrimSpace(content)
+	if (strings.HasPrefix(trimmed, "{") || strings.HasPrefix(trimmed, "[")) && json.Valid([]byte(trimmed)) {
+		return "json"
+	}
+
+	best, bestScore := "", 0
+	for _, lang := range Languages {
+		score := 0
+		for _, hint := range hints[lang.ID] {
+			if hint.rx.MatchString(content) {
+				score += hint.weight
+			}
+		}
+		if score > bestScore {
+			best, bestScore = lang.ID, score
+		}
+	}
+	if bestScore < minScore {
+		return ""
+	}
+	return best
+}
+
+var formatter = html.New(html.WithClasses(true))
+
+// Render returns content highlighted as the language id, wrapped in
+// <pre class="chroma"><code>. Unsupported languages are rendered as plain
+// text.
+func Render(content, id string) (template.HTML, error) {
+	lexer := lexers.Get(id)
+	if !Supported(id) || lexer == nil {
+		lexer = lexers.Fallback
+	}
+	lexer = chroma.Coalesce(lexer)
+
+	iterator, err := lexer.Tokenise(nil, content)
+	if err != nil {
+		return "", err
+	}
+
+	var buf bytes.Buffer
+	err = formatter.Format(&buf, styles.Fallback, iterator)
+	if err != nil {
+		return "", err
+	}
+	return template.HTML(buf.String()), nil
+}
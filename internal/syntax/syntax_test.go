@@ -0,0 +1,77 @@
+package syntax
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDetect(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    string
+	}{
+		{
+			name:    "Go",
+			content: "package main\n\nimport \"fmt\"\n\nfunc main() {\n\tfmt.Println(\"hi\")\n}",
+			want:    "go",
+		},
+		{
+			name:    "Python",
+			content: "import os\n\ndef main():\n    print(os.getcwd())",
+			want:    "python",
+		},
+		{
+			name:    "Shell script",
+			content: "#!/bin/bash\necho \"hello\"",
+			want:    "bash",
+		},
+		{
+			name:    "SQL",
+			content: "SELECT id, title FROM notes WHERE public = TRUE;",
+			want:    "sql",
+		},
+		{
+			name:    "JSON",
+			content: `{"title": "An old silent pond", "public": true}`,
+			want:    "json",
+		},
+		{
+			name:    "Prose",
+			content: "An old silent pond...\nA frog jumps into the pond,\nsplash! Silence again.",
+			want:    "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Detect(tt.content); got != tt.want {
+				t.Errorf("got %q; want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRender(t *testing.T) {
+	got, err := Render("func main() {}", "go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(string(got), `<pre class="chroma"><code>`) {
+		t.Errorf("got %q; want it wrapped in <pre class=\"chroma\"><code>", got)
+	}
+	if !strings.Contains(string(got), `<span class="kd">func</span>`) {
+		t.Errorf("got %q; want the func keyword highlighted", got)
+	}
+	if strings.Contains(string(got), "style=") {
+		t.Errorf("got %q; want no inline styles", got)
+	}
+
+	got, err = Render("<script>alert(1)</script>", "unknown")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(got), "<script>") {
+		t.Errorf("got %q; want the content escaped", got)
+	}
+}
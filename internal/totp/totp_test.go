@@ -0,0 +1,62 @@
+package totp
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Abdelrahman-habib/noter/internal/assert"
+)
+
+// rfcSecret is the SHA-1 key of the RFC 6238 test vectors, base32 encoded.
+var rfcSecret = encoding.EncodeToString([]byte("12345678901234567890"))
+
+func TestCode(t *testing.T) {
+	// The RFC lists eight-digit codes; these are their last six digits.
+	tests := []struct {
+		unix int64
+		want string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	}
+	for _, tt := range tests {
+		got, err := Code(rfcSecret, time.Unix(tt.unix, 0))
+		assert.NilError(t, err)
+		assert.Equal(t, got, tt.want)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+	code, err := Code(rfcSecret, now)
+	assert.NilError(t, err)
+
+	step, ok := Validate(rfcSecret, code, now)
+	assert.Equal(t, ok, true)
+	assert.Equal(t, step, Step(now))
+
+	// Codes from the neighbouring time steps are accepted, older ones aren't.
+	_, ok = Validate(rfcSecret, code, now.Add(period*time.Second))
+	assert.Equal(t, ok, true)
+	_, ok = Validate(rfcSecret, code, now.Add(3*period*time.Second))
+	assert.Equal(t, ok, false)
+
+	// Secrets are accepted in lowercase and with spaces, as people type them.
+	_, ok = Validate(strings.ToLower(rfcSecret[:8])+" "+rfcSecret[8:], code, now)
+	assert.Equal(t, ok, true)
+
+	for _, input := range []string{"", "12345", "1234567", "abcdef"} {
+		_, ok = Validate(rfcSecret, input, now)
+		assert.Equal(t, ok, false)
+	}
+}
+
+func TestURL(t *testing.T) {
+	got := URL("Noter", "alice@example.com", "JBSWY3DPEHPK3PXP")
+	assert.Equal(t, got, "otpauth://totp/Noter:alice@example.com?algorithm=SHA1&digits=6&issuer=Noter&period=30&secret=JBSWY3DPEHPK3PXP")
+}
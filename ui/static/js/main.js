@@ -86,3 +86,52 @@ if (hamburgerMenu && navMenu) {
     }
   });
 }
+
+// Write/Preview tabs on the note form. The preview is rendered by the server,
+// which sanitizes it exactly as it will be when the note is viewed.
+var noteEditor = document.querySelector(".note-editor");
+
+if (noteEditor) {
+  var noteForm = noteEditor.closest("form");
+  var editorTextarea = noteEditor.querySelector("textarea");
+  var editorPreview = noteEditor.querySelector(".editor-preview");
+  var editorTabs = noteEditor.querySelectorAll(".editor-tab");
+
+  function selectEditorTab(name) {
+    for (var i = 0; i < editorTabs.length; i++) {
+      editorTabs[i].classList.toggle("active", editorTabs[i].dataset.tab == name);
+    }
+    editorTextarea.hidden = name != "write";
+    editorPreview.hidden = name != "preview";
+    if (name == "preview") {
+      showPreview();
+    }
+  }
+
+  function showPreview() {
+    editorPreview.textContent = "Loading preview...";
+    fetch("/note/preview", {
+      method: "POST",
+      credentials: "same-origin",
+      body: new URLSearchParams(new FormData(noteForm)),
+    })
+      .then(function (response) {
+        if (!response.ok) {
+          throw new Error(response.statusText);
+        }
+        return response.text();
+      })
+      .then(function (html) {
+        editorPreview.innerHTML = html;
+      })
+      .catch(function () {
+        editorPreview.textContent = "The preview could not be loaded.";
+      });
+  }
+
+  for (var i = 0; i < editorTabs.length; i++) {
+    editorTabs[i].addEventListener("click", function () {
+      selectEditorTab(this.dataset.tab);
+    });
+  }
+}